@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// maxDataProtectionLogGroups bounds the log groups whose policy is looked up, one API call each.
+const maxDataProtectionLogGroups = 50
+
+// The account policy API is newer than the SDK, so its operation is declared here.
+type describeAccountPoliciesInput struct {
+	_ struct{} `type:"structure"`
+
+	PolicyType *string `locationName:"policyType" type:"string"`
+	NextToken  *string `locationName:"nextToken" type:"string"`
+}
+
+type accountPolicy struct {
+	_ struct{} `type:"structure"`
+
+	AccountId       *string `locationName:"accountId" type:"string"`
+	LastUpdatedTime *int64  `locationName:"lastUpdatedTime" type:"long"`
+	PolicyDocument  *string `locationName:"policyDocument" type:"string"`
+	PolicyName      *string `locationName:"policyName" type:"string"`
+	PolicyType      *string `locationName:"policyType" type:"string"`
+	Scope           *string `locationName:"scope" type:"string"`
+}
+
+type describeAccountPoliciesOutput struct {
+	_ struct{} `type:"structure"`
+
+	AccountPolicies []*accountPolicy `locationName:"accountPolicies" type:"list"`
+	NextToken       *string          `locationName:"nextToken" type:"string"`
+}
+
+func describeDataProtectionAccountPolicies(ctx context.Context, svc *cloudwatchlogs.CloudWatchLogs) ([]*accountPolicy, error) {
+	policies := make([]*accountPolicy, 0)
+	input := &describeAccountPoliciesInput{PolicyType: aws.String("DATA_PROTECTION_POLICY")}
+	for len(policies) <= 100 { // safety limit
+		output := &describeAccountPoliciesOutput{}
+		req := svc.NewRequest(&request.Operation{Name: "DescribeAccountPolicies", HTTPMethod: "POST", HTTPPath: "/"}, input, output)
+		req.SetContext(ctx)
+		if err := req.Send(); err != nil {
+			return nil, err
+		}
+		policies = append(policies, output.AccountPolicies...)
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+	return policies, nil
+}
+
+// dataProtectionQuery returns the data protection policy of the account and of the log groups matching a prefix,
+// one row each, with the data identifiers they mask, for governance dashboards. Log groups without a policy of their own
+// are listed as unprotected, although the policy of the account applies to them.
+func (t *AwsCloudWatchLogsDatasource) dataProtectionQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	svc, err := t.getClient(tsdbReq.Datasource, parameters.Get("region").MustString())
+	if err != nil {
+		return nil, err
+	}
+	table := &datasource.Table{
+		Columns: []*datasource.TableColumn{
+			{Name: "Scope"}, {Name: "Name"}, {Name: "Protected"}, {Name: "DataIdentifiers"}, {Name: "LastUpdated"},
+		},
+	}
+	addRow := func(scope string, name string, document string, lastUpdated int64) {
+		table.Rows = append(table.Rows, &datasource.TableRow{
+			Values: []*datasource.RowValue{
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: scope},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: name},
+				{Kind: datasource.RowValue_TYPE_BOOL, BoolValue: document != ""},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: strings.Join(dataIdentifiers(document), ", ")},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: formatMillis(lastUpdated)},
+			},
+		})
+	}
+
+	policies, err := describeDataProtectionAccountPolicies(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		addRow("ACCOUNT", "", "", 0)
+	}
+	for _, p := range policies {
+		addRow("ACCOUNT", aws.StringValue(p.PolicyName), aws.StringValue(p.PolicyDocument), aws.Int64Value(p.LastUpdatedTime))
+	}
+
+	input := &cloudwatchlogs.DescribeLogGroupsInput{}
+	if prefix := parameters.Get("logGroupName").MustString(); prefix != "" {
+		input.LogGroupNamePrefix = aws.String(prefix)
+	}
+	logGroups := make([]string, 0)
+	err = svc.DescribeLogGroupsPagesWithContext(ctx, input, func(page *cloudwatchlogs.DescribeLogGroupsOutput, lastPage bool) bool {
+		for _, g := range page.LogGroups {
+			logGroups = append(logGroups, aws.StringValue(g.LogGroupName))
+		}
+		return len(logGroups) < maxDataProtectionLogGroups
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(logGroups) > maxDataProtectionLogGroups {
+		logGroups = logGroups[:maxDataProtectionLogGroups]
+	}
+	for _, name := range logGroups {
+		resp, err := getDataProtectionPolicy(svc, name)
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == cloudwatchlogs.ErrCodeResourceNotFoundException {
+			resp, err = &getDataProtectionPolicyOutput{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		addRow("LOG_GROUP", name, aws.StringValue(resp.PolicyDocument), aws.Int64Value(resp.LastUpdatedTime))
+	}
+
+	metaJson, err := json.Marshal(resultMeta{Notice: dataProtectionNotice(len(logGroups))})
+	if err != nil {
+		return nil, err
+	}
+	return &datasource.QueryResult{
+		Tables:   []*datasource.Table{table},
+		MetaJson: string(metaJson),
+	}, nil
+}
+
+func dataProtectionNotice(logGroups int) string {
+	if logGroups < maxDataProtectionLogGroups {
+		return ""
+	}
+	return "only the first 50 log groups are listed, narrow the log group prefix to see the others"
+}
+
+// dataIdentifiers returns the names of the sensitive data types of a data protection policy document,
+// e.g. EmailAddress for arn:aws:dataprotection::aws:data-identifier/EmailAddress.
+func dataIdentifiers(document string) []string {
+	var policy struct {
+		Statement []struct {
+			DataIdentifier []string
+		}
+	}
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, s := range policy.Statement {
+		for _, id := range s.DataIdentifier {
+			name := id[strings.LastIndex(id, "/")+1:]
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+const (
+	maxAlertSampleLines    = 20
+	maxAlertSampleLineSize = 500
+)
+
+// parseTarget reads the target of a query.
+// Alert rules send the model saved in the panel, which has no input built by the frontend, so it is converted here.
+func parseTarget(modelJson string) (Target, error) {
+	target := Target{}
+	model, err := simplejson.NewJson([]byte(modelJson))
+	if err != nil {
+		return target, err
+	}
+	_, hasInput := model.CheckGet("input")
+	_, hasInsightsInput := model.CheckGet("inputInsightsStartQuery")
+	if hasInput || hasInsightsInput {
+		err := json.Unmarshal([]byte(modelJson), &target)
+		return target, err
+	}
+	if model.Get("useInsights").MustBool() {
+		return target, fmt.Errorf("Insights queries are not supported in alert rules")
+	}
+
+	target = Target{
+		RefId:                      model.Get("refId").MustString(),
+		Format:                     model.Get("format").MustString("timeserie"),
+		Region:                     model.Get("region").MustString(),
+		LegendFormat:               model.Get("legendFormat").MustString(),
+		TimestampColumn:            model.Get("timestampColumn").MustString(),
+		ValueColumn:                model.Get("valueColumn").MustString(),
+		StartFromHead:              model.Get("startFromHead").MustBool(true),
+		Engine:                     model.Get("engine").MustString("filter"),
+		TopN:                       int(panelInt(model.Get("topN"), 5)),
+		LevelField:                 model.Get("levelField").MustString(),
+		ExcludeLogStreamNamePrefix: model.Get("excludeLogStreamNamePrefix").MustString(),
+		LogStreamNamePattern:       model.Get("logStreamNamePattern").MustString(),
+		TimeShift:                  model.Get("timeShift").MustString(),
+		TimeFrom:                   model.Get("timeFrom").MustString(),
+		TimeTo:                     model.Get("timeTo").MustString(),
+		LastN:                      panelInt(model.Get("lastN"), 0),
+		UnescapeJsonMessage:        model.Get("unescapeJsonMessage").MustBool(),
+		StripAnsi:                  model.Get("stripAnsi").MustBool(),
+		Multiline:                  model.Get("multiline").MustBool(),
+		MultilineStartPattern:      model.Get("multilineStartPattern").MustString(),
+		SampleMode:                 model.Get("sampleMode").MustString(),
+		LambdaFunction:             model.Get("lambdaFunction").MustString(),
+		LambdaQualifier:            model.Get("lambdaQualifier").MustString(),
+		Preset:                     model.Get("preset").MustString(),
+		PresetGroupBy:              model.Get("presetGroupBy").MustString(),
+		PresetColumns:              splitList(model.Get("presetColumns").MustString()),
+		PivotField:                 model.Get("pivotField").MustString(),
+		Template:                   model.Get("template").MustString(),
+		NodeField:                  model.Get("nodeField").MustString(),
+		CalleeField:                model.Get("calleeField").MustString(),
+		SpanField:                  model.Get("spanField").MustString(),
+		ParentSpanField:            model.Get("parentSpanField").MustString(),
+		ExcludeLogStreamNames:      splitList(model.Get("excludeLogStreamNames").MustString()),
+		AlertSampleLines:           int(panelInt(model.Get("alertSampleLines"), 0)),
+		CorrelationFields:          model.Get("correlationFields").MustBool(),
+		Rate:                       model.Get("rate").MustBool(),
+		Smoothing:                  model.Get("smoothing").MustString(),
+		SmoothingWindow:            int(panelInt(model.Get("smoothingWindow"), 0)),
+		alerting:                   true,
+	}
+	if rate, err := strconv.ParseFloat(model.Get("sampleRate").MustString(), 64); err == nil {
+		target.SampleRate = rate
+	}
+	for _, p := range splitList(model.Get("percentiles").MustString()) {
+		if v, err := strconv.ParseFloat(p, 64); err == nil {
+			target.Percentiles = append(target.Percentiles, v)
+		}
+	}
+
+	target.Input = cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:  aws.String(model.Get("logGroupName").MustString()),
+		FilterPattern: aws.String(model.Get("filterPattern").MustString()),
+		Interleaved:   aws.Bool(false),
+	}
+	if limit := panelInt(model.Get("limit"), 0); limit > 0 {
+		target.Input.Limit = aws.Int64(limit)
+	}
+	for _, n := range model.Get("logStreamNames").MustStringArray() {
+		if n != "" {
+			target.Input.LogStreamNames = append(target.Input.LogStreamNames, aws.String(n))
+		}
+	}
+	return target, nil
+}
+
+// panelInt reads a number of the panel model, which the query editor saves as a string.
+func panelInt(j *simplejson.Json, def int64) int64 {
+	if n, err := j.Int64(); err == nil {
+		return n
+	}
+	if n, err := strconv.ParseInt(strings.TrimSpace(j.MustString()), 10, 64); err == nil {
+		return n
+	}
+	return def
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// sampleLines returns the number of matched messages attached to the result meta of an alert query.
+func (target *Target) sampleLines() int {
+	if !target.alerting || target.AlertSampleLines <= 0 {
+		return 0
+	}
+	if target.AlertSampleLines > maxAlertSampleLines {
+		return maxAlertSampleLines
+	}
+	return target.AlertSampleLines
+}
+
+// sampleMessages returns the first n messages, shortened to fit in a notification.
+func sampleMessages(events []*cloudwatchlogs.FilteredLogEvent, n int) []string {
+	if n > len(events) {
+		n = len(events)
+	}
+	lines := make([]string, 0, n)
+	for _, e := range events[:n] {
+		line := strings.TrimSpace(aws.StringValue(e.Message))
+		if len(line) > maxAlertSampleLineSize {
+			line = line[:maxAlertSampleLineSize] + "..."
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+// The backend plugin protocol only carries the datasource (and its org), not the signed-in user,
+// so audit records identify the org and datasource that executed the query, and the dashboard and panel it was run from.
+type auditRecord struct {
+	Time           string
+	OrgId          int64
+	DatasourceId   int64
+	DatasourceName string
+	DashboardId    int64 `json:",omitempty"`
+	PanelId        int64 `json:",omitempty"`
+	RefId          string
+	QueryType      string
+	Region         string
+	LogGroupNames  []string
+	LogStreamNames []string `json:",omitempty"`
+	FilterPattern  string   `json:",omitempty"`
+	QueryString    string   `json:",omitempty"`
+	From           int64
+	To             int64
+
+	LogRecordPointer string `json:",omitempty"`
+}
+
+// auditLogPathEnv is the file audit records are appended to. It is configured by the operator rather than in the datasource settings,
+// as org admins could otherwise append to any file the Grafana server can write, or discard their own records.
+const auditLogPathEnv = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_AUDIT_LOG"
+
+var auditLogPath = os.Getenv(auditLogPathEnv)
+
+var auditFileLock sync.Mutex
+
+func newAuditRecord(datasourceInfo *datasource.DatasourceInfo, target *Target, from int64, to int64) *auditRecord {
+	record := &auditRecord{
+		Time:           time.Now().UTC().Format(time.RFC3339),
+		OrgId:          datasourceInfo.OrgId,
+		DatasourceId:   datasourceInfo.Id,
+		DatasourceName: datasourceInfo.Name,
+		DashboardId:    target.DashboardId,
+		PanelId:        target.PanelId,
+		RefId:          target.RefId,
+		Region:         target.Region,
+		From:           from,
+		To:             to,
+	}
+	if target.UseInsights {
+		record.QueryType = "insights"
+		record.QueryString = aws.StringValue(target.InputInsightsStartQuery.QueryString)
+		if target.InputInsightsStartQuery.LogGroupNames != nil {
+			record.LogGroupNames = aws.StringValueSlice(target.InputInsightsStartQuery.LogGroupNames)
+		} else {
+			record.LogGroupNames = []string{aws.StringValue(target.InputInsightsStartQuery.LogGroupName)}
+		}
+	} else {
+		record.QueryType = "filter"
+		record.LogGroupNames = []string{aws.StringValue(target.Input.LogGroupName)}
+		record.LogStreamNames = aws.StringValueSlice(target.Input.LogStreamNames)
+		record.FilterPattern = aws.StringValue(target.Input.FilterPattern)
+	}
+	return record
+}
+
+func (t *AwsCloudWatchLogsDatasource) auditQuery(datasourceInfo *datasource.DatasourceInfo, target *Target, from int64, to int64) {
+	t.audit(datasourceInfo, newAuditRecord(datasourceInfo, target, from, to))
+}
+
+// auditResourceQuery audits a resource query which reads log events, e.g. a tail or a preview, under its query type.
+func (t *AwsCloudWatchLogsDatasource) auditResourceQuery(datasourceInfo *datasource.DatasourceInfo, queryType string, target *Target, from int64, to int64) {
+	record := newAuditRecord(datasourceInfo, target, from, to)
+	record.QueryType = queryType
+	t.audit(datasourceInfo, record)
+}
+
+func (t *AwsCloudWatchLogsDatasource) audit(datasourceInfo *datasource.DatasourceInfo, record *auditRecord) {
+	dsInfo, err := t.getDsInfo(datasourceInfo, "")
+	if err != nil || dsInfo.AuditLog == "" {
+		return
+	}
+
+	switch dsInfo.AuditLog {
+	case "log":
+		pluginLogger.Info("audit",
+			"orgId", record.OrgId,
+			"datasourceId", record.DatasourceId,
+			"datasourceName", record.DatasourceName,
+			"dashboardId", record.DashboardId,
+			"panelId", record.PanelId,
+			"refId", record.RefId,
+			"queryType", record.QueryType,
+			"region", record.Region,
+			"logGroupNames", record.LogGroupNames,
+			"logStreamNames", record.LogStreamNames,
+			"filterPattern", record.FilterPattern,
+			"queryString", record.QueryString,
+			"from", record.From,
+			"to", record.To,
+			"logRecordPointer", record.LogRecordPointer,
+		)
+	case "file":
+		if auditLogPath == "" {
+			pluginLogger.Error("failed to write audit log", "error", auditLogPathEnv+" is not set")
+			return
+		}
+		if err := writeAuditFile(auditLogPath, record); err != nil {
+			pluginLogger.Error("failed to write audit log", "path", auditLogPath, "error", err)
+		}
+	case "cloudwatch":
+		s, err := t.auditShipperFor(datasourceInfo, dsInfo)
+		if err != nil {
+			pluginLogger.Error("failed to write audit log", "logGroup", dsInfo.AuditLogGroup, "error", err)
+			return
+		}
+		s.send(record)
+	}
+}
+
+func writeAuditFile(path string, record *auditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	auditFileLock.Lock()
+	defer auditFileLock.Unlock()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
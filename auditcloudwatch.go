@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+const (
+	auditFlushInterval = 5 * time.Second
+	auditBatchSize     = 100
+	// auditQueueSize bounds the records waiting to be sent, so that an unreachable log group does not grow the plugin memory.
+	auditQueueSize = 1000
+)
+
+// auditShipper sends the audit records of a datasource to a log stream, in batches and in the background,
+// so that queries do not wait for PutLogEvents. A log stream takes one writer at a time with sequence tokens,
+// so there is a shipper per stream, and the stream defaults to the host name of the Grafana server.
+type auditShipper struct {
+	t              *AwsCloudWatchLogsDatasource
+	lock           sync.Mutex
+	datasourceInfo *datasource.DatasourceInfo
+	region         string
+	logGroup       string
+	logStream      string
+	events         chan *cloudwatchlogs.InputLogEvent
+	sequenceToken  *string
+	streamReady    bool
+}
+
+var (
+	auditShippers    = make(map[string]*auditShipper)
+	auditShipperLock sync.Mutex
+)
+
+// auditRegion returns the region of the audit log group, the default region of the datasource,
+// which is required when records are sent to CloudWatch Logs.
+func (dsInfo *DatasourceInfo) auditRegion() (string, error) {
+	if dsInfo.AuditLog != "cloudwatch" {
+		return "", nil
+	}
+	if dsInfo.DefaultRegion == "" {
+		return "", fmt.Errorf("the default region of the datasource is required to send audit records to CloudWatch Logs")
+	}
+	target := &Target{}
+	if err := target.resolveRegion(dsInfo.DefaultRegion); err != nil {
+		return "", fmt.Errorf("invalid audit log region: %v", err)
+	}
+	return target.Region, nil
+}
+
+func (t *AwsCloudWatchLogsDatasource) auditShipperFor(datasourceInfo *datasource.DatasourceInfo, dsInfo *DatasourceInfo) (*auditShipper, error) {
+	if dsInfo.AuditLogGroup == "" {
+		return nil, fmt.Errorf("audit log group is not set")
+	}
+	region, err := dsInfo.auditRegion()
+	if err != nil {
+		return nil, err
+	}
+	stream := dsInfo.AuditLogStream
+	if stream == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		stream = "grafana-" + host
+	}
+	key := fmt.Sprintf("%d/%s/%s/%s", datasourceInfo.Id, region, dsInfo.AuditLogGroup, stream)
+
+	auditShipperLock.Lock()
+	defer auditShipperLock.Unlock()
+	s, ok := auditShippers[key]
+	if !ok {
+		s = &auditShipper{
+			t:         t,
+			region:    region,
+			logGroup:  dsInfo.AuditLogGroup,
+			logStream: stream,
+			events:    make(chan *cloudwatchlogs.InputLogEvent, auditQueueSize),
+		}
+		auditShippers[key] = s
+		go s.run()
+	}
+	// the settings sent with the latest query are used, so that rotated credentials are picked up
+	s.lock.Lock()
+	s.datasourceInfo = datasourceInfo
+	s.lock.Unlock()
+	return s, nil
+}
+
+func (s *auditShipper) send(record *auditRecord) {
+	message, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	e := &cloudwatchlogs.InputLogEvent{
+		Message:   aws.String(string(message)),
+		Timestamp: aws.Int64(time.Now().UnixNano() / int64(time.Millisecond)),
+	}
+	select {
+	case s.events <- e:
+	default:
+		pluginLogger.Error("audit queue is full, dropping record", "logGroup", s.logGroup, "refId", record.RefId)
+	}
+}
+
+func (s *auditShipper) run() {
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+	batch := make([]*cloudwatchlogs.InputLogEvent, 0, auditBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.flush(batch); err != nil {
+			pluginLogger.Error("failed to send audit records", "logGroup", s.logGroup, "logStream", s.logStream, "records", len(batch), "error", err)
+		}
+		batch = make([]*cloudwatchlogs.InputLogEvent, 0, auditBatchSize)
+	}
+	for {
+		select {
+		case e := <-s.events:
+			batch = append(batch, e)
+			if len(batch) >= auditBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// flush sends a batch, retrying once with a fresh sequence token when another writer used the stream.
+func (s *auditShipper) flush(batch []*cloudwatchlogs.InputLogEvent) error {
+	s.lock.Lock()
+	datasourceInfo := s.datasourceInfo
+	s.lock.Unlock()
+	svc, err := s.t.getClient(datasourceInfo, s.region)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(batch, func(i, j int) bool { return aws.Int64Value(batch[i].Timestamp) < aws.Int64Value(batch[j].Timestamp) })
+
+	for attempt := 0; ; attempt++ {
+		if !s.streamReady {
+			if err := s.prepareStream(svc); err != nil {
+				return err
+			}
+		}
+		resp, err := svc.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+			LogGroupName:  aws.String(s.logGroup),
+			LogStreamName: aws.String(s.logStream),
+			LogEvents:     batch,
+			SequenceToken: s.sequenceToken,
+		})
+		if err == nil {
+			s.sequenceToken = resp.NextSequenceToken
+			if resp.RejectedLogEventsInfo != nil {
+				return fmt.Errorf("records were rejected: %s", resp.RejectedLogEventsInfo.String())
+			}
+			return nil
+		}
+		if aerr, ok := err.(awserr.Error); ok {
+			switch aerr.Code() {
+			case cloudwatchlogs.ErrCodeDataAlreadyAcceptedException:
+				s.streamReady = false
+				return nil
+			case cloudwatchlogs.ErrCodeInvalidSequenceTokenException:
+				s.streamReady = false
+				if attempt == 0 {
+					continue
+				}
+			}
+		}
+		return err
+	}
+}
+
+// prepareStream creates the log stream when it does not exist, and reads its sequence token.
+func (s *auditShipper) prepareStream(svc *cloudwatchlogs.CloudWatchLogs) error {
+	_, err := svc.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(s.logGroup),
+		LogStreamName: aws.String(s.logStream),
+	})
+	if aerr, ok := err.(awserr.Error); err != nil && (!ok || aerr.Code() != cloudwatchlogs.ErrCodeResourceAlreadyExistsException) {
+		return err
+	}
+	resp, err := svc.DescribeLogStreams(&cloudwatchlogs.DescribeLogStreamsInput{
+		LogGroupName:        aws.String(s.logGroup),
+		LogStreamNamePrefix: aws.String(s.logStream),
+	})
+	if err != nil {
+		return err
+	}
+	s.sequenceToken = nil
+	for _, stream := range resp.LogStreams {
+		if aws.StringValue(stream.LogStreamName) == s.logStream {
+			s.sequenceToken = stream.UploadSequenceToken
+		}
+	}
+	s.streamReady = true
+	return nil
+}
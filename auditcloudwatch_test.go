@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestAuditRegion(t *testing.T) {
+	tests := []struct {
+		auditLog      string
+		defaultRegion string
+		want          string
+		err           bool
+	}{
+		{"", "", "", false},
+		{"log", "", "", false},
+		{"cloudwatch", "us-east-1", "us-east-1", false},
+		{"cloudwatch", "", "", true},
+		{"cloudwatch", "nowhere-1", "", true},
+	}
+	for _, tt := range tests {
+		dsInfo := &DatasourceInfo{AuditLog: tt.auditLog, DefaultRegion: tt.defaultRegion}
+		got, err := dsInfo.auditRegion()
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("auditRegion(%q, %q) = %q, %v", tt.auditLog, tt.defaultRegion, got, err)
+		}
+	}
+}
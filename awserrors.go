@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+// queryError is an AWS error explained in terms of the query, returned in the result meta as well as the error message,
+// so that panels can tell the cause apart without parsing SDK messages.
+type queryError struct {
+	Code    string
+	Message string
+	Hint    string `json:",omitempty"`
+	Cause   string `json:",omitempty"`
+}
+
+func (e *queryError) Error() string {
+	if e.Hint == "" {
+		return e.Message
+	}
+	return e.Message + " — " + e.Hint
+}
+
+// mapAwsError translates the common CloudWatch Logs error codes into actionable errors. Other errors are returned as is.
+func mapAwsError(err error, region string, logGroup string) error {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+	e := &queryError{Code: aerr.Code(), Cause: aerr.Message()}
+	switch aerr.Code() {
+	case "ResourceNotFoundException":
+		e.Message = fmt.Sprintf("log group %q not found in region %s", logGroup, region)
+		e.Hint = "check the region field and the log group name"
+	case "AccessDeniedException", "AccessDenied":
+		e.Message = fmt.Sprintf("access denied to log group %q in region %s", logGroup, region)
+		e.Hint = "the IAM identity of the datasource needs logs:FilterLogEvents, logs:GetLogEvents and logs:StartQuery on the log group"
+	case "UnrecognizedClientException", "InvalidClientTokenId", "ExpiredTokenException", "ExpiredToken":
+		e.Message = "the AWS credentials of the datasource are invalid or expired"
+		e.Hint = "check the auth provider in the datasource settings"
+	case "ThrottlingException", "Throttling", "LimitExceededException", "RequestLimitExceeded":
+		e.Message = fmt.Sprintf("CloudWatch Logs throttled the requests in region %s, even after retries", region)
+		e.Hint = "reduce the refresh rate or the number of panels, or request a higher API quota"
+	case "InvalidParameterException":
+		e.Message = fmt.Sprintf("CloudWatch Logs rejected a parameter of the query: %s", aerr.Message())
+		e.Hint = "check the filter pattern, the log stream names and the time range"
+	case "MalformedQueryException":
+		e.Message = fmt.Sprintf("invalid Insights query: %s", aerr.Message())
+		e.Hint = "check the query string syntax"
+	default:
+		return err
+	}
+	return e
+}
+
+// errorResult returns the error as the result of refId, with the details of a queryError in the meta.
+func errorResult(refId string, err error) *datasource.QueryResult {
+	r := &datasource.QueryResult{
+		RefId: refId,
+		Error: err.Error(),
+	}
+	if qerr, ok := err.(*queryError); ok {
+		if metaJson, merr := json.Marshal(map[string]*queryError{"Error": qerr}); merr == nil {
+			r.MetaJson = string(metaJson)
+		}
+	}
+	return r
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const (
+	circuitFailureThreshold = 5
+	circuitOpenDuration     = 1 * time.Minute
+)
+
+type circuit struct {
+	failures  int
+	openUntil time.Time
+}
+
+var (
+	circuits    = make(map[string]*circuit)
+	circuitLock sync.Mutex
+)
+
+// Timeouts usually affect the whole region, while access denied errors are specific to a log group,
+// so failures are tracked per region and per log group respectively.
+func regionCircuitKey(datasourceId int64, region string) string {
+	return fmt.Sprintf("%d/%s", datasourceId, region)
+}
+
+func logGroupCircuitKey(datasourceId int64, region string, logGroupName string) string {
+	return fmt.Sprintf("%d/%s/%s", datasourceId, region, logGroupName)
+}
+
+func checkCircuit(keys ...string) error {
+	circuitLock.Lock()
+	defer circuitLock.Unlock()
+	now := time.Now()
+	for _, key := range keys {
+		c, ok := circuits[key]
+		if !ok || c.failures < circuitFailureThreshold {
+			continue
+		}
+		if now.Before(c.openUntil) {
+			return fmt.Errorf("circuit open for %s after %d consecutive failures, retrying in %s", key, c.failures, c.openUntil.Sub(now).Round(time.Second))
+		}
+		// half-open, let this query through and reopen on the next failure
+		c.openUntil = now.Add(circuitOpenDuration)
+	}
+	return nil
+}
+
+func recordCircuitResult(regionKey string, logGroupKey string, err error) {
+	circuitLock.Lock()
+	defer circuitLock.Unlock()
+	if err == nil {
+		delete(circuits, regionKey)
+		delete(circuits, logGroupKey)
+		return
+	}
+
+	var key string
+	switch {
+	case isTimeoutError(err):
+		key = regionKey
+	case isAccessDeniedError(err):
+		key = logGroupKey
+	default:
+		return
+	}
+	c, ok := circuits[key]
+	if !ok {
+		c = &circuit{}
+		circuits[key] = c
+	}
+	c.failures++
+	if c.failures >= circuitFailureThreshold {
+		c.openUntil = time.Now().Add(circuitOpenDuration)
+	}
+}
+
+func isAccessDeniedError(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "AccessDeniedException", "AccessDenied", "UnrecognizedClientException":
+			return true
+		}
+	}
+	return false
+}
+
+func isTimeoutError(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		if aerr.Code() == request.ErrCodeResponseTimeout || aerr.Code() == "RequestTimeout" || aerr.Code() == "RequestTimeoutException" {
+			return true
+		}
+		err = aerr.OrigErr()
+	}
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+// Creating a client resolves the session and credentials, so clients are shared by the requests of a datasource.
+// clientCacheSizeEnv sets the number of clients kept, 0 disables the cache.
+const clientCacheSizeEnv = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_CLIENT_CACHE_SIZE"
+
+type cachedClient struct {
+	key       string
+	client    *cloudwatchlogs.CloudWatchLogs
+	expiresAt time.Time
+}
+
+type clientCache struct {
+	lock       sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List
+	hits       int64
+	misses     int64
+}
+
+type clientCacheStats struct {
+	Entries    int
+	MaxEntries int
+	Hits       int64
+	Misses     int64
+	HitRate    float64
+}
+
+var awsClientCache = newClientCache(64)
+
+var clientCacheRequests = newCounterVec("client_cache_requests_total", "Number of client cache lookups.", "result")
+
+func init() {
+	if v := os.Getenv(clientCacheSizeEnv); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			pluginLogger.Error("invalid client cache size", "env", clientCacheSizeEnv, "value", v)
+		} else {
+			awsClientCache.maxEntries = n
+		}
+	}
+}
+
+func newClientCache(maxEntries int) *clientCache {
+	return &clientCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// clientCacheKey identifies the settings a client was created with. Grafana sends the settings with each request,
+// so that a change of the settings or secrets of a datasource gets a new client without invalidating the old one.
+func clientCacheKey(datasourceInfo *datasource.DatasourceInfo, region string) string {
+	h := sha256.New()
+	h.Write([]byte(datasourceInfo.JsonData))
+	keys := make([]string, 0, len(datasourceInfo.DecryptedSecureJsonData))
+	for k := range datasourceInfo.DecryptedSecureJsonData {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "\x00%s=%s", k, datasourceInfo.DecryptedSecureJsonData[k])
+	}
+	return fmt.Sprintf("%d/%d/%s/%s", datasourceInfo.OrgId, datasourceInfo.Id, region, hex.EncodeToString(h.Sum(nil)))
+}
+
+// get returns a copy of the cached client with its own handlers, so that a request can add handlers to it
+// without affecting the other requests.
+func (c *clientCache) get(key string) *cloudwatchlogs.CloudWatchLogs {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	el, ok := c.entries[key]
+	if ok && time.Now().After(el.Value.(*cachedClient).expiresAt) {
+		c.remove(el)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		clientCacheRequests.inc("miss")
+		return nil
+	}
+	c.hits++
+	clientCacheRequests.inc("hit")
+	c.order.MoveToFront(el)
+	return copyClient(el.Value.(*cachedClient).client)
+}
+
+// put caches a client until its credentials expire, and returns a copy of it for the caller.
+func (c *clientCache) put(key string, client *cloudwatchlogs.CloudWatchLogs, expiresAt time.Time) *cloudwatchlogs.CloudWatchLogs {
+	if c.maxEntries <= 0 || expiresAt.IsZero() {
+		return client
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&cachedClient{key: key, client: client, expiresAt: expiresAt})
+	for len(c.entries) > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+	return copyClient(client)
+}
+
+// purge drops every cached client, e.g. when the shared credentials files changed.
+func (c *clientCache) purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+func (c *clientCache) stats() clientCacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	s := clientCacheStats{
+		Entries:    len(c.entries),
+		MaxEntries: c.maxEntries,
+		Hits:       c.hits,
+		Misses:     c.misses,
+	}
+	if c.hits+c.misses > 0 {
+		s.HitRate = float64(c.hits) / float64(c.hits+c.misses)
+	}
+	return s
+}
+
+func (c *clientCache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*cachedClient)
+	delete(c.entries, e.key)
+}
+
+func copyClient(svc *cloudwatchlogs.CloudWatchLogs) *cloudwatchlogs.CloudWatchLogs {
+	c := *svc.Client
+	c.Handlers = svc.Handlers.Copy()
+	return &cloudwatchlogs.CloudWatchLogs{Client: &c}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+// correlationField is an identifier extracted from messages into a column of a stable name,
+// so that Grafana Correlations and data links can pivot on it to other datasources.
+type correlationField struct {
+	name     string
+	patterns []*regexp.Regexp
+}
+
+// The patterns are tried in order, and the first group of the first match is the value.
+var correlationFields = []correlationField{
+	{
+		name: "TraceId",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)"(?:trace_?id|x-?amzn-?trace-?id)"\s*:\s*"(?:Root=)?([^";]+)`),
+			regexp.MustCompile(`\b(1-[0-9a-f]{8}-[0-9a-f]{24})\b`),
+		},
+	},
+	{
+		name: "RequestId",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)"(?:request_?id|aws_?request_?id)"\s*:\s*"([^"]+)"`),
+			regexp.MustCompile(`RequestId: ([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})`),
+		},
+	},
+	{
+		name: "InstanceId",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)"(?:instance_?id|ec2_?instance_?id)"\s*:\s*"([^"]+)"`),
+			regexp.MustCompile(`\b(i-[0-9a-f]{17}|i-[0-9a-f]{8})\b`),
+		},
+	},
+}
+
+// extractsCorrelationFields reports whether the events of the target are returned with the correlation columns.
+func (target *Target) extractsCorrelationFields() bool {
+	return target.CorrelationFields && target.Preset == "" && (target.Format == "" || target.Format == "table")
+}
+
+func correlationFieldNames() []string {
+	names := make([]string, 0, len(correlationFields))
+	for _, f := range correlationFields {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+func (f correlationField) extract(message string) string {
+	for _, p := range f.patterns {
+		if m := p.FindStringSubmatch(message); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// addCorrelationColumns appends a column per correlation field to a table of events, built by parseTableResponse.
+func addCorrelationColumns(table *datasource.Table, events []*cloudwatchlogs.FilteredLogEvent) {
+	for _, f := range correlationFields {
+		table.Columns = append(table.Columns, &datasource.TableColumn{Name: f.name})
+	}
+	values := make([]datasource.RowValue, len(events)*len(correlationFields))
+	for i, e := range events {
+		message := aws.StringValue(e.Message)
+		for j, f := range correlationFields {
+			v := &values[i*len(correlationFields)+j]
+			*v = datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: f.extract(message)}
+			table.Rows[i].Values = append(table.Rows[i].Values, v)
+		}
+	}
+}
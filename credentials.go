@@ -15,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials/endpointcreds"
 	"github.com/aws/aws-sdk-go/aws/defaults"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go/service/sts"
@@ -23,6 +24,8 @@ import (
 type cache struct {
 	credential *credentials.Credentials
 	expiration *time.Time
+	created    time.Time
+	source     string
 }
 
 var awsCredentialCache = make(map[string]cache)
@@ -31,15 +34,58 @@ var credentialCacheLock sync.RWMutex
 type DatasourceInfo struct {
 	Profile       string `json:"profile"`
 	Region        string
+	DefaultRegion string `json:"defaultRegion"`
 	AuthType      string `json:"authType"`
 	AssumeRoleArn string `json:"assumeRoleArn"`
+	LogLevel      string `json:"logLevel"`
+	AuditLog      string `json:"auditLog"`
 
-	AccessKey string
-	SecretKey string
+	AuditLogGroup  string `json:"auditLogGroup"`
+	AuditLogStream string `json:"auditLogStream"`
+
+	// DefaultLogGroupName is a comma separated list of log group names or prefixes ending with "*".
+	DefaultLogGroupName string          `json:"defaultLogGroupName"`
+	QueryTemplates      []queryTemplate `json:"queryTemplates"`
+
+	MaxRetries       *int   `json:"maxRetries"`
+	RetryBaseDelayMs int    `json:"retryBaseDelayMs"`
+	RetryJitter      string `json:"retryJitter"`
+
+	LongRangeWarningHours      int `json:"longRangeWarningHours"`
+	AutoInsightsThresholdHours int `json:"autoInsightsThresholdHours"`
+	RetentionWarningDays       int `json:"retentionWarningDays"`
+
+	InsightsPricePerGB   float64 `json:"insightsPricePerGB"`
+	ApiPricePer1000Calls float64 `json:"apiPricePer1000Calls"`
+	ScanBudgetGB         float64 `json:"scanBudgetGB"`
+	ScanBudgetPages      int     `json:"scanBudgetPages"`
+
+	AllowWrites bool `json:"allowWrites"`
+
+	RateLimit float64 `json:"rateLimit"`
+	RateBurst int     `json:"rateBurst"`
+
+	QueryTimeoutSeconds int `json:"queryTimeoutSeconds"`
+
+	RedactionPresets map[string]bool `json:"redactionPresets"`
+	RedactionRules   []redactionRule `json:"redactionRules"`
+
+	VaultAddr           string `json:"vaultAddr"`
+	VaultMount          string `json:"vaultMount"`
+	VaultRole           string `json:"vaultRole"`
+	VaultCredentialType string `json:"vaultCredentialType"`
+
+	AccessKey  string
+	SecretKey  string
+	VaultToken string
+
+	roleSessionName string
 }
 
 func GetCredentials(dsInfo *DatasourceInfo) (*credentials.Credentials, error) {
-	cacheKey := dsInfo.AccessKey + ":" + dsInfo.Profile + ":" + dsInfo.AssumeRoleArn
+	checkSharedFiles()
+
+	cacheKey := dsInfo.credentialCacheKey()
 	credentialCacheLock.RLock()
 	if _, ok := awsCredentialCache[cacheKey]; ok {
 		if awsCredentialCache[cacheKey].expiration != nil &&
@@ -55,10 +101,28 @@ func GetCredentials(dsInfo *DatasourceInfo) (*credentials.Credentials, error) {
 	secretAccessKey := ""
 	sessionToken := ""
 	var expiration *time.Time = nil
+	if dsInfo.AuthType == "vault" {
+		// the provider refreshes the credentials when the lease expires, so they are cached until the settings change
+		provider, err := newVaultProvider(dsInfo)
+		if err != nil {
+			return nil, err
+		}
+		creds := credentials.NewCredentials(provider)
+		e := time.Now().Add(24 * time.Hour)
+		credentialCacheLock.Lock()
+		awsCredentialCache[cacheKey] = cache{
+			credential: creds,
+			expiration: &e,
+			created:    time.Now(),
+			source:     dsInfo.credentialSource(),
+		}
+		credentialCacheLock.Unlock()
+		return creds, nil
+	}
 	if dsInfo.AuthType == "arn" {
 		params := &sts.AssumeRoleInput{
 			RoleArn:         aws.String(dsInfo.AssumeRoleArn),
-			RoleSessionName: aws.String("GrafanaSession"),
+			RoleSessionName: aws.String(dsInfo.sessionName()),
 			DurationSeconds: aws.Int64(900),
 		}
 
@@ -122,12 +186,46 @@ func GetCredentials(dsInfo *DatasourceInfo) (*credentials.Credentials, error) {
 	awsCredentialCache[cacheKey] = cache{
 		credential: creds,
 		expiration: expiration,
+		created:    time.Now(),
+		source:     dsInfo.credentialSource(),
 	}
 	credentialCacheLock.Unlock()
 
 	return creds, nil
 }
 
+func (dsInfo *DatasourceInfo) credentialCacheKey() string {
+	if dsInfo.AuthType == "vault" {
+		return "vault:" + dsInfo.VaultAddr + ":" + dsInfo.VaultMount + ":" + dsInfo.VaultCredentialType + ":" + dsInfo.VaultRole + ":" + dsInfo.VaultToken
+	}
+	return dsInfo.AccessKey + ":" + dsInfo.Profile + ":" + dsInfo.AssumeRoleArn
+}
+
+// credentialExpiration returns when the cached credentials of the datasource expire, so that clients using them are not kept longer.
+func (dsInfo *DatasourceInfo) credentialExpiration() time.Time {
+	credentialCacheLock.RLock()
+	defer credentialCacheLock.RUnlock()
+	if c, ok := awsCredentialCache[dsInfo.credentialCacheKey()]; ok && c.expiration != nil {
+		return *c.expiration
+	}
+	return time.Time{}
+}
+
+// credentialSource describes the credentials for diagnostics, without their secrets.
+func (dsInfo *DatasourceInfo) credentialSource() string {
+	switch {
+	case dsInfo.AuthType == "vault":
+		return "vault role " + dsInfo.VaultRole
+	case dsInfo.AuthType == "arn":
+		return "assumed role " + dsInfo.AssumeRoleArn
+	case dsInfo.AccessKey != "" && len(dsInfo.AccessKey) > 4:
+		return "access key ..." + dsInfo.AccessKey[len(dsInfo.AccessKey)-4:]
+	case dsInfo.Profile != "":
+		return "profile " + dsInfo.Profile
+	}
+	return "default credentials"
+}
+
 func remoteCredProvider(sess *session.Session) credentials.Provider {
 	ecsCredURI := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
 
@@ -154,21 +252,69 @@ func ec2RoleProvider(sess *session.Session) credentials.Provider {
 
 func (t *AwsCloudWatchLogsDatasource) getDsInfo(datasourceInfo *datasource.DatasourceInfo, region string) (*DatasourceInfo, error) {
 	var dsInfo DatasourceInfo
-	if err := json.Unmarshal([]byte(datasourceInfo.JsonData), &dsInfo); err != nil {
-		return nil, err
+	if datasourceInfo.JsonData != "" {
+		if err := json.Unmarshal([]byte(datasourceInfo.JsonData), &dsInfo); err != nil {
+			return nil, fmt.Errorf("invalid datasource settings: %v", err)
+		}
 	}
 
+	// calls without a region, such as the resource queries of the query editor, use the default region of the datasource
 	dsInfo.Region = region
+	if region == "" || region == "default" {
+		dsInfo.Region = dsInfo.DefaultRegion
+	}
 	if v, ok := datasourceInfo.DecryptedSecureJsonData["accessKey"]; ok {
 		dsInfo.AccessKey = v
 	}
 	if v, ok := datasourceInfo.DecryptedSecureJsonData["secretKey"]; ok {
 		dsInfo.SecretKey = v
 	}
+	if v, ok := datasourceInfo.DecryptedSecureJsonData["vaultToken"]; ok {
+		dsInfo.VaultToken = v
+	}
+	dsInfo.applyOrgRole(datasourceInfo.OrgId)
 
 	return &dsInfo, nil
 }
 
+func (dsInfo *DatasourceInfo) sessionName() string {
+	if dsInfo.roleSessionName != "" {
+		return dsInfo.roleSessionName
+	}
+	return "GrafanaSession"
+}
+
+func (dsInfo *DatasourceInfo) longRangeThreshold() time.Duration {
+	if dsInfo.LongRangeWarningHours > 0 {
+		return time.Duration(dsInfo.LongRangeWarningHours) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+func (dsInfo *DatasourceInfo) autoInsightsThreshold() time.Duration {
+	if dsInfo.AutoInsightsThresholdHours > 0 {
+		return time.Duration(dsInfo.AutoInsightsThresholdHours) * time.Hour
+	}
+	return dsInfo.longRangeThreshold()
+}
+
+// retentionWarning defaults to a week, long enough to export the events of an incident before they expire.
+// A negative number of days disables the warning.
+func (dsInfo *DatasourceInfo) retentionWarning() time.Duration {
+	if dsInfo.RetentionWarningDays != 0 {
+		return time.Duration(dsInfo.RetentionWarningDays) * 24 * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// insightsPricePerGB defaults to the us-east-1 price of Logs Insights queries per GB of data scanned.
+func (dsInfo *DatasourceInfo) insightsPricePerGB() float64 {
+	if dsInfo.InsightsPricePerGB > 0 {
+		return dsInfo.InsightsPricePerGB
+	}
+	return 0.005
+}
+
 func (t *AwsCloudWatchLogsDatasource) getAwsConfig(dsInfo *DatasourceInfo) (*aws.Config, error) {
 	creds, err := GetCredentials(dsInfo)
 	if err != nil {
@@ -179,14 +325,24 @@ func (t *AwsCloudWatchLogsDatasource) getAwsConfig(dsInfo *DatasourceInfo) (*aws
 		Region:      aws.String(dsInfo.Region),
 		Credentials: creds,
 	}
-	return cfg, nil
+	return request.WithRetryer(cfg, newRetryer(dsInfo)), nil
 }
 
 func (t *AwsCloudWatchLogsDatasource) getClient(datasourceInfo *datasource.DatasourceInfo, region string) (*cloudwatchlogs.CloudWatchLogs, error) {
+	checkSharedFiles()
+	cacheKey := clientCacheKey(datasourceInfo, region)
+	if client := awsClientCache.get(cacheKey); client != nil {
+		return client, nil
+	}
+
 	dsInfo, err := t.getDsInfo(datasourceInfo, region)
 	if err != nil {
 		return nil, err
 	}
+	redact, err := newRedactor(dsInfo)
+	if err != nil {
+		return nil, err
+	}
 	cfg, err := t.getAwsConfig(dsInfo)
 	if err != nil {
 		return nil, err
@@ -198,5 +354,62 @@ func (t *AwsCloudWatchLogsDatasource) getClient(datasourceInfo *datasource.Datas
 	}
 
 	client := cloudwatchlogs.New(sess, cfg)
+	instrumentHandlers(&client.Handlers)
+	client.Handlers.Build.PushBack(rewriteLogGroupArns)
+	client.Handlers.Complete.PushBack(usageFor(datasourceInfo.Id).handler())
+	if redact != nil {
+		client.Handlers.Unmarshal.PushBackNamed(redact.handler())
+	}
+	if limiter := rateLimiterFor(datasourceInfo.Id, dsInfo); limiter != nil {
+		// signing runs before each attempt, so that retries wait for a token as well
+		client.Handlers.Sign.PushFrontNamed(limiter.handler())
+	}
+	return awsClientCache.put(cacheKey, client, dsInfo.credentialExpiration()), nil
+}
+
+// getSession returns a session with the credentials of the datasource, for clients of other AWS services.
+func (t *AwsCloudWatchLogsDatasource) getSession(datasourceInfo *datasource.DatasourceInfo, region string) (*session.Session, error) {
+	dsInfo, err := t.getDsInfo(datasourceInfo, region)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := t.getAwsConfig(dsInfo)
+	if err != nil {
+		return nil, err
+	}
+	return session.NewSession(cfg)
+}
+
+// clientSet shares CloudWatch Logs clients between the targets of a single request,
+// and counts their calls. Targets may be run concurrently, so it is locked.
+type clientSet struct {
+	lock           sync.Mutex
+	t              *AwsCloudWatchLogsDatasource
+	datasourceInfo *datasource.DatasourceInfo
+	clients        map[string]*cloudwatchlogs.CloudWatchLogs
+	calls          *apiCallCounter
+}
+
+func (t *AwsCloudWatchLogsDatasource) newClientSet(datasourceInfo *datasource.DatasourceInfo) *clientSet {
+	return &clientSet{
+		t:              t,
+		datasourceInfo: datasourceInfo,
+		clients:        make(map[string]*cloudwatchlogs.CloudWatchLogs),
+		calls:          &apiCallCounter{},
+	}
+}
+
+func (c *clientSet) get(region string) (*cloudwatchlogs.CloudWatchLogs, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if client, ok := c.clients[region]; ok {
+		return client, nil
+	}
+	client, err := c.t.getClient(c.datasourceInfo, region)
+	if err != nil {
+		return nil, err
+	}
+	c.calls.count(&client.Handlers)
+	c.clients[region] = client
 	return client, nil
 }
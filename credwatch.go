@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// sharedFilesCheckInterval is how often the shared credentials and config files are checked for changes.
+const sharedFilesCheckInterval = 10 * time.Second
+
+var (
+	sharedFilesLock      sync.Mutex
+	sharedFilesCheckedAt time.Time
+	sharedFilesModTimes  map[string]time.Time
+)
+
+func sharedFilePaths() []string {
+	credentialsFile := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credentialsFile == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			credentialsFile = filepath.Join(home, ".aws", "credentials")
+		}
+	}
+	configFile := os.Getenv("AWS_CONFIG_FILE")
+	if configFile == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			configFile = filepath.Join(home, ".aws", "config")
+		}
+	}
+	return []string{credentialsFile, configFile}
+}
+
+// checkSharedFiles drops the cached credentials and clients when the shared credentials or config files were rewritten,
+// e.g. by aws-vault or a sidecar rotating keys, since the shared credentials provider reads them only once.
+func checkSharedFiles() {
+	sharedFilesLock.Lock()
+	defer sharedFilesLock.Unlock()
+
+	now := time.Now()
+	if now.Sub(sharedFilesCheckedAt) < sharedFilesCheckInterval {
+		return
+	}
+	sharedFilesCheckedAt = now
+
+	modTimes := make(map[string]time.Time)
+	for _, p := range sharedFilePaths() {
+		if p == "" {
+			continue
+		}
+		if fi, err := os.Stat(p); err == nil {
+			modTimes[p] = fi.ModTime()
+		}
+	}
+
+	changed := sharedFilesModTimes != nil && len(modTimes) != len(sharedFilesModTimes)
+	for p, m := range modTimes {
+		if prev, ok := sharedFilesModTimes[p]; sharedFilesModTimes != nil && (!ok || !prev.Equal(m)) {
+			changed = true
+		}
+	}
+	sharedFilesModTimes = modTimes
+	if !changed {
+		return
+	}
+
+	pluginLogger.Info("shared AWS credentials changed, reloading")
+	credentialCacheLock.Lock()
+	awsCredentialCache = make(map[string]cache)
+	credentialCacheLock.Unlock()
+	awsClientCache.purge()
+}
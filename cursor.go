@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// eventCursor is the position a truncated response resumes from: the token of the page it stopped in,
+// and the number of events of that page which were already returned.
+type eventCursor struct {
+	Token string `json:"t"`
+	Skip  int    `json:"s"`
+}
+
+// encodeCursor returns the plain AWS token when the page was read entirely, so that it can be passed to the API as is.
+func encodeCursor(token string, skip int) *string {
+	if skip == 0 {
+		if token == "" {
+			return nil
+		}
+		return aws.String(token)
+	}
+	b, _ := json.Marshal(eventCursor{Token: token, Skip: skip})
+	return aws.String(base64.URLEncoding.EncodeToString(b))
+}
+
+func decodeCursor(s string) eventCursor {
+	if b, err := base64.URLEncoding.DecodeString(s); err == nil {
+		var c eventCursor
+		if err := json.Unmarshal(b, &c); err == nil && c.Skip > 0 {
+			return c
+		}
+	}
+	return eventCursor{Token: s}
+}
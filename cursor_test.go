@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestEncodeCursor(t *testing.T) {
+	token := "f/35000000000000000000000000000000000000000000000000000000/s"
+	if got := encodeCursor("", 0); got != nil {
+		t.Errorf("encodeCursor of the last page = %q, want nil", *got)
+	}
+	if got := aws.StringValue(encodeCursor(token, 0)); got != token {
+		t.Errorf("encodeCursor of a page read entirely = %q, want the AWS token", got)
+	}
+
+	tests := []struct {
+		token string
+		skip  int
+	}{
+		{token, 3},
+		{"", 10},
+	}
+	for _, tt := range tests {
+		got := encodeCursor(tt.token, tt.skip)
+		if got == nil {
+			t.Fatalf("encodeCursor(%q, %d) = nil", tt.token, tt.skip)
+		}
+		if c := decodeCursor(*got); c.Token != tt.token || c.Skip != tt.skip {
+			t.Errorf("decodeCursor(encodeCursor(%q, %d)) = %+v", tt.token, tt.skip, c)
+		}
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	tests := []struct {
+		in   string
+		want eventCursor
+	}{
+		{"", eventCursor{}},
+		{"f/35000000000000000000000000000000000000000000000000000000/s", eventCursor{Token: "f/35000000000000000000000000000000000000000000000000000000/s"}},
+		// base64 of JSON without a skip is an AWS token rather than a cursor
+		{"eyJ0IjoiYWJjIn0=", eventCursor{Token: "eyJ0IjoiYWJjIn0="}},
+		{"eyJ0IjoiYWJjIiwicyI6Mn0=", eventCursor{Token: "abc", Skip: 2}},
+	}
+	for _, tt := range tests {
+		if got := decodeCursor(tt.in); got != tt.want {
+			t.Errorf("decodeCursor(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
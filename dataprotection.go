@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+// dataProtectionTTL is how long the data protection policy of a log group is remembered,
+// so that each query does not look it up again.
+const dataProtectionTTL = 10 * time.Minute
+
+// maskedValuePattern matches the asterisks CloudWatch Logs replaces sensitive data with,
+// in log groups with a data protection policy, for identities without logs:Unmask.
+var maskedValuePattern = regexp.MustCompile(`\*{4,}`)
+
+// The data protection API is newer than the SDK, so its operation is declared here.
+type getDataProtectionPolicyInput struct {
+	_ struct{} `type:"structure"`
+
+	LogGroupIdentifier *string `locationName:"logGroupIdentifier" type:"string"`
+}
+
+type getDataProtectionPolicyOutput struct {
+	_ struct{} `type:"structure"`
+
+	LogGroupIdentifier *string `locationName:"logGroupIdentifier" type:"string"`
+	PolicyDocument     *string `locationName:"policyDocument" type:"string"`
+	LastUpdatedTime    *int64  `locationName:"lastUpdatedTime" type:"long"`
+}
+
+type dataProtectionEntry struct {
+	protected bool
+	expiresAt time.Time
+}
+
+var (
+	dataProtectionPolicies = make(map[string]dataProtectionEntry)
+	dataProtectionLock     sync.Mutex
+)
+
+func getDataProtectionPolicy(svc *cloudwatchlogs.CloudWatchLogs, logGroupName string) (*getDataProtectionPolicyOutput, error) {
+	output := &getDataProtectionPolicyOutput{}
+	req := svc.NewRequest(&request.Operation{Name: "GetDataProtectionPolicy", HTTPMethod: "POST", HTTPPath: "/"}, &getDataProtectionPolicyInput{
+		LogGroupIdentifier: aws.String(logGroupName),
+	}, output)
+	return output, req.Send()
+}
+
+// hasDataProtectionPolicy reports whether the log group masks sensitive data. The policy is only looked up
+// to explain masked values, so that a failed lookup, e.g. when the role lacks logs:GetDataProtectionPolicy,
+// is logged and treated as no policy rather than failing the query.
+func hasDataProtectionPolicy(svc *cloudwatchlogs.CloudWatchLogs, datasourceId int64, region string, logGroupName string) bool {
+	key := fmt.Sprintf("%d/%s/%s", datasourceId, region, logGroupName)
+	dataProtectionLock.Lock()
+	e, ok := dataProtectionPolicies[key]
+	dataProtectionLock.Unlock()
+	if ok && time.Now().Before(e.expiresAt) {
+		return e.protected
+	}
+
+	resp, err := getDataProtectionPolicy(svc, logGroupName)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != cloudwatchlogs.ErrCodeResourceNotFoundException {
+			pluginLogger.Debug("failed to get the data protection policy", "logGroup", logGroupName, "error", err)
+		}
+	}
+	e = dataProtectionEntry{protected: err == nil && aws.StringValue(resp.PolicyDocument) != "", expiresAt: time.Now().Add(dataProtectionTTL)}
+	dataProtectionLock.Lock()
+	dataProtectionPolicies[key] = e
+	dataProtectionLock.Unlock()
+	return e.protected
+}
+
+// addMaskedColumn appends a column telling whether the message of each event has masked values,
+// to a table of events built by parseTableResponse.
+func addMaskedColumn(table *datasource.Table, events []*cloudwatchlogs.FilteredLogEvent) {
+	table.Columns = append(table.Columns, &datasource.TableColumn{Name: "Masked"})
+	values := make([]datasource.RowValue, len(events))
+	for i, e := range events {
+		values[i] = datasource.RowValue{Kind: datasource.RowValue_TYPE_BOOL, BoolValue: maskedValuePattern.MatchString(aws.StringValue(e.Message))}
+		table.Rows[i].Values = append(table.Rows[i].Values, &values[i])
+	}
+}
+
+func countMaskedEvents(events []*cloudwatchlogs.FilteredLogEvent) int {
+	n := 0
+	for _, e := range events {
+		if maskedValuePattern.MatchString(aws.StringValue(e.Message)) {
+			n++
+		}
+	}
+	return n
+}
@@ -13,9 +13,11 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ecs"
 
 	"github.com/grafana/grafana-plugin-model/go/datasource"
 	"github.com/grafana/grafana/pkg/components/simplejson"
+	hclog "github.com/hashicorp/go-hclog"
 	plugin "github.com/hashicorp/go-plugin"
 )
 
@@ -37,6 +39,84 @@ type Target struct {
 	TimestampColumn         string
 	ValueColumn             string
 	StartFromHead           bool
+	Engine                  string
+	IntervalMs              int64
+	TopN                    int
+	LevelField              string
+
+	ExcludeLogStreamNames      []string
+	ExcludeLogStreamNamePrefix string
+	LogStreamNamePattern       string
+	TimeShift                  string
+	TimeFrom                   string
+	TimeTo                     string
+	LastN                      int64
+	Variables                  map[string]string
+	UnescapeJsonMessage        bool
+	StripAnsi                  bool
+	Multiline                  bool
+	MultilineStartPattern      string
+	SampleMode                 string
+	SampleRate                 float64
+	LambdaFunction             string
+	LambdaQualifier            string
+	Preset                     string
+	PresetGroupBy              string
+	PresetColumns              []string
+	ChunkPages                 int
+	PivotField                 string
+	Percentiles                []float64
+	NodeField                  string
+	CalleeField                string
+	SpanField                  string
+	ParentSpanField            string
+	AlertSampleLines           int
+	CorrelationFields          bool
+	Template                   string
+	Rate                       bool
+	Smoothing                  string
+	SmoothingWindow            int
+	DashboardId                int64
+	PanelId                    int64
+
+	From           int64 `json:"-"`
+	To             int64 `json:"-"`
+	shiftMs        int64
+	lambdaVersions []string
+	alerting       bool
+	dataProtection bool
+	eventLogGroups map[string]string
+}
+
+// queryStats is reported in the result meta, so that slow panels can be debugged from the query inspector.
+type queryStats struct {
+	Engine             string `json:",omitempty"`
+	Pages              int
+	Events             int
+	SearchedLogStreams int
+	ApiTimeMs          int64
+	MessageBytes       int64   `json:",omitempty"`
+	BytesScanned       float64 `json:",omitempty"`
+	EstimatedCost      float64 `json:",omitempty"`
+	MatchedEvents      int64   `json:",omitempty"`
+	Throttles          int     `json:",omitempty"`
+	Retries            int     `json:",omitempty"`
+	Truncated          string  `json:",omitempty"`
+	PartialError       string  `json:",omitempty"`
+}
+
+type resultMeta struct {
+	Stats       *queryStats `json:",omitempty"`
+	QueryString string      `json:",omitempty"`
+	Warnings    []string    `json:",omitempty"`
+	NextToken   string      `json:",omitempty"`
+	Notice      string      `json:",omitempty"`
+	SampleLines []string    `json:",omitempty"`
+	ExploreUrl  string      `json:",omitempty"`
+	ConsoleUrl  string      `json:",omitempty"`
+
+	CorrelationFields []string `json:",omitempty"`
+	DataProtection    bool     `json:",omitempty"`
 }
 
 var (
@@ -52,40 +132,121 @@ func (t *AwsCloudWatchLogsDatasource) Query(ctx context.Context, tsdbReq *dataso
 	if err != nil {
 		return nil, err
 	}
+	logger := t.newQueryLogger(tsdbReq.Datasource)
 	if modelJson.Get("queryType").MustString() == "metricFindQuery" {
 		response, err := t.metricFindQuery(ctx, tsdbReq, modelJson)
 		if err != nil {
+			logger.Error("metricFindQuery failed", "subtype", modelJson.Get("subtype").MustString(), "error", err)
+			err = mapAwsError(err, modelJson.Get("region").MustString(), modelJson.Get("logGroupName").MustString())
 			return &datasource.DatasourceResponse{
-				Results: []*datasource.QueryResult{
-					&datasource.QueryResult{
-						RefId: "metricFindQuery",
-						Error: err.Error(),
-					},
-				},
+				Results: []*datasource.QueryResult{errorResult("metricFindQuery", err)},
+			}, nil
+		}
+		return response, nil
+	}
+	queryType := modelJson.Get("queryType").MustString()
+	runResourceQuery := func() (*datasource.DatasourceResponse, error) {
+		response, err := t.resourceQuery(ctx, tsdbReq, queryType, modelJson)
+		if err != nil {
+			logger.Error("resource query failed", "queryType", queryType, "error", err)
+			err = mapAwsError(err, modelJson.Get("region").MustString(), modelJson.Get("logGroupName").MustString())
+			return &datasource.DatasourceResponse{
+				Results: []*datasource.QueryResult{errorResult(queryType, err)},
 			}, nil
 		}
 		return response, nil
 	}
-	if modelJson.Get("queryType").MustString() == "annotationQuery" {
+	if resourceQueries[queryType] != nil && !eventResourceQueries[queryType] {
+		return runResourceQuery()
+	}
+
+	quota := quotaForOrg(tsdbReq.Datasource.OrgId)
+	if dsInfo, err := t.getDsInfo(tsdbReq.Datasource, ""); err == nil {
+		quota = quota.withDeadline(queryDeadline(ctx, dsInfo))
+		// a query which can not be audited is not run
+		if _, err := dsInfo.auditRegion(); err != nil {
+			logger.Error("query rejected", "error", err)
+			return &datasource.DatasourceResponse{
+				Results: []*datasource.QueryResult{errorResult(tsdbReq.Queries[0].RefId, err)},
+			}, nil
+		}
+	}
+	if err := acquireQuerySlot(tsdbReq.Datasource.OrgId, quota); err != nil {
+		logger.Warn("query rejected", "orgId", tsdbReq.Datasource.OrgId, "error", err)
+		return &datasource.DatasourceResponse{
+			Results: []*datasource.QueryResult{
+				&datasource.QueryResult{
+					RefId: tsdbReq.Queries[0].RefId,
+					Error: err.Error(),
+				},
+			},
+		}, nil
+	}
+	defer releaseQuerySlot(tsdbReq.Datasource.OrgId)
+
+	waitCtx, cancel := quota.context()
+	err = scheduler.acquire(waitCtx, schedulerKey(tsdbReq.Datasource.OrgId, tsdbReq.Datasource.Id))
+	cancel()
+	if err != nil {
+		logger.Warn("query was not scheduled", "orgId", tsdbReq.Datasource.OrgId, "error", err)
+		return &datasource.DatasourceResponse{
+			Results: []*datasource.QueryResult{
+				&datasource.QueryResult{
+					RefId: tsdbReq.Queries[0].RefId,
+					Error: err.Error(),
+				},
+			},
+		}, nil
+	}
+	defer scheduler.release()
+
+	if resourceQueries[queryType] != nil {
+		return runResourceQuery()
+	}
+
+	if queryType == "annotationQuery" {
 		target := Target{}
 		if err := json.Unmarshal([]byte(tsdbReq.Queries[0].ModelJson), &target); err != nil {
 			return nil, err
 		}
-		fromRaw, err := strconv.ParseInt(tsdbReq.TimeRange.FromRaw, 10, 64)
+		fromRaw, toRaw, err := parseTimeRange(tsdbReq.TimeRange, time.Now())
 		if err != nil {
 			return nil, err
 		}
-		toRaw, err := strconv.ParseInt(tsdbReq.TimeRange.ToRaw, 10, 64)
+		target.Input.StartTime = aws.Int64(fromRaw)
+		target.Input.EndTime = aws.Int64(toRaw)
+		dsInfo, err := t.getDsInfo(tsdbReq.Datasource, "")
 		if err != nil {
 			return nil, err
 		}
-		target.Input.StartTime = aws.Int64(fromRaw)
-		target.Input.EndTime = aws.Int64(toRaw)
+		if err := target.resolveRegion(dsInfo.DefaultRegion); err != nil {
+			return nil, err
+		}
+		target.applyDefaultLogGroups(dsInfo.DefaultLogGroupName)
 
-		resp, err := t.getLogEvent(tsdbReq, target.Region, &target.Input, true)
+		t.auditQuery(tsdbReq.Datasource, &target, fromRaw, toRaw)
+		alog := logger.With("refId", target.RefId, "region", target.Region, "logGroup", aws.StringValue(target.Input.LogGroupName))
+		svc, err := t.getClient(tsdbReq.Datasource, target.Region)
 		if err != nil {
+			alog.Error("failed to create client", "error", err)
+			return nil, err
+		}
+		regionKey := regionCircuitKey(tsdbReq.Datasource.Id, target.Region)
+		logGroupKey := logGroupCircuitKey(tsdbReq.Datasource.Id, target.Region, aws.StringValue(target.Input.LogGroupName))
+		if err := checkCircuit(regionKey, logGroupKey); err != nil {
+			alog.Warn("query short-circuited", "error", err)
 			return nil, err
 		}
+		includeStream, err := target.logStreamFilter()
+		if err != nil {
+			return nil, err
+		}
+		resp, _, err := t.getLogEvent(svc, &target.Input, true, quota, includeStream, nil)
+		recordCircuitResult(regionKey, logGroupKey, err)
+		if err != nil {
+			alog.Error("annotationQuery failed", "error", err)
+			return nil, mapAwsError(err, target.Region, aws.StringValue(target.Input.LogGroupName))
+		}
 
 		resultJson, err := json.Marshal(resp)
 		if err != nil {
@@ -103,21 +264,17 @@ func (t *AwsCloudWatchLogsDatasource) Query(ctx context.Context, tsdbReq *dataso
 
 	includeInsightsQuery := false
 	for _, query := range tsdbReq.Queries {
-		target := Target{}
-		if err := json.Unmarshal([]byte(query.ModelJson), &target); err != nil {
+		target, err := parseTarget(query.ModelJson)
+		if err != nil {
 			return nil, err
 		}
 		includeInsightsQuery = includeInsightsQuery || target.UseInsights
 	}
 	if !includeInsightsQuery {
-		response, err := t.handleQuery(tsdbReq)
+		response, err := t.handleQuery(tsdbReq, logger, quota)
 		if err != nil {
 			return &datasource.DatasourceResponse{
-				Results: []*datasource.QueryResult{
-					&datasource.QueryResult{
-						Error: err.Error(),
-					},
-				},
+				Results: []*datasource.QueryResult{errorResult(tsdbReq.Queries[0].RefId, err)},
 			}, nil
 		}
 		return response, nil
@@ -125,71 +282,383 @@ func (t *AwsCloudWatchLogsDatasource) Query(ctx context.Context, tsdbReq *dataso
 		if len(tsdbReq.Queries) != 1 {
 			return nil, fmt.Errorf("invalid insights query, it should be single")
 		}
-		response, err := t.handleInsightsQuery(tsdbReq, tsdbReq.Queries[0])
+		response, err := t.handleInsightsQuery(tsdbReq, tsdbReq.Queries[0], logger, quota)
 		if err != nil {
 			return &datasource.DatasourceResponse{
-				Results: []*datasource.QueryResult{
-					&datasource.QueryResult{
-						Error: err.Error(),
-					},
-				},
+				Results: []*datasource.QueryResult{errorResult(tsdbReq.Queries[0].RefId, err)},
 			}, nil
 		}
 		return response, nil
 	}
 }
 
-func (t *AwsCloudWatchLogsDatasource) handleQuery(tsdbReq *datasource.DatasourceRequest) (*datasource.DatasourceResponse, error) {
+func (t *AwsCloudWatchLogsDatasource) handleQuery(tsdbReq *datasource.DatasourceRequest, logger hclog.Logger, quota orgQuota) (*datasource.DatasourceResponse, error) {
 	response := &datasource.DatasourceResponse{}
 
-	fromRaw, err := strconv.ParseInt(tsdbReq.TimeRange.FromRaw, 10, 64)
+	dsInfo, err := t.getDsInfo(tsdbReq.Datasource, "")
 	if err != nil {
 		return nil, err
 	}
-	toRaw, err := strconv.ParseInt(tsdbReq.TimeRange.ToRaw, 10, 64)
+	fromRaw, toRaw, err := parseTimeRange(tsdbReq.TimeRange, time.Now())
 	if err != nil {
 		return nil, err
 	}
 	targets := make([]Target, 0)
 	for _, query := range tsdbReq.Queries {
-		target := Target{}
-		if err := json.Unmarshal([]byte(query.ModelJson), &target); err != nil {
+		target, err := parseTarget(query.ModelJson)
+		if err != nil {
 			return nil, err
 		}
-		target.Input.StartTime = aws.Int64(fromRaw)
-		target.Input.EndTime = aws.Int64(toRaw)
+		if err := t.prepareTarget(tsdbReq, dsInfo, &target, fromRaw, toRaw); err != nil {
+			return nil, err
+		}
+		target.IntervalMs = query.IntervalMs
 		targets = append(targets, target)
 	}
 
+	clients := t.newClientSet(tsdbReq.Datasource)
+	fetched := make(map[string]*fetchResult)
 	for _, target := range targets {
-		resp, err := t.getLogEvent(tsdbReq, target.Region, &target.Input, target.StartFromHead)
+		tlog := logger.With("refId", target.RefId, "region", target.Region, "logGroup", aws.StringValue(target.Input.LogGroupName))
+		svc, err := clients.get(target.Region)
+		if err != nil {
+			tlog.Error("failed to create client", "error", err)
+			return nil, err
+		}
+		tlog.Debug("executing query", "filterPattern", aws.StringValue(target.Input.FilterPattern))
+		includeStream, err := target.logStreamFilter()
+		if err != nil {
+			return nil, err
+		}
+		sample, err := target.newSampler()
+		if err != nil {
+			return nil, err
+		}
+		t.auditQuery(tsdbReq.Datasource, &target, target.From, target.To)
+		regionKey := regionCircuitKey(tsdbReq.Datasource.Id, target.Region)
+		logGroupKey := logGroupCircuitKey(tsdbReq.Datasource.Id, target.Region, aws.StringValue(target.Input.LogGroupName))
+		if err := checkCircuit(regionKey, logGroupKey); err != nil {
+			tlog.Warn("query short-circuited", "error", err)
+			return nil, err
+		}
+		retentionDays, retentionWarning := int64(0), ""
+		if !target.hasMultipleLogGroups() {
+			if days := logGroupRetentionDays(svc, tsdbReq.Datasource.Id, target.Region, aws.StringValue(target.Input.LogGroupName)); target.clampToRetention(days, time.Now()) {
+				tlog.Debug("time range truncated to the retention of the log group", "retentionInDays", days)
+				retentionDays = days
+			} else {
+				retentionWarning = target.retentionExpiryWarning(days, dsInfo.retentionWarning(), time.Now())
+			}
+		}
+		if queryString, ok := selectInsightsQuery(dsInfo, &target, target.From, target.To); ok {
+			tlog.Debug("auto engine selected insights", "queryString", queryString)
+			r, err := t.handleAutoInsightsTarget(svc, dsInfo, &target, queryString, target.From, target.To, quota)
+			recordCircuitResult(regionKey, logGroupKey, err)
+			if err != nil {
+				tlog.Error("query failed", "error", err)
+				return nil, mapAwsError(err, target.Region, aws.StringValue(target.Input.LogGroupName))
+			}
+			response.Results = append(response.Results, r)
+			continue
+		}
+		key, err := target.fetchKey()
+		if err != nil {
+			return nil, err
+		}
+		cacheKey, cacheable := target.cacheKey(tsdbReq.Datasource.Id, key+dsInfo.redactionKey())
+		f, ok := fetched[key]
+		if ok {
+			tlog.Debug("reusing events of an identical target")
+		} else if cached, hit := eventCache.get(cacheKey); cacheable && hit {
+			tlog.Debug("reusing cached events")
+			f = cached
+			fetched[key] = f
+		} else {
+			started := time.Now()
+			calls := clients.calls.snapshot()
+			f = &fetchResult{sample: sample}
+			if target.hasMultipleLogGroups() {
+				f.resp, f.stats, err = t.getLogEventsFromGroups(svc, &target, quota.withPageBudget(dsInfo.ScanBudgetPages), includeStream, sample)
+			} else if target.LastN > 0 {
+				f.resp, f.stats, err = t.getLastEvents(svc, &target.Input, target.LastN, quota.withPageBudget(dsInfo.ScanBudgetPages), includeStream)
+			} else {
+				f.resp, f.stats, err = t.getLogEvent(svc, &target.Input, target.StartFromHead, quota.withPageBudget(dsInfo.ScanBudgetPages).withChunkPages(target.chunkPages()), includeStream, sample)
+			}
+			recordCircuitResult(regionKey, logGroupKey, err)
+			if err != nil {
+				tlog.Error("query failed", "error", err)
+				return nil, mapAwsError(err, target.Region, aws.StringValue(target.Input.LogGroupName))
+			}
+			clients.calls.since(calls, f.stats)
+			observeQuery(f.stats, started)
+			tlog.Debug("query finished", "pages", f.stats.Pages, "events", f.stats.Events, "apiTimeMs", f.stats.ApiTimeMs)
+			fetched[key] = f
+			if cacheable {
+				eventCache.put(cacheKey, f)
+			}
+		}
+		resp, stats := f.resp, f.stats
+		meta := resultMeta{Stats: stats, NextToken: aws.StringValue(resp.NextToken)}
+		if stats.Truncated != "" {
+			meta.Warnings = append(meta.Warnings, "results are truncated: "+stats.Truncated)
+		}
+		if stats.Throttles > 0 {
+			meta.Warnings = append(meta.Warnings, fmt.Sprintf("%d API calls were throttled and %d retries were made, which slowed down the query", stats.Throttles, stats.Retries))
+		}
+		if stats.MatchedEvents > 0 && target.Format != "stat" {
+			meta.Warnings = append(meta.Warnings, fmt.Sprintf("results are sampled: %d of %d matched events", stats.Events, stats.MatchedEvents))
+		}
+		if stats.PartialError != "" {
+			meta.Warnings = append(meta.Warnings, fmt.Sprintf("partial results, pagination failed after %d pages: %s", stats.Pages, stats.PartialError))
+			tlog.Warn("returning partial results", "pages", stats.Pages, "error", stats.PartialError)
+		}
+		if w := longRangeWarning(resp, stats, target.From, target.To, dsInfo.longRangeThreshold()); w != "" && target.LastN == 0 {
+			meta.Warnings = append(meta.Warnings, w)
+		}
+		if retentionWarning != "" {
+			meta.Warnings = append(meta.Warnings, retentionWarning)
+		}
+		if retentionDays > 0 {
+			meta.Notice = fmt.Sprintf("range truncated: retention is %d days", retentionDays)
+		}
+		if len(resp.Events) == 0 && stats.MatchedEvents == 0 && stats.PartialError == "" {
+			notice := fmt.Sprintf("0 events matched, %d log streams searched", stats.SearchedLogStreams)
+			if meta.Notice != "" {
+				notice = meta.Notice + ", " + notice
+			}
+			meta.Notice = notice
+		}
+		if n := target.sampleLines(); n > 0 {
+			meta.SampleLines = sampleMessages(resp.Events, n)
+		}
+		if !target.hasMultipleLogGroups() {
+			if meta.ExploreUrl, err = target.exploreUrl(tsdbReq.Datasource); err != nil {
+				return nil, err
+			}
+			meta.ConsoleUrl = target.consoleUrl()
+		}
+		if target.extractsCorrelationFields() {
+			meta.CorrelationFields = correlationFieldNames()
+		}
+		if len(resp.Events) > 0 && !target.hasMultipleLogGroups() && hasDataProtectionPolicy(svc, tsdbReq.Datasource.Id, target.Region, aws.StringValue(target.Input.LogGroupName)) {
+			target.dataProtection = true
+			meta.DataProtection = true
+			if n := countMaskedEvents(resp.Events); n > 0 {
+				meta.Warnings = append(meta.Warnings, fmt.Sprintf("%d events have values masked by the data protection policy of the log group, the datasource role needs logs:Unmask to read them", n))
+			}
+		}
+		metaJson, err := json.Marshal(meta)
 		if err != nil {
 			return nil, err
 		}
 
-		switch target.Format {
-		case "timeserie":
-			return nil, fmt.Errorf("not supported")
-		case "table":
-			r, err := parseTableResponse(resp, target.RefId)
+		var r *datasource.QueryResult
+		if target.Format == "stat" {
+			r = &datasource.QueryResult{RefId: target.RefId}
+			if f.sample != nil {
+				r.Series = append(r.Series, f.sample.totalSeries(target.To))
+			} else {
+				r.Series = append(r.Series, &datasource.TimeSeries{Name: "events", Points: []*datasource.Point{{Timestamp: target.To, Value: float64(len(resp.Events))}}})
+			}
+		} else {
+			r, err = formatResult(&target, resp)
 			if err != nil {
 				return nil, err
 			}
-			response.Results = append(response.Results, r)
+			if f.sample != nil {
+				r.Series = append(r.Series, f.sample.countSeries())
+			}
+		}
+		if meta.Notice != "" && len(r.Series) == 0 && len(r.Tables) == 0 {
+			// an empty table tells the panel the query succeeded
+			empty, _ := parseTableResponse(resp, target.RefId)
+			r.Tables = empty.Tables
 		}
+		if target.Smoothing != "" && target.ratable() {
+			if err := smoothSeries(r.Series, target.IntervalMs, target.Smoothing, target.SmoothingWindow); err != nil {
+				return nil, err
+			}
+		}
+		if target.Rate && target.ratable() {
+			rateSeries(r.Series, target.IntervalMs)
+		}
+		unshiftSeries(r.Series, target.shiftMs)
+		r.MetaJson = string(metaJson)
+		response.Results = append(response.Results, r)
 	}
 
 	return response, nil
 }
 
-func (t *AwsCloudWatchLogsDatasource) handleInsightsQuery(tsdbReq *datasource.DatasourceRequest, query *datasource.Query) (*datasource.DatasourceResponse, error) {
+// prepareTarget resolves the time range, region and Lambda function of a FilterLogEvents target.
+func (t *AwsCloudWatchLogsDatasource) prepareTarget(tsdbReq *datasource.DatasourceRequest, dsInfo *DatasourceInfo, target *Target, fromRaw int64, toRaw int64) error {
+	if err := target.applyTimeShift(fromRaw, toRaw); err != nil {
+		return err
+	}
+	if err := target.resolveRegion(dsInfo.DefaultRegion); err != nil {
+		return err
+	}
+	target.applyDefaultLogGroups(dsInfo.DefaultLogGroupName)
+	if err := target.applyQueryTemplate(dsInfo); err != nil {
+		return err
+	}
+	if err := t.applyLambdaFunction(tsdbReq.Datasource, target); err != nil {
+		return err
+	}
+	target.Input.StartTime = aws.Int64(target.From)
+	target.Input.EndTime = aws.Int64(target.To)
+	return nil
+}
+
+// applyDefaultLogGroups queries the default log groups of the datasource, a comma separated list, when the target has none.
+func (target *Target) applyDefaultLogGroups(defaultLogGroupName string) {
+	if defaultLogGroupName == "" {
+		return
+	}
+	if !target.UseInsights {
+		if aws.StringValue(target.Input.LogGroupName) == "" {
+			target.Input.LogGroupName = aws.String(defaultLogGroupName)
+		}
+		return
+	}
+	input := &target.InputInsightsStartQuery
+	if aws.StringValue(input.LogGroupName) != "" || len(input.LogGroupNames) > 0 {
+		return
+	}
+	if names := splitList(defaultLogGroupName); len(names) > 1 {
+		input.LogGroupName = nil
+		input.LogGroupNames = aws.StringSlice(names)
+	} else if len(names) == 1 {
+		input.LogGroupName = aws.String(names[0])
+	}
+}
+
+type fetchResult struct {
+	resp   *cloudwatchlogs.FilterLogEventsOutput
+	stats  *queryStats
+	sample *sampler
+}
+
+// fetchKey identifies the targets of a request which fetch the same events, so that the API calls are made only once.
+func (target *Target) fetchKey() (string, error) {
+	key, err := json.Marshal(struct {
+		Region                     string
+		Input                      cloudwatchlogs.FilterLogEventsInput
+		StartFromHead              bool
+		LastN                      int64
+		ExcludeLogStreamNames      []string
+		ExcludeLogStreamNamePrefix string
+		LogStreamNamePattern       string
+		SampleMode                 string
+		SampleRate                 float64
+		LambdaVersions             []string
+		CountOnly                  bool
+		SampleLines                int
+	}{
+		target.Region,
+		target.Input,
+		target.StartFromHead,
+		target.LastN,
+		target.ExcludeLogStreamNames,
+		target.ExcludeLogStreamNamePrefix,
+		target.LogStreamNamePattern,
+		target.SampleMode,
+		target.SampleRate,
+		target.lambdaVersions,
+		target.Format == "stat",
+		target.sampleLines(),
+	})
+	return string(key), err
+}
+
+// chunkPages returns the pages fetched per request when the results are streamed to the panel in chunks.
+// Only table results can be appended to each other, so the other formats are fetched at once.
+func (target *Target) chunkPages() int {
+	if target.ChunkPages <= 0 || target.LastN > 0 || target.hasMultipleLogGroups() || target.SampleMode != "" {
+		return 0
+	}
+	if target.Format != "" && target.Format != "table" {
+		return 0
+	}
+	return target.ChunkPages
+}
+
+func formatResult(target *Target, resp *cloudwatchlogs.FilterLogEventsOutput) (*datasource.QueryResult, error) {
+	resp, err := target.transformMessages(resp)
+	if err != nil {
+		return nil, err
+	}
+	if target.Preset != "" {
+		if r, ok, err := formatPresetResponse(target, resp); ok {
+			return r, err
+		}
+	}
+	switch target.Format {
+	case "timeserie":
+		return nil, fmt.Errorf("not supported")
+	case "stream_summary":
+		return parseStreamSummaryResponse(resp, target.RefId)
+	case "top_streams":
+		return parseTopStreamsResponse(resp, target.RefId, target.IntervalMs, target.TopN)
+	case "stream_series":
+		return parseStreamSeriesResponse(resp, target.RefId, target.IntervalMs, target.LegendFormat)
+	case "level_counts":
+		return parseLevelCountsResponse(resp, target.RefId, target.IntervalMs, target.LevelField)
+	case "pivot":
+		keyFunc, err := target.eventKeyFunc(target.PivotField)
+		if err != nil {
+			return nil, err
+		}
+		return parsePivotResponse(resp, target.RefId, target.IntervalMs, keyFunc, target.TopN)
+	case "heatmap":
+		keyFunc, err := target.eventKeyFunc(target.PivotField)
+		if err != nil {
+			return nil, err
+		}
+		return parseHeatmapResponse(resp, target.RefId, target.From, target.To, target.IntervalMs, keyFunc, target.TopN)
+	case "distinct":
+		keyFunc, err := target.eventKeyFunc(target.PivotField)
+		if err != nil {
+			return nil, err
+		}
+		return parseDistinctResponse(resp, target.RefId, target.IntervalMs, target.PivotField, keyFunc)
+	case "node_graph":
+		return target.parseNodeGraphResponse(resp)
+	case "latest":
+		valueFunc, err := target.eventKeyFunc(target.ValueColumn)
+		if err != nil {
+			return nil, err
+		}
+		return parseLatestValueResponse(resp, target.RefId, target.ValueColumn, valueFunc)
+	case "percentiles":
+		valueFunc, err := target.eventKeyFunc(target.ValueColumn)
+		if err != nil {
+			return nil, err
+		}
+		return parsePercentilesResponse(resp, target.RefId, target.IntervalMs, target.ValueColumn, target.Percentiles, valueFunc)
+	default:
+		r, err := parseTableResponse(resp, target.RefId)
+		if err == nil && target.extractsCorrelationFields() {
+			addCorrelationColumns(r.Tables[0], resp.Events)
+		}
+		if err == nil && target.dataProtection {
+			addMaskedColumn(r.Tables[0], resp.Events)
+		}
+		if err == nil && target.eventLogGroups != nil {
+			addLogGroupColumn(r.Tables[0], resp.Events, target.eventLogGroups)
+		}
+		return r, err
+	}
+}
+
+func (t *AwsCloudWatchLogsDatasource) handleInsightsQuery(tsdbReq *datasource.DatasourceRequest, query *datasource.Query, logger hclog.Logger, quota orgQuota) (*datasource.DatasourceResponse, error) {
 	response := &datasource.DatasourceResponse{}
 
-	fromRaw, err := strconv.ParseInt(tsdbReq.TimeRange.FromRaw, 10, 64)
+	dsInfo, err := t.getDsInfo(tsdbReq.Datasource, "")
 	if err != nil {
 		return nil, err
 	}
-	toRaw, err := strconv.ParseInt(tsdbReq.TimeRange.ToRaw, 10, 64)
+	fromRaw, toRaw, err := parseTimeRange(tsdbReq.TimeRange, time.Now())
 	if err != nil {
 		return nil, err
 	}
@@ -197,20 +666,55 @@ func (t *AwsCloudWatchLogsDatasource) handleInsightsQuery(tsdbReq *datasource.Da
 	if err := json.Unmarshal([]byte(query.ModelJson), &target); err != nil {
 		return nil, err
 	}
-	target.InputInsightsStartQuery.StartTime = aws.Int64(fromRaw)
-	target.InputInsightsStartQuery.EndTime = aws.Int64(toRaw)
+	if err := target.applyTimeShift(fromRaw, toRaw); err != nil {
+		return nil, err
+	}
+	if err := target.resolveRegion(dsInfo.DefaultRegion); err != nil {
+		return nil, err
+	}
+	target.applyDefaultLogGroups(dsInfo.DefaultLogGroupName)
+	if err := t.applyLambdaFunction(tsdbReq.Datasource, &target); err != nil {
+		return nil, err
+	}
+	if len(target.lambdaVersions) > 0 {
+		// the filter comes first, as the commands of the query, e.g. stats, may drop @logStream
+		target.InputInsightsStartQuery.QueryString = aws.String(lambdaVersionsInsightsFilter(target.lambdaVersions) + " | " + aws.StringValue(target.InputInsightsStartQuery.QueryString))
+	}
+	target.InputInsightsStartQuery.StartTime = aws.Int64(target.From)
+	target.InputInsightsStartQuery.EndTime = aws.Int64(target.To)
+	maxEvents := quota.maxEvents()
+	if target.InputInsightsStartQuery.Limit == nil || *target.InputInsightsStartQuery.Limit > maxEvents {
+		target.InputInsightsStartQuery.Limit = aws.Int64(maxEvents)
+	}
+
+	logGroup := aws.StringValue(target.InputInsightsStartQuery.LogGroupName)
+	if target.InputInsightsStartQuery.LogGroupNames != nil {
+		logGroup = strings.Join(aws.StringValueSlice(target.InputInsightsStartQuery.LogGroupNames), ",")
+	}
+	logger = logger.With("refId", target.RefId, "region", target.Region, "logGroup", logGroup)
 
 	svc, err := t.getClient(tsdbReq.Datasource, target.Region)
 	if err != nil {
+		logger.Error("failed to create client", "error", err)
 		return nil, err
 	}
 
 	// start query
 	if target.QueryId == "" {
+		regionKey := regionCircuitKey(tsdbReq.Datasource.Id, target.Region)
+		logGroupKey := logGroupCircuitKey(tsdbReq.Datasource.Id, target.Region, logGroup)
+		if err := checkCircuit(regionKey, logGroupKey); err != nil {
+			logger.Warn("query short-circuited", "error", err)
+			return nil, err
+		}
+		t.auditQuery(tsdbReq.Datasource, &target, target.From, target.To)
 		sresp, err := svc.StartQuery(&target.InputInsightsStartQuery)
+		recordCircuitResult(regionKey, logGroupKey, err)
 		if err != nil {
-			return nil, err
+			logger.Error("failed to start insights query", "error", err)
+			return nil, mapAwsError(err, target.Region, logGroup)
 		}
+		logger.Debug("insights query started", "insightsQueryId", *sresp.QueryId)
 
 		queryIdJson, err := json.Marshal(map[string]string{"QueryId": *sresp.QueryId})
 		if err != nil {
@@ -226,26 +730,26 @@ func (t *AwsCloudWatchLogsDatasource) handleInsightsQuery(tsdbReq *datasource.Da
 		}, nil
 	}
 
-	var dresp *cloudwatchlogs.DescribeQueriesOutput
-	if target.InputInsightsStartQuery.LogGroupNames != nil {
-		dresp, err = svc.DescribeQueries(&cloudwatchlogs.DescribeQueriesInput{LogGroupName: target.InputInsightsStartQuery.LogGroupNames[0]})
-	} else {
-		dresp, err = svc.DescribeQueries(&cloudwatchlogs.DescribeQueriesInput{LogGroupName: target.InputInsightsStartQuery.LogGroupName})
-	}
+	// the status is read from GetQueryResults rather than DescribeQueries, which only takes log group names, not ARNs
+	gresp, err := svc.GetQueryResults(&cloudwatchlogs.GetQueryResultsInput{QueryId: aws.String(target.QueryId)})
 	if err != nil {
-		return nil, err
+		logger.Error("failed to get insights query results", "insightsQueryId", target.QueryId, "error", err)
+		return nil, mapAwsError(err, target.Region, logGroup)
 	}
-	queryIndex := -1
-	for i, query := range dresp.Queries {
-		if *query.QueryId == target.QueryId {
-			queryIndex = i
+	status := aws.StringValue(gresp.Status)
+	budgetWarning := ""
+	if status == "Running" {
+		// return the rows found so far, so that the panel is updated while the query runs
+		if w := scanBudgetExceeded(gresp.Statistics, dsInfo.ScanBudgetGB); w != "" {
+			// stop scanning and return what has been found so far
+			logger.Warn("stopping insights query", "insightsQueryId", target.QueryId, "reason", w)
+			svc.StopQuery(&cloudwatchlogs.StopQueryInput{QueryId: aws.String(target.QueryId)})
+			budgetWarning = w
+			status = "Complete"
 		}
 	}
-	if queryIndex == -1 {
-		return nil, fmt.Errorf("%s is not found", target.QueryId)
-	}
-	if *dresp.Queries[queryIndex].Status != "Complete" {
-		queryIdJson, err := json.Marshal(map[string]string{"QueryId": target.QueryId, "Status": *dresp.Queries[queryIndex].Status})
+	if status != "Complete" && status != "Running" {
+		queryIdJson, err := json.Marshal(map[string]string{"QueryId": target.QueryId, "Status": status})
 		if err != nil {
 			return nil, err
 		}
@@ -259,20 +763,30 @@ func (t *AwsCloudWatchLogsDatasource) handleInsightsQuery(tsdbReq *datasource.Da
 		}, nil
 	}
 
-	gresp, err := svc.GetQueryResults(&cloudwatchlogs.GetQueryResultsInput{QueryId: aws.String(target.QueryId)})
-	if err != nil {
+	if status == "Complete" && budgetWarning == "" {
+		_, err = svc.StopQuery(&cloudwatchlogs.StopQueryInput{QueryId: aws.String(target.QueryId)})
+		if err != nil {
+			// ignore error
+		}
+	}
+	logger.Debug("insights query results", "insightsQueryId", target.QueryId, "status", status, "results", len(gresp.Results))
+
+	queryMeta := map[string]string{"QueryId": target.QueryId, "Status": status}
+	if queryMeta["ExploreUrl"], err = target.exploreUrl(tsdbReq.Datasource); err != nil {
 		return nil, err
 	}
-	if *gresp.Status != "Complete" {
-		return nil, fmt.Errorf("unexpected status")
+	queryMeta["ConsoleUrl"] = target.consoleUrl()
+	if budgetWarning != "" {
+		queryMeta["Warning"] = budgetWarning
 	}
-
-	_, err = svc.StopQuery(&cloudwatchlogs.StopQueryInput{QueryId: aws.String(target.QueryId)})
-	if err != nil {
-		// ignore error
+	if gresp.Statistics != nil {
+		queryMeta["BytesScanned"] = strconv.FormatFloat(aws.Float64Value(gresp.Statistics.BytesScanned), 'f', 0, 64)
+		queryMeta["RecordsScanned"] = strconv.FormatFloat(aws.Float64Value(gresp.Statistics.RecordsScanned), 'f', 0, 64)
+		queryMeta["RecordsMatched"] = strconv.FormatFloat(aws.Float64Value(gresp.Statistics.RecordsMatched), 'f', 0, 64)
+		cost := estimateInsightsCost(aws.Float64Value(gresp.Statistics.BytesScanned), dsInfo.insightsPricePerGB())
+		queryMeta["EstimatedCost"] = strconv.FormatFloat(cost, 'f', 6, 64)
 	}
-
-	queryIdJson, err := json.Marshal(map[string]string{"QueryId": target.QueryId, "Status": *gresp.Status})
+	queryIdJson, err := json.Marshal(queryMeta)
 	if err != nil {
 		return nil, err
 	}
@@ -334,6 +848,7 @@ func (t *AwsCloudWatchLogsDatasource) handleInsightsQuery(tsdbReq *datasource.Da
 		for _, ss := range series {
 			s = append(s, ss)
 		}
+		unshiftSeries(s, target.shiftMs)
 
 		response.Results = append(response.Results, &datasource.QueryResult{
 			RefId:    target.RefId,
@@ -363,24 +878,116 @@ func (t *AwsCloudWatchLogsDatasource) handleInsightsQuery(tsdbReq *datasource.Da
 	return response, nil
 }
 
-func (t *AwsCloudWatchLogsDatasource) getLogEvent(tsdbReq *datasource.DatasourceRequest, region string, input *cloudwatchlogs.FilterLogEventsInput, startFromHead bool) (*cloudwatchlogs.FilterLogEventsOutput, error) {
-	svc, err := t.getClient(tsdbReq.Datasource, region)
-	if err != nil {
-		return nil, err
-	}
-
+func (t *AwsCloudWatchLogsDatasource) getLogEvent(svc *cloudwatchlogs.CloudWatchLogs, input *cloudwatchlogs.FilterLogEventsInput, startFromHead bool, quota orgQuota, includeStream func(name string) bool, sample *sampler) (*cloudwatchlogs.FilterLogEventsOutput, *queryStats, error) {
+	var err error
 	resp := &cloudwatchlogs.FilterLogEventsOutput{}
-	if *input.FilterPattern != "" || len(input.LogStreamNames) != 1 {
-		err = svc.FilterLogEventsPages(input,
+	stats := &queryStats{Engine: "filter"}
+	if len(input.LogStreamNames) > 0 {
+		requested := input.LogStreamNames
+		filtered := filterLogStreamNames(requested, includeStream)
+		if len(filtered) == 0 {
+			return resp, stats, nil // every requested stream is excluded
+		}
+		if len(filtered) != len(requested) {
+			i := *input
+			i.LogStreamNames = filtered
+			input = &i
+		}
+	}
+	cursor := decodeCursor(aws.StringValue(input.NextToken))
+	if input.NextToken != nil {
+		i := *input
+		i.NextToken = encodeCursor(cursor.Token, 0)
+		input = &i
+	}
+	pageToken, skip := cursor.Token, cursor.Skip
+	searchedLogStreams := make(map[string]bool)
+	maxEvents := quota.maxEvents()
+	var heldBytes int64
+	hold := func(e *cloudwatchlogs.FilteredLogEvent) {
+		size := eventMemorySize(e)
+		heldBytes += size
+		quota.budget.hold(size)
+	}
+	// the events and memory of the fetches sharing the budget of the quota are counted against the limits, e.g. of every log group of a target
+	heldEvents := func() int64 {
+		if quota.budget != nil {
+			return quota.budget.heldEvents()
+		}
+		return int64(len(resp.Events))
+	}
+	heldMemory := func() int64 {
+		if quota.budget != nil {
+			return quota.budget.heldBytes()
+		}
+		return heldBytes
+	}
+	done := func(lastPage bool) bool {
+		if lastPage {
+			return true
+		}
+		if globalMaxMemory > 0 && heldMemory() >= globalMaxMemory {
+			stats.Truncated = fmt.Sprintf("the memory limit of %d MB per response was reached", globalMaxMemory>>20)
+			return true
+		}
+		if !sample.bounded() && heldEvents() >= maxEvents {
+			stats.Truncated = fmt.Sprintf("the limit of %d events per response was reached", maxEvents)
+			return true
+		}
+		if !sample.bounded() && input.Limit != nil && int64(len(resp.Events)) >= *input.Limit {
+			return true // should stop to next query
+		}
+		if quota.chunkPages > 0 && stats.Pages >= quota.chunkPages {
+			return true // the caller resumes from the next token
+		}
+		if quota.MaxPages > 0 && stats.Pages >= quota.MaxPages {
+			stats.Truncated = fmt.Sprintf("the limit of %d pages per query was reached", quota.MaxPages)
+			return true
+		}
+		if quota.nearDeadline() {
+			stats.Truncated = "the query deadline was near"
+			return true
+		}
+		return false
+	}
+	ctx, cancel := quota.context()
+	defer cancel()
+	apiStart := time.Now()
+	if aws.StringValue(input.FilterPattern) != "" || len(input.LogStreamNames) != 1 {
+		err = svc.FilterLogEventsPagesWithContext(ctx, input,
 			func(page *cloudwatchlogs.FilterLogEventsOutput, lastPage bool) bool {
-				resp.Events = append(resp.Events, page.Events...)
-				if len(resp.Events) > 10000 {
-					return false // safety limit
+				stats.Pages++
+				for _, s := range page.SearchedLogStreams {
+					searchedLogStreams[*s.LogStreamName] = true
+				}
+				for j, e := range page.Events {
+					if j < skip {
+						continue // returned by the previous response
+					}
+					if !sample.bounded() && heldEvents() >= maxEvents {
+						stats.Truncated = fmt.Sprintf("the limit of %d events per response was reached", maxEvents)
+						resp.NextToken = encodeCursor(pageToken, j)
+						return false
+					}
+					stats.MessageBytes += int64(len(aws.StringValue(e.Message)))
+					if includeStream != nil && !includeStream(aws.StringValue(e.LogStreamName)) {
+						continue
+					}
+					n := len(resp.Events)
+					resp.Events = sample.add(resp.Events, e)
+					if len(resp.Events) > n {
+						hold(e)
+					}
 				}
-				if int64(len(resp.Events)) >= *input.Limit {
-					return false // should stop to next query
+				skip = 0
+				if done(lastPage) {
+					if !lastPage {
+						resp.NextToken = page.NextToken
+					}
+					return false
 				}
-				return !lastPage
+				pageToken = aws.StringValue(page.NextToken)
+				return true
 			})
 	} else {
 		i := &cloudwatchlogs.GetLogEventsInput{
@@ -390,32 +997,102 @@ func (t *AwsCloudWatchLogsDatasource) getLogEvent(tsdbReq *datasource.Datasource
 			LogStreamName: input.LogStreamNames[0],
 			StartFromHead: aws.Bool(startFromHead),
 			Limit:         input.Limit,
+			NextToken:     input.NextToken,
 		}
-		err = svc.GetLogEventsPages(i,
+		searchedLogStreams[*input.LogStreamNames[0]] = true
+		err = svc.GetLogEventsPagesWithContext(ctx, i,
 			func(page *cloudwatchlogs.GetLogEventsOutput, lastPage bool) bool {
-				for _, e := range page.Events {
+				stats.Pages++
+				for j, e := range page.Events {
+					if j < skip {
+						continue
+					}
+					if !sample.bounded() && heldEvents() >= maxEvents {
+						stats.Truncated = fmt.Sprintf("the limit of %d events per response was reached", maxEvents)
+						resp.NextToken = encodeCursor(pageToken, j)
+						return false
+					}
 					fe := &cloudwatchlogs.FilteredLogEvent{
 						LogStreamName: input.LogStreamNames[0],
 						IngestionTime: e.IngestionTime,
 						Message:       e.Message,
 						Timestamp:     e.Timestamp,
 					}
-					resp.Events = append(resp.Events, fe)
+					stats.MessageBytes += int64(len(aws.StringValue(e.Message)))
+					n := len(resp.Events)
+					resp.Events = sample.add(resp.Events, fe)
+					if len(resp.Events) > n {
+						hold(fe)
+					}
 				}
-				if len(resp.Events) > 10000 {
-					return false // safety limit
+				skip = 0
+				next := page.NextForwardToken
+				if !startFromHead {
+					next = page.NextBackwardToken
 				}
-				if int64(len(resp.Events)) >= *input.Limit {
-					return false // should stop to next query
+				if done(lastPage) {
+					if !lastPage {
+						resp.NextToken = next
+					}
+					return false
 				}
-				return !lastPage
+				pageToken = aws.StringValue(next)
+				return true
 			})
 	}
+	if err != nil && ctx.Err() != nil {
+		if len(resp.Events) == 0 {
+			return nil, nil, fmt.Errorf("no event was found before the query deadline, narrow the time range or the log streams")
+		}
+		// the page in progress was cut by the deadline, the next response resumes from it
+		stats.Truncated = "the query deadline was reached"
+		resp.NextToken = encodeCursor(pageToken, skip)
+		err = nil
+	}
 	if err != nil {
-		return nil, err
+		if len(resp.Events) == 0 {
+			return nil, nil, err
+		}
+		// keep the events collected before the failure instead of discarding them
+		stats.PartialError = err.Error()
+	}
+	if int64(len(resp.Events)) > maxEvents {
+		resp.Events = resp.Events[:maxEvents]
+		stats.Truncated = fmt.Sprintf("the limit of %d events per response was reached", maxEvents)
+	}
+	stats.ApiTimeMs = time.Since(apiStart).Nanoseconds() / int64(time.Millisecond)
+	stats.Events = len(resp.Events)
+	stats.SearchedLogStreams = len(searchedLogStreams)
+	if sample != nil {
+		sample.finish(resp.Events)
+		stats.MatchedEvents = sample.matched
+	}
+
+	return resp, stats, nil
+}
+
+// longRangeWarning suggests Insights when a FilterLogEvents query spans more than threshold.
+// When the results are incomplete, the page count is extrapolated from the part of the range covered so far.
+func longRangeWarning(resp *cloudwatchlogs.FilterLogEventsOutput, stats *queryStats, from int64, to int64, threshold time.Duration) string {
+	span := time.Duration(to-from) * time.Millisecond
+	if span <= threshold {
+		return ""
+	}
+
+	estimatedPages := stats.Pages
+	if stats.Truncated != "" || stats.PartialError != "" {
+		var last int64
+		for _, e := range resp.Events {
+			if *e.Timestamp > last {
+				last = *e.Timestamp
+			}
+		}
+		if last > from {
+			estimatedPages = int(float64(stats.Pages) * float64(to-from) / float64(last-from))
+		}
 	}
 
-	return resp, nil
+	return fmt.Sprintf("the query spans %s and needs about %d FilterLogEvents pages, consider using Insights for long time ranges", span, estimatedPages)
 }
 
 func parseTableResponse(resp *cloudwatchlogs.FilterLogEventsOutput, refId string) (*datasource.QueryResult, error) {
@@ -425,14 +1102,100 @@ func parseTableResponse(resp *cloudwatchlogs.FilterLogEventsOutput, refId string
 	table.Columns = append(table.Columns, &datasource.TableColumn{Name: "IngestionTime"})
 	table.Columns = append(table.Columns, &datasource.TableColumn{Name: "LogStreamName"})
 	table.Columns = append(table.Columns, &datasource.TableColumn{Name: "Message"})
+
+	// rows and values are allocated in a few large blocks rather than one by one, as large results spend most of their time here
+	const width = 4
+	n := len(resp.Events)
+	rows := make([]datasource.TableRow, n)
+	values := make([]datasource.RowValue, n*width)
+	valuePtrs := make([]*datasource.RowValue, n*width)
+	table.Rows = make([]*datasource.TableRow, n)
+	timestamps := &secondFormatter{}
+	ingestionTimes := &secondFormatter{}
+	for i, e := range resp.Events {
+		v := values[i*width : (i+1)*width]
+		v[0] = datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: timestamps.format(*e.Timestamp)}
+		v[1] = datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: ingestionTimes.format(*e.IngestionTime)}
+		v[2] = datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: *e.LogStreamName}
+		v[3] = datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: *e.Message}
+		p := valuePtrs[i*width : (i+1)*width : (i+1)*width]
+		for j := range p {
+			p[j] = &v[j]
+		}
+		rows[i].Values = p
+		table.Rows[i] = &rows[i]
+	}
+
+	return &datasource.QueryResult{
+		RefId:  refId,
+		Tables: []*datasource.Table{table},
+	}, nil
+}
+
+// secondFormatter formats millisecond timestamps in RFC3339, reusing the string of the previous timestamp
+// when it falls in the same second, as consecutive events usually do.
+type secondFormatter struct {
+	sec int64
+	s   string
+}
+
+func (f *secondFormatter) format(ms int64) string {
+	sec := ms / 1000
+	if f.s == "" || sec != f.sec {
+		f.sec = sec
+		f.s = time.Unix(sec, 0).Format(time.RFC3339)
+	}
+	return f.s
+}
+
+type streamSummary struct {
+	name  string
+	count int64
+	first int64
+	last  int64
+}
+
+// parseStreamSummaryResponse aggregates events by log stream, busiest stream first.
+func parseStreamSummaryResponse(resp *cloudwatchlogs.FilterLogEventsOutput, refId string) (*datasource.QueryResult, error) {
+	summaries := make(map[string]*streamSummary)
 	for _, e := range resp.Events {
+		s, ok := summaries[*e.LogStreamName]
+		if !ok {
+			s = &streamSummary{name: *e.LogStreamName, first: *e.Timestamp, last: *e.Timestamp}
+			summaries[*e.LogStreamName] = s
+		}
+		s.count++
+		if *e.Timestamp < s.first {
+			s.first = *e.Timestamp
+		}
+		if *e.Timestamp > s.last {
+			s.last = *e.Timestamp
+		}
+	}
+	sorted := make([]*streamSummary, 0, len(summaries))
+	for _, s := range summaries {
+		sorted = append(sorted, s)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].name < sorted[j].name
+	})
+
+	table := &datasource.Table{}
+	table.Columns = append(table.Columns, &datasource.TableColumn{Name: "LogStreamName"})
+	table.Columns = append(table.Columns, &datasource.TableColumn{Name: "Count"})
+	table.Columns = append(table.Columns, &datasource.TableColumn{Name: "FirstTimestamp"})
+	table.Columns = append(table.Columns, &datasource.TableColumn{Name: "LastTimestamp"})
+	for _, s := range sorted {
 		row := &datasource.TableRow{}
-		timestamp := time.Unix(*e.Timestamp/1000, *e.Timestamp%1000*1000*1000).Format(time.RFC3339)
-		row.Values = append(row.Values, &datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: timestamp})
-		ingestionTime := time.Unix(*e.IngestionTime/1000, *e.IngestionTime%1000*1000*1000).Format(time.RFC3339)
-		row.Values = append(row.Values, &datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: ingestionTime})
-		row.Values = append(row.Values, &datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: *e.LogStreamName})
-		row.Values = append(row.Values, &datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: *e.Message})
+		row.Values = append(row.Values, &datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: s.name})
+		row.Values = append(row.Values, &datasource.RowValue{Kind: datasource.RowValue_TYPE_INT64, Int64Value: s.count})
+		first := time.Unix(s.first/1000, s.first%1000*1000*1000).Format(time.RFC3339)
+		row.Values = append(row.Values, &datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: first})
+		last := time.Unix(s.last/1000, s.last%1000*1000*1000).Format(time.RFC3339)
+		row.Values = append(row.Values, &datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: last})
 		table.Rows = append(table.Rows, row)
 	}
 
@@ -465,6 +1228,26 @@ func formatLegend(kv map[string]string, legendFormat string) string {
 	return string(result)
 }
 
+// activeLogStreamSlack allows for the lastEventTimestamp of a stream, which is updated up to an hour after ingestion.
+const activeLogStreamSlack = int64(time.Hour / time.Millisecond)
+
+// activeLogStreamFilter reports whether a stream has events in the time range of the request, when enabled.
+func activeLogStreamFilter(tsdbReq *datasource.DatasourceRequest, enabled bool) (func(s *cloudwatchlogs.LogStream) bool, error) {
+	if !enabled {
+		return nil, nil
+	}
+	from, to, err := parseTimeRange(tsdbReq.TimeRange, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return func(s *cloudwatchlogs.LogStream) bool {
+		if s.LastEventTimestamp == nil {
+			return false // no events
+		}
+		return *s.LastEventTimestamp+activeLogStreamSlack >= from && aws.Int64Value(s.FirstEventTimestamp) <= to
+	}, nil
+}
+
 type suggestData struct {
 	Text  string
 	Value string
@@ -472,15 +1255,55 @@ type suggestData struct {
 
 func (t *AwsCloudWatchLogsDatasource) metricFindQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.DatasourceResponse, error) {
 	region := parameters.Get("region").MustString()
+	subtype := parameters.Get("subtype").MustString()
+	if strings.HasPrefix(subtype, "ecs_") {
+		sess, err := t.getSession(tsdbReq.Datasource, region)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ecsMetricFindQuery(ecs.New(sess), subtype, parameters)
+		if err != nil {
+			return nil, err
+		}
+		return &datasource.DatasourceResponse{
+			Results: []*datasource.QueryResult{
+				&datasource.QueryResult{
+					RefId:  "metricFindQuery",
+					Tables: []*datasource.Table{t.transformToTable(data)},
+				},
+			},
+		}, nil
+	}
+
 	svc, err := t.getClient(tsdbReq.Datasource, region)
 	if err != nil {
 		return nil, err
 	}
 
-	subtype := parameters.Get("subtype").MustString()
-
 	data := make([]suggestData, 0)
 	switch subtype {
+	case "insights_query":
+		dsInfo, err := t.getDsInfo(tsdbReq.Datasource, region)
+		if err != nil {
+			return nil, err
+		}
+		data, err = t.insightsVariableQuery(svc, tsdbReq, dsInfo, parameters)
+		if err != nil {
+			return nil, err
+		}
+	case "log_group_arns":
+		data, err = describeLogGroupArns(svc, parameters.Get("logGroupNamePrefix").MustString())
+		if err != nil {
+			return nil, err
+		}
+	case "resource_policies":
+		policies, err := describeResourcePolicies(ctx, svc)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range policies {
+			data = append(data, suggestData{Text: aws.StringValue(p.PolicyName), Value: aws.StringValue(p.PolicyName)})
+		}
 	case "log_group_names":
 		prefix := parameters.Get("logGroupNamePrefix").MustString()
 		param := &cloudwatchlogs.DescribeLogGroupsInput{}
@@ -515,9 +1338,24 @@ func (t *AwsCloudWatchLogsDatasource) metricFindQuery(ctx context.Context, tsdbR
 		if len(prefix) > 0 {
 			param.LogStreamNamePrefix = aws.String(prefix)
 		}
+		active, err := activeLogStreamFilter(tsdbReq, parameters.Get("timeRange").MustBool(false))
+		if err != nil {
+			return nil, err
+		}
+		if active != nil && len(prefix) == 0 {
+			// the API can not order by event time and filter by prefix at once
+			param.OrderBy = aws.String(cloudwatchlogs.OrderByLastEventTime)
+			param.Descending = aws.Bool(true)
+		}
 		streams := &cloudwatchlogs.DescribeLogStreamsOutput{}
 		err = svc.DescribeLogStreamsPagesWithContext(ctx, param, func(page *cloudwatchlogs.DescribeLogStreamsOutput, lastPage bool) bool {
-			streams.LogStreams = append(streams.LogStreams, page.LogStreams...)
+			for _, s := range page.LogStreams {
+				if active == nil || active(s) {
+					streams.LogStreams = append(streams.LogStreams, s)
+				} else if param.OrderBy != nil && aws.Int64Value(s.LastEventTimestamp) > 0 {
+					return false // the following streams are older
+				}
+			}
 			if len(streams.LogStreams) > 100 {
 				return false // safety limit
 			}
@@ -527,6 +1365,9 @@ func (t *AwsCloudWatchLogsDatasource) metricFindQuery(ctx context.Context, tsdbR
 			return nil, err
 		}
 		sort.Slice(streams.LogStreams, func(i, j int) bool {
+			if active != nil {
+				return aws.Int64Value(streams.LogStreams[i].LastEventTimestamp) > aws.Int64Value(streams.LogStreams[j].LastEventTimestamp)
+			}
 			return *streams.LogStreams[i].CreationTime > *streams.LogStreams[j].CreationTime
 		})
 
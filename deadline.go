@@ -0,0 +1,47 @@
+package main
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// defaultQueryTimeout matches the default dataproxy timeout of Grafana, after which the panel gives up on the response.
+	defaultQueryTimeout = 30 * time.Second
+	// deadlineMargin is left before the deadline to stop paginating and return the events fetched so far.
+	deadlineMargin = 2 * time.Second
+)
+
+// queryDeadline returns the deadline of the request if it has one, or the query timeout of the datasource
+// if it is earlier, so that results are returned while Grafana is still waiting for them.
+func queryDeadline(ctx context.Context, dsInfo *DatasourceInfo) time.Time {
+	timeout := defaultQueryTimeout
+	if dsInfo.QueryTimeoutSeconds > 0 {
+		timeout = time.Duration(dsInfo.QueryTimeoutSeconds) * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	return deadline
+}
+
+// withDeadline stops pagination shortly before the deadline, returning truncated results with a token to continue from.
+func (q orgQuota) withDeadline(deadline time.Time) orgQuota {
+	q.deadline = deadline
+	return q
+}
+
+// context returns a context for the API calls of a query, which ends the deadline margin before the deadline.
+func (q orgQuota) context() (context.Context, context.CancelFunc) {
+	if q.deadline.IsZero() {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithDeadline(context.Background(), q.deadline.Add(-deadlineMargin))
+}
+
+// nearDeadline reports whether another page is unlikely to be fetched before the deadline.
+func (q orgQuota) nearDeadline() bool {
+	return !q.deadline.IsZero() && time.Until(q.deadline) < 2*deadlineMargin
+}
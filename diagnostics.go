@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// diagnosticsEnv enables the diagnostics query type. Any user who can query a datasource can send it,
+// and it shows state shared by every org, so it is left to the Grafana operator to enable it.
+const diagnosticsEnv = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_DIAGNOSTICS"
+
+// pluginVersion is set at build time with -ldflags "-X main.pluginVersion=...".
+var pluginVersion = "dev"
+
+var startedAt = time.Now()
+
+type credentialCacheEntry struct {
+	Source     string
+	AgeSeconds int64
+	ExpiresIn  string `json:",omitempty"`
+}
+
+type circuitEntry struct {
+	Key      string
+	Failures int
+	OpenFor  string `json:",omitempty"`
+}
+
+type diagnostics struct {
+	PluginVersion string
+	SdkVersion    string
+	GoVersion     string
+	UptimeSeconds int64
+	Goroutines    int
+	HeapBytes     uint64
+
+	Credentials []credentialCacheEntry
+	ResultCache resultCacheStats
+	ClientCache clientCacheStats
+	Circuits    []circuitEntry
+
+	MaxEvents         int64
+	MaxMemoryBytes    int64
+	FanoutConcurrency int
+	OrgQuota          orgQuota
+	RunningQueries    int
+	Scheduler         querySchedulerStats
+}
+
+// diagnosticsQuery returns the version, caches and limits of the plugin process, for operators debugging it.
+func (t *AwsCloudWatchLogsDatasource) diagnosticsQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	if enabled, _ := strconv.ParseBool(os.Getenv(diagnosticsEnv)); !enabled {
+		return nil, fmt.Errorf("diagnostics are disabled, set %s=true in the Grafana server environment to enable them", diagnosticsEnv)
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	d := diagnostics{
+		PluginVersion:     pluginVersion,
+		SdkVersion:        aws.SDKVersion,
+		GoVersion:         runtime.Version(),
+		UptimeSeconds:     int64(time.Since(startedAt).Seconds()),
+		Goroutines:        runtime.NumGoroutine(),
+		HeapBytes:         mem.HeapAlloc,
+		ResultCache:       eventCache.stats(),
+		ClientCache:       awsClientCache.stats(),
+		MaxEvents:         globalMaxEvents,
+		MaxMemoryBytes:    globalMaxMemory,
+		FanoutConcurrency: fanoutConcurrency,
+		OrgQuota:          quotaForOrg(tsdbReq.Datasource.OrgId),
+		Scheduler:         scheduler.stats(),
+	}
+
+	now := time.Now()
+	credentialCacheLock.RLock()
+	for _, c := range awsCredentialCache {
+		e := credentialCacheEntry{Source: c.source, AgeSeconds: int64(now.Sub(c.created).Seconds())}
+		if c.expiration != nil {
+			e.ExpiresIn = c.expiration.Sub(now).Round(time.Second).String()
+		}
+		d.Credentials = append(d.Credentials, e)
+	}
+	credentialCacheLock.RUnlock()
+	sort.Slice(d.Credentials, func(i, j int) bool { return d.Credentials[i].Source < d.Credentials[j].Source })
+
+	circuitLock.Lock()
+	for key, c := range circuits {
+		e := circuitEntry{Key: key, Failures: c.failures}
+		if now.Before(c.openUntil) {
+			e.OpenFor = c.openUntil.Sub(now).Round(time.Second).String()
+		}
+		d.Circuits = append(d.Circuits, e)
+	}
+	circuitLock.Unlock()
+	sort.Slice(d.Circuits, func(i, j int) bool { return d.Circuits[i].Key < d.Circuits[j].Key })
+
+	runningQueryLock.Lock()
+	d.RunningQueries = runningQueries[tsdbReq.Datasource.OrgId]
+	runningQueryLock.Unlock()
+
+	metaJson, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return &datasource.QueryResult{MetaJson: string(metaJson)}, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// ecsMetricFindQuery lists ECS clusters, services and tasks, and the awslogs log groups and streams of a service,
+// so that ECS dashboards can drive log panels from service variables.
+// The awslogs driver names streams "<stream prefix>/<container name>/<task id>", so the streams of the containers
+// without a stream prefix are not listed.
+func ecsMetricFindQuery(svc *ecs.ECS, subtype string, parameters *simplejson.Json) ([]suggestData, error) {
+	cluster := parameters.Get("cluster").MustString()
+	service := parameters.Get("service").MustString()
+
+	var values []string
+	switch subtype {
+	case "ecs_clusters":
+		err := svc.ListClustersPages(&ecs.ListClustersInput{}, func(page *ecs.ListClustersOutput, lastPage bool) bool {
+			for _, arn := range page.ClusterArns {
+				values = append(values, arnResourceName(aws.StringValue(arn)))
+			}
+			return !lastPage
+		})
+		if err != nil {
+			return nil, err
+		}
+	case "ecs_services":
+		err := svc.ListServicesPages(&ecs.ListServicesInput{Cluster: aws.String(cluster)}, func(page *ecs.ListServicesOutput, lastPage bool) bool {
+			for _, arn := range page.ServiceArns {
+				values = append(values, arnResourceName(aws.StringValue(arn)))
+			}
+			return !lastPage
+		})
+		if err != nil {
+			return nil, err
+		}
+	case "ecs_tasks":
+		tasks, err := listEcsTasks(svc, cluster, service)
+		if err != nil {
+			return nil, err
+		}
+		values = tasks
+	case "ecs_log_groups", "ecs_log_stream_prefixes", "ecs_log_streams":
+		logConfigs, err := describeEcsServiceLogs(svc, cluster, service)
+		if err != nil {
+			return nil, err
+		}
+		var tasks []string
+		if subtype == "ecs_log_streams" {
+			if tasks, err = listEcsTasks(svc, cluster, service); err != nil {
+				return nil, err
+			}
+		}
+		seen := make(map[string]bool)
+		for _, c := range logConfigs {
+			var candidates []string
+			if c.streamPrefix == "" && subtype != "ecs_log_groups" {
+				// without awslogs-stream-prefix, the streams are named after the container ID, which the task does not tell
+				continue
+			}
+			switch subtype {
+			case "ecs_log_groups":
+				candidates = []string{c.group}
+			case "ecs_log_stream_prefixes":
+				candidates = []string{c.streamPrefix + "/" + c.container + "/"}
+			case "ecs_log_streams":
+				for _, task := range tasks {
+					candidates = append(candidates, c.streamPrefix+"/"+c.container+"/"+task)
+				}
+			}
+			for _, v := range candidates {
+				if !seen[v] {
+					seen[v] = true
+					values = append(values, v)
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown subtype %s", subtype)
+	}
+
+	sort.Strings(values)
+	data := make([]suggestData, 0, len(values))
+	for _, v := range values {
+		data = append(data, suggestData{Text: v, Value: v})
+	}
+	return data, nil
+}
+
+func listEcsTasks(svc *ecs.ECS, cluster string, service string) ([]string, error) {
+	input := &ecs.ListTasksInput{Cluster: aws.String(cluster)}
+	if service != "" {
+		input.ServiceName = aws.String(service)
+	}
+	var tasks []string
+	err := svc.ListTasksPages(input, func(page *ecs.ListTasksOutput, lastPage bool) bool {
+		for _, arn := range page.TaskArns {
+			tasks = append(tasks, arnResourceName(aws.StringValue(arn)))
+		}
+		return !lastPage
+	})
+	return tasks, err
+}
+
+type ecsLogConfig struct {
+	container    string
+	group        string
+	streamPrefix string
+}
+
+// describeEcsServiceLogs returns the awslogs settings of the containers in the task definition of a service.
+func describeEcsServiceLogs(svc *ecs.ECS, cluster string, service string) ([]ecsLogConfig, error) {
+	sresp, err := svc.DescribeServices(&ecs.DescribeServicesInput{
+		Cluster:  aws.String(cluster),
+		Services: []*string{aws.String(service)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sresp.Services) == 0 {
+		return nil, fmt.Errorf("service %s is not found in cluster %s", service, cluster)
+	}
+	tresp, err := svc.DescribeTaskDefinition(&ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: sresp.Services[0].TaskDefinition,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []ecsLogConfig
+	for _, c := range tresp.TaskDefinition.ContainerDefinitions {
+		if c.LogConfiguration == nil || aws.StringValue(c.LogConfiguration.LogDriver) != "awslogs" {
+			continue
+		}
+		options := aws.StringValueMap(c.LogConfiguration.Options)
+		configs = append(configs, ecsLogConfig{
+			container:    aws.StringValue(c.Name),
+			group:        options["awslogs-group"],
+			streamPrefix: options["awslogs-stream-prefix"],
+		})
+	}
+	return configs, nil
+}
+
+// arnResourceName returns the last part of an ARN such as arn:aws:ecs:region:account:service/cluster/name.
+func arnResourceName(arn string) string {
+	return arn[strings.LastIndex(arn, "/")+1:]
+}
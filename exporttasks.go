@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// maxExportTasks bounds the tasks listed, as the API keeps the tasks of the account for a long time.
+const maxExportTasks = 1000
+
+// exportTasksQuery lists the export tasks of the account to S3, the most recent first, so that the export pipelines
+// can be monitored from a table panel. The tasks may be filtered by status, e.g. FAILED, and by log group name prefix.
+func (t *AwsCloudWatchLogsDatasource) exportTasksQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	svc, err := t.getClient(tsdbReq.Datasource, parameters.Get("region").MustString())
+	if err != nil {
+		return nil, err
+	}
+	input := &cloudwatchlogs.DescribeExportTasksInput{}
+	if status := strings.ToUpper(parameters.Get("exportStatus").MustString()); status != "" {
+		input.StatusCode = aws.String(status)
+	}
+	logGroupNamePrefix := parameters.Get("logGroupName").MustString()
+
+	tasks := make([]*cloudwatchlogs.ExportTask, 0)
+	for len(tasks) < maxExportTasks {
+		resp, err := svc.DescribeExportTasksWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range resp.ExportTasks {
+			if strings.HasPrefix(aws.StringValue(task.LogGroupName), logGroupNamePrefix) {
+				tasks = append(tasks, task)
+			}
+		}
+		if resp.NextToken == nil {
+			break
+		}
+		input.NextToken = resp.NextToken
+	}
+	creationTime := func(task *cloudwatchlogs.ExportTask) int64 {
+		if task.ExecutionInfo == nil {
+			return 0
+		}
+		return aws.Int64Value(task.ExecutionInfo.CreationTime)
+	}
+	sort.SliceStable(tasks, func(i, j int) bool { return creationTime(tasks[i]) > creationTime(tasks[j]) })
+
+	table := &datasource.Table{
+		Columns: []*datasource.TableColumn{
+			{Name: "TaskId"}, {Name: "TaskName"}, {Name: "LogGroupName"}, {Name: "Status"}, {Name: "StatusMessage"},
+			{Name: "From"}, {Name: "To"}, {Name: "Destination"}, {Name: "Created"}, {Name: "Completed"}, {Name: "DurationSeconds"},
+		},
+	}
+	for _, task := range tasks {
+		status, message := "", ""
+		if task.Status != nil {
+			status, message = aws.StringValue(task.Status.Code), aws.StringValue(task.Status.Message)
+		}
+		completionTime := int64(0)
+		if task.ExecutionInfo != nil {
+			completionTime = aws.Int64Value(task.ExecutionInfo.CompletionTime)
+		}
+		duration := int64(0)
+		if completionTime > 0 {
+			duration = (completionTime - creationTime(task)) / 1000
+		}
+		destination := fmt.Sprintf("s3://%s/%s", aws.StringValue(task.Destination), aws.StringValue(task.DestinationPrefix))
+		table.Rows = append(table.Rows, &datasource.TableRow{
+			Values: []*datasource.RowValue{
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: aws.StringValue(task.TaskId)},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: aws.StringValue(task.TaskName)},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: aws.StringValue(task.LogGroupName)},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: status},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: message},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: formatMillis(aws.Int64Value(task.From))},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: formatMillis(aws.Int64Value(task.To))},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: destination},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: formatMillis(creationTime(task))},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: formatMillis(completionTime)},
+				{Kind: datasource.RowValue_TYPE_INT64, Int64Value: duration},
+			},
+		})
+	}
+	return &datasource.QueryResult{
+		Tables: []*datasource.Table{table},
+	}, nil
+}
+
+// formatMillis formats epoch milliseconds in RFC3339 as the event tables do, and leaves unset times empty.
+func formatMillis(ms int64) string {
+	if ms <= 0 {
+		return ""
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)).Format(time.RFC3339)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// fanoutConcurrencyEnv overrides the number of log groups of a target fetched at the same time.
+const fanoutConcurrencyEnv = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_FANOUT_CONCURRENCY"
+
+// maxFanoutLogGroups limits the log groups a single target may expand to.
+const maxFanoutLogGroups = 100
+
+var fanoutConcurrency = 4
+
+func init() {
+	if v := os.Getenv(fanoutConcurrencyEnv); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			pluginLogger.Error("invalid fan-out concurrency", "env", fanoutConcurrencyEnv, "value", v)
+		} else {
+			fanoutConcurrency = n
+		}
+	}
+}
+
+// hasMultipleLogGroups reports whether the log group name of the target is a comma separated list,
+// or a prefix ending with "*", as FilterLogEvents only reads a single log group.
+func (target *Target) hasMultipleLogGroups() bool {
+	name := aws.StringValue(target.Input.LogGroupName)
+	return strings.Contains(name, ",") || strings.HasSuffix(name, "*")
+}
+
+// expandLogGroupNames resolves the list of log group names, expanding prefixes with DescribeLogGroups.
+func expandLogGroupNames(svc *cloudwatchlogs.CloudWatchLogs, name string) ([]string, error) {
+	seen := make(map[string]bool)
+	groups := make([]string, 0)
+	add := func(g string) {
+		if !seen[g] {
+			seen[g] = true
+			groups = append(groups, g)
+		}
+	}
+	for _, n := range strings.Split(name, ",") {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			continue
+		}
+		if !strings.HasSuffix(n, "*") {
+			add(n)
+			continue
+		}
+		param := &cloudwatchlogs.DescribeLogGroupsInput{}
+		if prefix := strings.TrimSuffix(n, "*"); prefix != "" {
+			param.LogGroupNamePrefix = aws.String(prefix)
+		}
+		err := svc.DescribeLogGroupsPages(param, func(page *cloudwatchlogs.DescribeLogGroupsOutput, lastPage bool) bool {
+			for _, g := range page.LogGroups {
+				add(aws.StringValue(g.LogGroupName))
+			}
+			return len(groups) <= maxFanoutLogGroups && !lastPage
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(groups) > maxFanoutLogGroups {
+		return nil, fmt.Errorf("log group name %q matches more than %d log groups", name, maxFanoutLogGroups)
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("log group name %q matches no log groups", name)
+	}
+	return groups, nil
+}
+
+type logGroupResult struct {
+	resp   *cloudwatchlogs.FilterLogEventsOutput
+	stats  *queryStats
+	sample *sampler
+	err    error
+}
+
+// fetchLogGroups runs fetch for every log group through a bounded pool of workers, and returns the results in the order of the groups.
+func fetchLogGroups(groups []string, fetch func(i int, logGroupName string) logGroupResult) []logGroupResult {
+	results := make([]logGroupResult, len(groups))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	workers := fanoutConcurrency
+	if workers > len(groups) {
+		workers = len(groups)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = fetch(i, groups[i])
+			}
+		}()
+	}
+	for i := range groups {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// getLogEventsFromGroups fetches the events of every log group of the target through a bounded pool of workers,
+// and merges them in time order. Failed log groups are reported as a partial error, unless every log group failed.
+func (t *AwsCloudWatchLogsDatasource) getLogEventsFromGroups(svc *cloudwatchlogs.CloudWatchLogs, target *Target, quota orgQuota, includeStream func(name string) bool, sample *sampler) (*cloudwatchlogs.FilterLogEventsOutput, *queryStats, error) {
+	groups, err := expandLogGroupNames(svc, aws.StringValue(target.Input.LogGroupName))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if target.LastN == 0 {
+		// the log groups share the event and memory limits of the response, while the last N events are at most N per log group
+		quota = quota.withSharedBudget()
+	}
+	// each log group is sampled while it is paginated, as a single log group is, and the samples are merged afterwards
+	groupSamplers := make([]*sampler, len(groups))
+	if target.LastN == 0 {
+		for i := range groups {
+			groupSamplers[i] = sample.forGroup()
+		}
+	}
+	results := fetchLogGroups(groups, func(i int, logGroupName string) (r logGroupResult) {
+		input := target.Input
+		input.LogGroupName = aws.String(logGroupName)
+		if target.LastN > 0 {
+			r.resp, r.stats, r.err = t.getLastEvents(svc, &input, target.LastN, quota, includeStream)
+		} else {
+			r.sample = groupSamplers[i]
+			r.resp, r.stats, r.err = t.getLogEvent(svc, &input, target.StartFromHead, quota, includeStream, r.sample)
+		}
+		return r
+	})
+
+	stats := &queryStats{Engine: "filter"}
+	var events []*cloudwatchlogs.FilteredLogEvent
+	samplers := make([]*sampler, 0)
+	samples := make([][]*cloudwatchlogs.FilteredLogEvent, 0)
+	failures := make([]string, 0)
+	var firstErr error
+	searchedLogStreams := 0
+	for i, r := range results {
+		if r.err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", groups[i], r.err))
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		stats.merge(r.stats)
+		searchedLogStreams += r.stats.SearchedLogStreams
+		events = append(events, r.resp.Events...)
+		if r.sample != nil {
+			samplers = append(samplers, r.sample)
+			samples = append(samples, r.resp.Events)
+		}
+	}
+	stats.SearchedLogStreams = searchedLogStreams
+	if len(failures) == len(groups) {
+		return nil, nil, firstErr
+	}
+	if len(failures) > 0 {
+		stats.PartialError = fmt.Sprintf("%d of %d log groups failed: %s", len(failures), len(groups), strings.Join(failures, "; "))
+	}
+
+	if sample != nil && target.LastN == 0 {
+		// the matched events of every log group are counted before the merged events are truncated
+		events = sample.mergeGroups(samplers, samples)
+		stats.MatchedEvents = sample.matched
+	}
+	sort.SliceStable(events, func(i, j int) bool { return *events[i].Timestamp < *events[j].Timestamp })
+	if target.LastN > 0 {
+		events = newestEvents(events, target.LastN)
+	}
+	if maxEvents := quota.maxEvents(); int64(len(events)) > maxEvents {
+		events = events[:maxEvents]
+		stats.Truncated = fmt.Sprintf("the limit of %d events per response was reached", maxEvents)
+	}
+	if sample != nil && target.LastN > 0 {
+		sampled := make([]*cloudwatchlogs.FilteredLogEvent, 0)
+		for _, e := range events {
+			sampled = sample.add(sampled, e)
+		}
+		sample.finish(sampled)
+		stats.MatchedEvents = sample.matched
+		events = sampled
+	}
+	stats.Events = len(events)
+
+	return &cloudwatchlogs.FilterLogEventsOutput{Events: events}, stats, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+const (
+	defaultFieldStatsSampleSize = 1000
+	maxFieldStatsSampleSize     = 10000
+	fieldStatsTopValues         = 5
+)
+
+type fieldStats struct {
+	Field       string
+	Occurrences int
+	values      map[string]int
+}
+
+// fieldStatsQuery samples the most recent events of a log group and returns the cardinality and top values of each JSON field,
+// to help building filter patterns in the query editor.
+func (t *AwsCloudWatchLogsDatasource) fieldStatsQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	logGroupName := parameters.Get("logGroupName").MustString()
+	if logGroupName == "" {
+		return nil, fmt.Errorf("logGroupName is required")
+	}
+	sampleSize := parameters.Get("sampleSize").MustInt64(defaultFieldStatsSampleSize)
+	if sampleSize <= 0 || sampleSize > maxFieldStatsSampleSize {
+		sampleSize = defaultFieldStatsSampleSize
+	}
+	svc, err := t.getClient(tsdbReq.Datasource, parameters.Get("region").MustString())
+	if err != nil {
+		return nil, err
+	}
+
+	input := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:  aws.String(logGroupName),
+		FilterPattern: aws.String(parameters.Get("filterPattern").MustString()),
+	}
+	t.auditResourceQuery(tsdbReq.Datasource, "fieldStatsQuery", &Target{RefId: tsdbReq.Queries[0].RefId, Region: parameters.Get("region").MustString(), Input: *input}, 0, 0)
+	resp, _, err := t.getLastEvents(svc, input, sampleSize, quotaForOrg(tsdbReq.Datasource.OrgId), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]*fieldStats)
+	for _, e := range resp.Events {
+		var message map[string]interface{}
+		if err := json.Unmarshal([]byte(aws.StringValue(e.Message)), &message); err != nil {
+			continue
+		}
+		for field, value := range flattenFields("", message, make(map[string]string)) {
+			s, ok := stats[field]
+			if !ok {
+				s = &fieldStats{Field: field, values: make(map[string]int)}
+				stats[field] = s
+			}
+			s.Occurrences++
+			s.values[value]++
+		}
+	}
+
+	fields := make([]*fieldStats, 0, len(stats))
+	for _, s := range stats {
+		fields = append(fields, s)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].Occurrences != fields[j].Occurrences {
+			return fields[i].Occurrences > fields[j].Occurrences
+		}
+		return fields[i].Field < fields[j].Field
+	})
+
+	table := &datasource.Table{
+		Columns: []*datasource.TableColumn{{Name: "Field"}, {Name: "Occurrences"}, {Name: "Percent"}, {Name: "Cardinality"}, {Name: "TopValues"}},
+	}
+	for _, s := range fields {
+		table.Rows = append(table.Rows, &datasource.TableRow{
+			Values: []*datasource.RowValue{
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: s.Field},
+				{Kind: datasource.RowValue_TYPE_INT64, Int64Value: int64(s.Occurrences)},
+				{Kind: datasource.RowValue_TYPE_DOUBLE, DoubleValue: float64(s.Occurrences) * 100 / float64(len(resp.Events))},
+				{Kind: datasource.RowValue_TYPE_INT64, Int64Value: int64(len(s.values))},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: topValues(s.values, fieldStatsTopValues)},
+			},
+		})
+	}
+
+	return &datasource.QueryResult{
+		Tables: []*datasource.Table{table},
+	}, nil
+}
+
+// flattenFields flattens nested objects into dotted field names, the way filter patterns refer to them ($.a.b).
+func flattenFields(prefix string, object map[string]interface{}, fields map[string]string) map[string]string {
+	for k, v := range object {
+		name := k
+		if prefix != "" {
+			name = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flattenFields(name, v, fields)
+		case string:
+			fields[name] = v
+		default:
+			b, _ := json.Marshal(v)
+			fields[name] = string(b)
+		}
+	}
+	return fields
+}
+
+func topValues(values map[string]int, n int) string {
+	keys := topKeys(values, n)
+	top := make([]string, 0, len(keys))
+	for _, k := range keys {
+		top = append(top, fmt.Sprintf("%s (%d)", k, values[k]))
+	}
+	return strings.Join(top, ", ")
+}
+
+// topKeys returns the n most frequent values, the first in alphabetical order on ties.
+func topKeys(values map[string]int, n int) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if values[keys[i]] != values[keys[j]] {
+			return values[keys[i]] > values[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
@@ -7,6 +7,7 @@ require (
 	github.com/bmizerany/assert v0.0.0-20160611221934-b7ed37b82869 // indirect
 	github.com/grafana/grafana v5.1.3+incompatible
 	github.com/grafana/grafana-plugin-model v0.0.0-20190930120109-1fc953a61fb4
+	github.com/hashicorp/go-hclog v0.0.0-20180709165350-ff2cf002a8dd
 	github.com/hashicorp/go-plugin v1.0.1
 	github.com/kr/pretty v0.1.0 // indirect
 	golang.org/x/net v0.0.0-20180826012351-8a410e7b638d
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+// hllPrecision gives 4096 registers of a byte per sketch, a standard error of about 1.6%,
+// so that a day of 1 minute intervals takes under 6MB whatever the number of distinct values.
+const hllPrecision = 12
+
+// hyperLogLog estimates the number of distinct values added to it in a fixed memory.
+type hyperLogLog struct {
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+func (h *hyperLogLog) add(value string) {
+	hash := fnv.New64a()
+	hash.Write([]byte(value))
+	x := mix64(hash.Sum64())
+	i := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+// count returns the estimate of the original HyperLogLog paper, with linear counting for small cardinalities.
+func (h *hyperLogLog) count() float64 {
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Pow(2, -float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		return math.Round(m * math.Log(m/float64(zeros)))
+	}
+	return math.Round(estimate)
+}
+
+// mix64 spreads the bits of FNV hashes, whose high bits vary little between similar short strings,
+// as the registers are selected by the high bits.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// parseDistinctResponse returns the estimated number of distinct values of the field in each interval,
+// e.g. unique user IDs per 5 minutes, with a sketch per interval to keep the memory bounded. Events where
+// the field is missing are skipped.
+func parseDistinctResponse(resp *cloudwatchlogs.FilterLogEventsOutput, refId string, intervalMs int64, field string, keyFunc func(e *cloudwatchlogs.FilteredLogEvent) string) (*datasource.QueryResult, error) {
+	if field == "" {
+		field = "LogStreamName"
+	}
+	sketches := make(map[int64]*hyperLogLog)
+	for _, e := range resp.Events {
+		key := keyFunc(e)
+		if key == "" {
+			continue
+		}
+		ts := bucketTimestamp(*e.Timestamp, intervalMs)
+		h, ok := sketches[ts]
+		if !ok {
+			h = newHyperLogLog()
+			sketches[ts] = h
+		}
+		h.add(key)
+	}
+	timestamps := make([]int64, 0, len(sketches))
+	for ts := range sketches {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	s := &datasource.TimeSeries{
+		Name: "distinct " + field,
+		Tags: map[string]string{"field": field},
+	}
+	for _, ts := range timestamps {
+		s.Points = append(s.Points, &datasource.Point{Timestamp: ts, Value: sketches[ts].count()})
+	}
+	return &datasource.QueryResult{
+		RefId:  refId,
+		Series: []*datasource.TimeSeries{s},
+	}, nil
+}
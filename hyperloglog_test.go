@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	tests := []struct {
+		distinct int
+		repeat   int
+	}{
+		{0, 1},
+		{1, 1},
+		{1, 100},
+		{10, 3},
+		{1000, 1},
+		{10000, 2},
+		{100000, 1},
+	}
+	for _, tt := range tests {
+		h := newHyperLogLog()
+		for r := 0; r < tt.repeat; r++ {
+			for i := 0; i < tt.distinct; i++ {
+				h.add(fmt.Sprintf("user-%d", i))
+			}
+		}
+		got := h.count()
+		// 3 standard errors of the 4096 registers
+		if math.Abs(got-float64(tt.distinct)) > 0.05*float64(tt.distinct)+0.5 {
+			t.Errorf("count of %d distinct values added %d times = %v", tt.distinct, tt.repeat, got)
+		}
+	}
+}
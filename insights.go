@@ -0,0 +1,430 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+const (
+	insightsTimeFormat    = "2006-01-02 15:04:05.000"
+	insightsPollInterval  = 1 * time.Second
+	insightsPollAttempts  = 60
+	insightsMaxResultRows = 10000
+	insightsMaxLogGroups  = 20
+)
+
+// filterPatternToInsights translates a term based filter pattern into an Insights filter expression.
+// JSON and space-delimited patterns have no equivalent and are reported as not translatable.
+func filterPatternToInsights(pattern string) (string, bool) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return "", true
+	}
+	if strings.HasPrefix(pattern, "{") || strings.HasPrefix(pattern, "[") {
+		return "", false
+	}
+
+	terms, ok := splitFilterTerms(pattern)
+	if !ok {
+		return "", false
+	}
+	var and []string
+	var or []string
+	for _, term := range terms {
+		switch {
+		case strings.HasPrefix(term, "-"):
+			and = append(and, fmt.Sprintf("@message not like %s", strconv.Quote(term[1:])))
+		case strings.HasPrefix(term, "?"):
+			or = append(or, fmt.Sprintf("@message like %s", strconv.Quote(term[1:])))
+		default:
+			and = append(and, fmt.Sprintf("@message like %s", strconv.Quote(term)))
+		}
+	}
+	if len(or) > 0 {
+		if len(and) > 0 {
+			return "", false // mixing optional and required terms is ambiguous
+		}
+		return "(" + strings.Join(or, " or ") + ")", true
+	}
+	return strings.Join(and, " and "), true
+}
+
+func splitFilterTerms(pattern string) ([]string, bool) {
+	var terms []string
+	var current strings.Builder
+	inQuote := false
+	for _, r := range pattern {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case r == ' ' && !inQuote:
+			if current.Len() > 0 {
+				terms = append(terms, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if inQuote {
+		return nil, false
+	}
+	if current.Len() > 0 {
+		terms = append(terms, current.String())
+	}
+	return terms, true
+}
+
+// selectInsightsQuery decides whether an "auto" engine target runs on Insights, and returns the Insights query to run.
+// Insights is used for count series, and for raw events when the range is longer than the configured threshold.
+// Stat targets are counted from the FilterLogEvents result, so that they are never run on Insights.
+func selectInsightsQuery(dsInfo *DatasourceInfo, target *Target, from int64, to int64) (string, bool) {
+	if target.Engine != "auto" || target.LastN > 0 || target.Format == "stat" {
+		return "", false
+	}
+	span := time.Duration(to-from) * time.Millisecond
+	if target.Format != "timeserie" && span <= dsInfo.autoInsightsThreshold() {
+		return "", false
+	}
+	filter, ok := filterPatternToInsights(aws.StringValue(target.Input.FilterPattern))
+	if !ok {
+		return "", false
+	}
+
+	var commands []string
+	if len(target.Input.LogStreamNames) > 0 {
+		names := make([]string, 0, len(target.Input.LogStreamNames))
+		for _, n := range target.Input.LogStreamNames {
+			names = append(names, strconv.Quote(*n))
+		}
+		commands = append(commands, "filter @logStream in ["+strings.Join(names, ", ")+"]")
+	}
+	if len(target.ExcludeLogStreamNames) > 0 {
+		names := make([]string, 0, len(target.ExcludeLogStreamNames))
+		for _, n := range target.ExcludeLogStreamNames {
+			names = append(names, strconv.Quote(n))
+		}
+		commands = append(commands, "filter @logStream not in ["+strings.Join(names, ", ")+"]")
+	}
+	if target.ExcludeLogStreamNamePrefix != "" {
+		prefix := strings.Replace(regexp.QuoteMeta(target.ExcludeLogStreamNamePrefix), "/", "\\/", -1)
+		commands = append(commands, "filter @logStream not like /^"+prefix+"/")
+	}
+	if target.LogStreamNamePattern != "" {
+		commands = append(commands, "filter @logStream like /"+strings.Replace(target.LogStreamNamePattern, "/", "\\/", -1)+"/")
+	}
+	if len(target.lambdaVersions) > 0 {
+		commands = append(commands, lambdaVersionsInsightsFilter(target.lambdaVersions))
+	}
+	if filter != "" {
+		commands = append(commands, "filter "+filter)
+	}
+	if target.Format == "timeserie" {
+		bin := target.IntervalMs / 1000
+		if bin < 1 {
+			bin = 1
+		}
+		commands = append(commands, fmt.Sprintf("stats count(*) as count by bin(%ds)", bin))
+	} else {
+		commands = append([]string{"fields @timestamp, @ingestionTime, @logStream, @message"}, commands...)
+		commands = append(commands, "sort @timestamp desc")
+	}
+	return strings.Join(commands, " | "), true
+}
+
+// estimateInsightsCost converts the bytes scanned by an Insights query into an approximate cost in USD.
+func estimateInsightsCost(bytesScanned float64, pricePerGB float64) float64 {
+	return bytesScanned / (1 << 30) * pricePerGB
+}
+
+// scanBudgetExceeded returns the reason for stopping a query which has scanned more than budgetGB.
+func scanBudgetExceeded(statistics *cloudwatchlogs.QueryStatistics, budgetGB float64) string {
+	if statistics == nil || budgetGB <= 0 {
+		return ""
+	}
+	scanned := aws.Float64Value(statistics.BytesScanned) / (1 << 30)
+	if scanned <= budgetGB {
+		return ""
+	}
+	return fmt.Sprintf("the scan budget of %g GB was exceeded (%.2f GB scanned), results are truncated", budgetGB, scanned)
+}
+
+// runInsightsQuery starts an Insights query and waits for it to complete.
+// When the query scans more than budgetGB, or runs until the deadline, it is stopped and the results found so far are returned with the reason.
+func runInsightsQuery(svc *cloudwatchlogs.CloudWatchLogs, input *cloudwatchlogs.StartQueryInput, budgetGB float64, deadline time.Time) (*cloudwatchlogs.GetQueryResultsOutput, string, error) {
+	sresp, err := svc.StartQuery(input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i := 0; i < insightsPollAttempts; i++ {
+		gresp, err := svc.GetQueryResults(&cloudwatchlogs.GetQueryResultsInput{QueryId: sresp.QueryId})
+		if err != nil {
+			return nil, "", err
+		}
+		switch aws.StringValue(gresp.Status) {
+		case "Complete":
+			return gresp, "", nil
+		case "Failed", "Cancelled", "Timeout":
+			return nil, "", fmt.Errorf("insights query %s: %s", aws.StringValue(sresp.QueryId), aws.StringValue(gresp.Status))
+		}
+		if w := scanBudgetExceeded(gresp.Statistics, budgetGB); w != "" {
+			_, _ = svc.StopQuery(&cloudwatchlogs.StopQueryInput{QueryId: sresp.QueryId})
+			return gresp, w, nil
+		}
+		if !deadline.IsZero() && time.Until(deadline) < insightsPollInterval+deadlineMargin {
+			_, _ = svc.StopQuery(&cloudwatchlogs.StopQueryInput{QueryId: sresp.QueryId})
+			return gresp, "the query deadline was reached, results are truncated", nil
+		}
+		time.Sleep(insightsPollInterval)
+	}
+
+	_, _ = svc.StopQuery(&cloudwatchlogs.StopQueryInput{QueryId: sresp.QueryId})
+	return nil, "", fmt.Errorf("insights query %s did not complete in time", aws.StringValue(sresp.QueryId))
+}
+
+// insightsSplit collects the results of an Insights query run over consecutive parts of the time range.
+type insightsSplit struct {
+	results      [][]*cloudwatchlogs.ResultField
+	seen         map[string]bool
+	queries      int
+	bytesScanned float64
+	warning      string
+}
+
+// runSplitInsightsQuery runs an Insights query returning events sorted newest first, until limit events are found.
+// When a query hits the Insights row limit, its time range is split in half and the halves are run newer first.
+func runSplitInsightsQuery(svc *cloudwatchlogs.CloudWatchLogs, input *cloudwatchlogs.StartQueryInput, budgetGB float64, deadline time.Time, limit int64, split *insightsSplit) error {
+	if int64(len(split.results)) >= limit || split.warning != "" {
+		return nil
+	}
+	remainingGB := budgetGB
+	if budgetGB > 0 {
+		remainingGB = budgetGB - split.bytesScanned/(1<<30)
+		if remainingGB <= 0 {
+			split.warning = fmt.Sprintf("the scan budget of %g GB was exceeded, results are truncated", budgetGB)
+			return nil
+		}
+	}
+
+	i := *input
+	i.Limit = aws.Int64(insightsMaxResultRows)
+	gresp, warning, err := runInsightsQuery(svc, &i, remainingGB, deadline)
+	if err != nil {
+		return err
+	}
+	split.queries++
+	if gresp.Statistics != nil {
+		split.bytesScanned += aws.Float64Value(gresp.Statistics.BytesScanned)
+	}
+	start, end := aws.Int64Value(input.StartTime), aws.Int64Value(input.EndTime)
+	if warning != "" || int64(len(gresp.Results)) < insightsMaxResultRows || end-start <= 1 {
+		split.warning = warning
+		for _, r := range gresp.Results {
+			if int64(len(split.results)) >= limit {
+				break
+			}
+			// the halves share their boundary second, skip the events returned twice
+			ptr := insightsResultField(r, "@ptr")
+			if ptr != "" && split.seen[ptr] {
+				continue
+			}
+			split.seen[ptr] = true
+			split.results = append(split.results, r)
+		}
+		return nil
+	}
+
+	mid := start + (end-start)/2
+	newer := *input
+	newer.StartTime = aws.Int64(mid)
+	if err := runSplitInsightsQuery(svc, &newer, budgetGB, deadline, limit, split); err != nil {
+		return err
+	}
+	older := *input
+	older.EndTime = aws.Int64(mid)
+	return runSplitInsightsQuery(svc, &older, budgetGB, deadline, limit, split)
+}
+
+func insightsResultField(result []*cloudwatchlogs.ResultField, field string) string {
+	for _, f := range result {
+		if aws.StringValue(f.Field) == field {
+			return aws.StringValue(f.Value)
+		}
+	}
+	return ""
+}
+
+func parseInsightsTime(v string) (int64, error) {
+	t, err := time.Parse(insightsTimeFormat, v)
+	if err != nil {
+		return 0, err
+	}
+	return t.UnixNano() / int64(time.Millisecond), nil
+}
+
+func insightsResultsToEvents(results [][]*cloudwatchlogs.ResultField) ([]*cloudwatchlogs.FilteredLogEvent, error) {
+	events := make([]*cloudwatchlogs.FilteredLogEvent, 0, len(results))
+	for _, r := range results {
+		e := &cloudwatchlogs.FilteredLogEvent{
+			LogStreamName: aws.String(""),
+			Message:       aws.String(""),
+		}
+		for _, f := range r {
+			switch aws.StringValue(f.Field) {
+			case "@timestamp":
+				ts, err := parseInsightsTime(aws.StringValue(f.Value))
+				if err != nil {
+					return nil, err
+				}
+				e.Timestamp = aws.Int64(ts)
+			case "@ingestionTime":
+				ts, err := parseInsightsTime(aws.StringValue(f.Value))
+				if err != nil {
+					return nil, err
+				}
+				e.IngestionTime = aws.Int64(ts)
+			case "@logStream":
+				e.LogStreamName = f.Value
+			case "@message":
+				e.Message = f.Value
+			}
+		}
+		if e.Timestamp == nil {
+			continue
+		}
+		if e.IngestionTime == nil {
+			e.IngestionTime = e.Timestamp
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func insightsResultsToCountSeries(results [][]*cloudwatchlogs.ResultField) (*datasource.TimeSeries, error) {
+	series := &datasource.TimeSeries{Name: "count"}
+	for _, r := range results {
+		var timestamp int64
+		var value float64
+		for _, f := range r {
+			field := aws.StringValue(f.Field)
+			switch {
+			case strings.HasPrefix(field, "bin("):
+				ts, err := parseInsightsTime(aws.StringValue(f.Value))
+				if err != nil {
+					return nil, err
+				}
+				timestamp = ts
+			case field == "count":
+				v, err := strconv.ParseFloat(aws.StringValue(f.Value), 64)
+				if err != nil {
+					return nil, err
+				}
+				value = v
+			}
+		}
+		series.Points = append(series.Points, &datasource.Point{Timestamp: timestamp, Value: value})
+	}
+	return series, nil
+}
+
+// handleAutoInsightsTarget runs an "auto" engine target on Insights and returns it in the same shape as a FilterLogEvents result.
+func (t *AwsCloudWatchLogsDatasource) handleAutoInsightsTarget(svc *cloudwatchlogs.CloudWatchLogs, dsInfo *DatasourceInfo, target *Target, queryString string, from int64, to int64, quota orgQuota) (*datasource.QueryResult, error) {
+	limit := quota.maxEvents()
+	if target.Input.Limit != nil && *target.Input.Limit < limit {
+		limit = *target.Input.Limit
+	}
+	input := &cloudwatchlogs.StartQueryInput{
+		LogGroupName: target.Input.LogGroupName,
+		QueryString:  aws.String(queryString),
+		StartTime:    aws.Int64(from / 1000),
+		EndTime:      aws.Int64(to / 1000),
+	}
+	if target.hasMultipleLogGroups() {
+		groups, err := expandLogGroupNames(svc, aws.StringValue(target.Input.LogGroupName))
+		if err != nil {
+			return nil, err
+		}
+		if len(groups) > insightsMaxLogGroups {
+			return nil, fmt.Errorf("insights queries read at most %d log groups, %d matched", insightsMaxLogGroups, len(groups))
+		}
+		input.LogGroupName = nil
+		input.LogGroupNames = aws.StringSlice(groups)
+	}
+
+	apiStart := time.Now()
+	var results [][]*cloudwatchlogs.ResultField
+	var budgetWarning string
+	stats := &queryStats{Engine: "insights"}
+	meta := resultMeta{Stats: stats, QueryString: queryString}
+	if target.Format == "timeserie" {
+		input.Limit = aws.Int64(insightsMaxResultRows)
+		gresp, warning, err := runInsightsQuery(svc, input, dsInfo.ScanBudgetGB, quota.deadline)
+		if err != nil {
+			return nil, err
+		}
+		results, budgetWarning = gresp.Results, warning
+		if gresp.Statistics != nil {
+			stats.BytesScanned = aws.Float64Value(gresp.Statistics.BytesScanned)
+		}
+	} else {
+		split := &insightsSplit{seen: make(map[string]bool)}
+		if err := runSplitInsightsQuery(svc, input, dsInfo.ScanBudgetGB, quota.deadline, limit, split); err != nil {
+			return nil, err
+		}
+		results, budgetWarning = split.results, split.warning
+		stats.BytesScanned = split.bytesScanned
+		if split.queries > 1 {
+			meta.Warnings = append(meta.Warnings, fmt.Sprintf("the time range was split into %d Insights queries to go beyond the limit of %d rows per query", split.queries, insightsMaxResultRows))
+		}
+	}
+	stats.ApiTimeMs = time.Since(apiStart).Nanoseconds() / int64(time.Millisecond)
+	stats.EstimatedCost = estimateInsightsCost(stats.BytesScanned, dsInfo.insightsPricePerGB())
+	if budgetWarning != "" {
+		stats.Truncated = budgetWarning
+		meta.Warnings = append(meta.Warnings, budgetWarning)
+	}
+
+	var r *datasource.QueryResult
+	if target.Format == "timeserie" {
+		series, err := insightsResultsToCountSeries(results)
+		if err != nil {
+			return nil, err
+		}
+		stats.Events = len(series.Points)
+		r = &datasource.QueryResult{
+			RefId:  target.RefId,
+			Series: []*datasource.TimeSeries{series},
+		}
+	} else {
+		events, err := insightsResultsToEvents(results)
+		if err != nil {
+			return nil, err
+		}
+		stats.Events = len(events)
+		if int64(len(events)) >= limit {
+			stats.Truncated = fmt.Sprintf("the limit of %d events per response was reached", limit)
+			meta.Warnings = append(meta.Warnings, "results are truncated: "+stats.Truncated)
+		}
+		r, err = formatResult(target, &cloudwatchlogs.FilterLogEventsOutput{Events: events})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	metaJson, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	unshiftSeries(r.Series, target.shiftMs)
+	r.MetaJson = string(metaJson)
+	return r, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestFilterPatternToInsights(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		ok      bool
+	}{
+		{"", "", true},
+		{"  ", "", true},
+		{"ERROR", `@message like "ERROR"`, true},
+		{"ERROR timeout", `@message like "ERROR" and @message like "timeout"`, true},
+		{`"connection reset"`, `@message like "connection reset"`, true},
+		{"ERROR -healthcheck", `@message like "ERROR" and @message not like "healthcheck"`, true},
+		{"?ERROR ?WARN", `(@message like "ERROR" or @message like "WARN")`, true},
+		{`say "hi`, "", false},
+		{"?ERROR timeout", "", false},
+		{`{ $.level = "error" }`, "", false},
+		{"[ip, user, status=500]", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := filterPatternToInsights(tt.pattern)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("filterPatternToInsights(%q) = %q, %v, want %q, %v", tt.pattern, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// maxInsightsVariableValues bounds the values of an Insights variable, which a dropdown can not show usefully beyond that.
+const maxInsightsVariableValues = 1000
+
+// insightsVariableQuery runs an Insights query over the dashboard time range, and returns the distinct values of the first
+// field of its results, e.g. for `stats count() by service | fields service`. Internal fields such as @ptr are ignored.
+func (t *AwsCloudWatchLogsDatasource) insightsVariableQuery(svc *cloudwatchlogs.CloudWatchLogs, tsdbReq *datasource.DatasourceRequest, dsInfo *DatasourceInfo, parameters *simplejson.Json) ([]suggestData, error) {
+	queryString := parameters.Get("queryString").MustString()
+	logGroupName := parameters.Get("logGroupName").MustString()
+	if queryString == "" || logGroupName == "" {
+		return nil, fmt.Errorf("logGroupName and queryString are required")
+	}
+	from, to, err := parseTimeRange(tsdbReq.TimeRange, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	input := &cloudwatchlogs.StartQueryInput{
+		QueryString: aws.String(queryString),
+		StartTime:   aws.Int64(from / 1000),
+		EndTime:     aws.Int64(to / 1000),
+		Limit:       aws.Int64(maxInsightsVariableValues),
+	}
+	names := strings.Split(logGroupName, ",")
+	if len(names) > 1 {
+		input.LogGroupNames = aws.StringSlice(names)
+	} else {
+		input.LogGroupName = aws.String(logGroupName)
+	}
+	gresp, _, err := runInsightsQuery(svc, input, dsInfo.ScanBudgetGB, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]suggestData, 0)
+	seen := make(map[string]bool)
+	for _, row := range gresp.Results {
+		for _, f := range row {
+			if strings.HasPrefix(aws.StringValue(f.Field), "@ptr") {
+				continue
+			}
+			v := aws.StringValue(f.Value)
+			if v != "" && !seen[v] {
+				seen[v] = true
+				data = append(data, suggestData{Text: v, Value: v})
+			}
+			break
+		}
+	}
+	return data, nil
+}
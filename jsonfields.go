@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+const (
+	defaultJsonFieldsSampleSize = 200
+	maxJsonFieldExampleSize     = 100
+)
+
+type jsonField struct {
+	Field       string
+	Type        string
+	Example     string
+	Occurrences int
+}
+
+// jsonFieldsQuery samples the most recent events of a log group and returns the names of their JSON fields,
+// with their type and an example value, so that the query editor can complete $.field selectors and field settings.
+func (t *AwsCloudWatchLogsDatasource) jsonFieldsQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	logGroupName := parameters.Get("logGroupName").MustString()
+	if logGroupName == "" {
+		return nil, fmt.Errorf("logGroupName is required")
+	}
+	svc, err := t.getClient(tsdbReq.Datasource, parameters.Get("region").MustString())
+	if err != nil {
+		return nil, err
+	}
+	input := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:  aws.String(logGroupName),
+		FilterPattern: aws.String(parameters.Get("filterPattern").MustString()),
+	}
+	t.auditResourceQuery(tsdbReq.Datasource, "jsonFieldsQuery", &Target{RefId: tsdbReq.Queries[0].RefId, Region: parameters.Get("region").MustString(), Input: *input}, 0, 0)
+	resp, _, err := t.getLastEvents(svc, input, defaultJsonFieldsSampleSize, quotaForOrg(tsdbReq.Datasource.OrgId), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]*jsonField)
+	for _, e := range resp.Events {
+		var message map[string]interface{}
+		if err := json.Unmarshal([]byte(aws.StringValue(e.Message)), &message); err != nil {
+			continue
+		}
+		collectJsonFields("", message, fields)
+	}
+	sorted := make([]*jsonField, 0, len(fields))
+	for _, f := range fields {
+		sorted = append(sorted, f)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Field < sorted[j].Field })
+
+	table := &datasource.Table{
+		Columns: []*datasource.TableColumn{{Name: "Field"}, {Name: "Selector"}, {Name: "Type"}, {Name: "Example"}, {Name: "Occurrences"}},
+	}
+	for _, f := range sorted {
+		table.Rows = append(table.Rows, &datasource.TableRow{
+			Values: []*datasource.RowValue{
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: f.Field},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: "$." + f.Field},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: f.Type},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: f.Example},
+				{Kind: datasource.RowValue_TYPE_INT64, Int64Value: int64(f.Occurrences)},
+			},
+		})
+	}
+	return &datasource.QueryResult{
+		Tables: []*datasource.Table{table},
+	}, nil
+}
+
+// collectJsonFields records the fields of an object under dotted names, as flattenFields does,
+// keeping the first non empty value seen as the example.
+func collectJsonFields(prefix string, object map[string]interface{}, fields map[string]*jsonField) {
+	for k, v := range object {
+		name := k
+		if prefix != "" {
+			name = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]interface{}); ok {
+			collectJsonFields(name, nested, fields)
+			continue
+		}
+		f, ok := fields[name]
+		if !ok {
+			f = &jsonField{Field: name}
+			fields[name] = f
+		}
+		f.Occurrences++
+		if f.Type == "" || f.Type == "null" {
+			f.Type = jsonTypeName(v)
+		}
+		if f.Example == "" && v != nil {
+			example, _ := json.Marshal(v)
+			if s, ok := v.(string); ok {
+				example = []byte(s)
+			}
+			if len(example) > maxJsonFieldExampleSize {
+				example = append(example[:maxJsonFieldExampleSize], "..."...)
+			}
+			f.Example = string(example)
+		}
+	}
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case nil:
+		return "null"
+	}
+	return "object"
+}
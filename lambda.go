@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+const lambdaLogGroupPrefix = "/aws/lambda/"
+
+// applyLambdaFunction sets the log group of the Lambda function of the target.
+// Lambda names log streams like "2019/10/25/[$LATEST]0123abcd", so a version or alias qualifier restricts the query
+// to the streams of that version, or of the versions an alias routes to.
+func (t *AwsCloudWatchLogsDatasource) applyLambdaFunction(datasourceInfo *datasource.DatasourceInfo, target *Target) error {
+	if target.LambdaFunction == "" {
+		return nil
+	}
+	logGroupName := aws.String(lambdaLogGroupPrefix + target.LambdaFunction)
+	target.Input.LogGroupName = logGroupName
+	target.InputInsightsStartQuery.LogGroupName = logGroupName
+	target.InputInsightsStartQuery.LogGroupNames = nil
+
+	qualifier := strings.TrimSpace(target.LambdaQualifier)
+	if qualifier == "" {
+		return nil
+	}
+	if _, err := strconv.Atoi(qualifier); err == nil || qualifier == "$LATEST" {
+		target.lambdaVersions = []string{qualifier}
+		return nil
+	}
+
+	sess, err := t.getSession(datasourceInfo, target.Region)
+	if err != nil {
+		return err
+	}
+	svc := lambda.New(sess)
+	alias, err := svc.GetAlias(&lambda.GetAliasInput{
+		FunctionName: aws.String(target.LambdaFunction),
+		Name:         aws.String(qualifier),
+	})
+	if err != nil {
+		return err
+	}
+	target.lambdaVersions = []string{aws.StringValue(alias.FunctionVersion)}
+	if alias.RoutingConfig != nil {
+		for v := range alias.RoutingConfig.AdditionalVersionWeights {
+			target.lambdaVersions = append(target.lambdaVersions, v)
+		}
+	}
+	return nil
+}
+
+func lambdaStreamMarker(version string) string {
+	return "[" + version + "]"
+}
+
+// lambdaVersionsInsightsFilter returns the Logs Insights command which keeps the log streams of the given versions.
+func lambdaVersionsInsightsFilter(versions []string) string {
+	markers := make([]string, 0, len(versions))
+	for _, v := range versions {
+		markers = append(markers, "@logStream like "+strconv.Quote(lambdaStreamMarker(v)))
+	}
+	return "filter " + strings.Join(markers, " or ")
+}
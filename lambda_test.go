@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestLambdaVersionsInsightsFilter(t *testing.T) {
+	tests := []struct {
+		versions []string
+		want     string
+	}{
+		{[]string{"$LATEST"}, `filter @logStream like "[$LATEST]"`},
+		{[]string{"3"}, `filter @logStream like "[3]"`},
+		{[]string{"3", "4"}, `filter @logStream like "[3]" or @logStream like "[4]"`},
+	}
+	for _, tt := range tests {
+		if got := lambdaVersionsInsightsFilter(tt.versions); got != tt.want {
+			t.Errorf("lambdaVersionsInsightsFilter(%v) = %q, want %q", tt.versions, got, tt.want)
+		}
+	}
+}
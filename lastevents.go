@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+const (
+	lastEventsInitialWindow = 1 * time.Hour
+	lastEventsMaxLookback   = 30 * 24 * time.Hour
+)
+
+func (s *queryStats) merge(o *queryStats) {
+	s.Pages += o.Pages
+	s.ApiTimeMs += o.ApiTimeMs
+	s.MessageBytes += o.MessageBytes
+	if o.SearchedLogStreams > s.SearchedLogStreams {
+		s.SearchedLogStreams = o.SearchedLogStreams
+	}
+	if s.Truncated == "" {
+		s.Truncated = o.Truncated
+	}
+	if s.PartialError == "" {
+		s.PartialError = o.PartialError
+	}
+}
+
+func newestEvents(events []*cloudwatchlogs.FilteredLogEvent, n int64) []*cloudwatchlogs.FilteredLogEvent {
+	sort.SliceStable(events, func(i, j int) bool { return *events[i].Timestamp < *events[j].Timestamp })
+	if int64(len(events)) > n {
+		return events[int64(len(events))-n:]
+	}
+	return events
+}
+
+// splitTimeRange splits the inclusive range between start and end in two ranges which do not overlap,
+// and returns the end of the older one and the start of the newer one.
+func splitTimeRange(start int64, end int64) (int64, int64) {
+	mid := start + (end-start)/2
+	return mid, mid + 1
+}
+
+// getLastEvents collects the n most recent matching events regardless of the dashboard time range,
+// looking further back from now with a doubling window until enough events are found.
+func (t *AwsCloudWatchLogsDatasource) getLastEvents(svc *cloudwatchlogs.CloudWatchLogs, input *cloudwatchlogs.FilterLogEventsInput, n int64, quota orgQuota, includeStream func(name string) bool) (*cloudwatchlogs.FilterLogEventsOutput, *queryStats, error) {
+	if max := quota.maxEvents(); n > max {
+		n = max
+	}
+	stats := &queryStats{Engine: "filter"}
+	var events []*cloudwatchlogs.FilteredLogEvent
+
+	now := time.Now()
+	end := now.UnixNano() / int64(time.Millisecond)
+	window := lastEventsInitialWindow
+	for int64(len(events)) < n {
+		start := now.Add(-window).UnixNano() / int64(time.Millisecond)
+		older, err := t.newestEventsBetween(svc, input, start, end, n-int64(len(events)), quota, includeStream, stats)
+		if err != nil {
+			return nil, nil, err
+		}
+		events = append(older, events...)
+		if window >= lastEventsMaxLookback {
+			break
+		}
+		// the time range of FilterLogEvents includes its end, so that the next window ends before this one starts
+		end = start - 1
+		window *= 2
+		if window > lastEventsMaxLookback {
+			window = lastEventsMaxLookback
+		}
+	}
+	stats.Events = len(events)
+
+	return &cloudwatchlogs.FilterLogEventsOutput{Events: events}, stats, nil
+}
+
+// newestEventsBetween returns up to n of the newest events between start and end.
+// FilterLogEvents returns the oldest events first, so a range which may hold more than n events is split in half, newer half first.
+func (t *AwsCloudWatchLogsDatasource) newestEventsBetween(svc *cloudwatchlogs.CloudWatchLogs, input *cloudwatchlogs.FilterLogEventsInput, start int64, end int64, n int64, quota orgQuota, includeStream func(name string) bool, stats *queryStats) ([]*cloudwatchlogs.FilteredLogEvent, error) {
+	i := *input
+	i.StartTime = aws.Int64(start)
+	i.EndTime = aws.Int64(end)
+	i.Limit = aws.Int64(n)
+	resp, s, err := t.getLogEvent(svc, &i, false, quota, includeStream, nil)
+	if err != nil {
+		return nil, err
+	}
+	stats.merge(s)
+	if int64(len(resp.Events)) < n || end-start <= 1000 {
+		return newestEvents(resp.Events, n), nil
+	}
+
+	olderEnd, newerStart := splitTimeRange(start, end)
+	newer, err := t.newestEventsBetween(svc, input, newerStart, end, n, quota, includeStream, stats)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(newer)) >= n {
+		return newer, nil
+	}
+	older, err := t.newestEventsBetween(svc, input, start, olderEnd, n-int64(len(newer)), quota, includeStream, stats)
+	if err != nil {
+		return nil, err
+	}
+	return append(older, newer...), nil
+}
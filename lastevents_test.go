@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+func TestSplitTimeRange(t *testing.T) {
+	tests := []struct {
+		start, end           int64
+		olderEnd, newerStart int64
+	}{
+		{0, 1, 0, 1},
+		{0, 2000, 1000, 1001},
+		{1000, 4001, 2500, 2501},
+		{1565000000000, 1565000003600, 1565000001800, 1565000001801},
+	}
+	for _, tt := range tests {
+		olderEnd, newerStart := splitTimeRange(tt.start, tt.end)
+		if olderEnd != tt.olderEnd || newerStart != tt.newerStart {
+			t.Errorf("splitTimeRange(%d, %d) = %d, %d, want %d, %d", tt.start, tt.end, olderEnd, newerStart, tt.olderEnd, tt.newerStart)
+		}
+		if olderEnd < tt.start || newerStart > tt.end || newerStart != olderEnd+1 {
+			t.Errorf("splitTimeRange(%d, %d) = %d, %d, the ranges overlap or leave a gap", tt.start, tt.end, olderEnd, newerStart)
+		}
+	}
+}
+
+func TestNewestEvents(t *testing.T) {
+	events := func(ts ...int64) []*cloudwatchlogs.FilteredLogEvent {
+		var e []*cloudwatchlogs.FilteredLogEvent
+		for _, t := range ts {
+			e = append(e, &cloudwatchlogs.FilteredLogEvent{Timestamp: aws.Int64(t)})
+		}
+		return e
+	}
+	tests := []struct {
+		events []*cloudwatchlogs.FilteredLogEvent
+		n      int64
+		want   []int64
+	}{
+		{events(), 3, nil},
+		{events(3, 1, 2), 5, []int64{1, 2, 3}},
+		{events(3, 1, 2, 5, 4), 2, []int64{4, 5}},
+	}
+	for _, tt := range tests {
+		var got []int64
+		for _, e := range newestEvents(tt.events, tt.n) {
+			got = append(got, *e.Timestamp)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("newestEvents(%d) = %v, want %v", tt.n, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("newestEvents(%d) = %v, want %v", tt.n, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+// exploreUrl returns the path of Grafana Explore running the query over its time range.
+// The plugin does not know the root URL of Grafana, so the path is relative to it.
+func (target *Target) exploreUrl(datasourceInfo *datasource.DatasourceInfo) (string, error) {
+	query := map[string]interface{}{
+		"refId":  "A",
+		"region": target.Region,
+		"format": "table",
+	}
+	if target.UseInsights {
+		query["useInsights"] = true
+		query["queryString"] = aws.StringValue(target.InputInsightsStartQuery.QueryString)
+		query["logGroupName"] = strings.Join(target.insightsLogGroupNames(), ",")
+	} else {
+		query["logGroupName"] = aws.StringValue(target.Input.LogGroupName)
+		query["logStreamNames"] = aws.StringValueSlice(target.Input.LogStreamNames)
+		query["filterPattern"] = aws.StringValue(target.Input.FilterPattern)
+	}
+	state, err := json.Marshal([]interface{}{
+		strconv.FormatInt(target.From, 10),
+		strconv.FormatInt(target.To, 10),
+		datasourceInfo.Name,
+		query,
+	})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/explore?orgId=%d&left=%s", datasourceInfo.OrgId, url.QueryEscape(string(state))), nil
+}
+
+// consoleUrl returns the URL of the CloudWatch console showing the events of the query,
+// in Logs Insights for Insights queries and in the log events of the log group otherwise.
+// There is none for log group ARNs, whose log groups may belong to another account.
+func (target *Target) consoleUrl() string {
+	logGroupNames := []string{aws.StringValue(target.Input.LogGroupName)}
+	if target.UseInsights {
+		logGroupNames = target.insightsLogGroupNames()
+	}
+	for _, g := range logGroupNames {
+		if isLogGroupArn(g) {
+			return ""
+		}
+	}
+	base := fmt.Sprintf("https://%s.console.aws.amazon.com/cloudwatch/home?region=%s#logsV2:", target.Region, target.Region)
+	if !target.UseInsights {
+		return base + "log-groups/log-group/" + consoleEscape(aws.StringValue(target.Input.LogGroupName)) +
+			"/log-events$3FfilterPattern$3D" + consoleEscape(aws.StringValue(target.Input.FilterPattern)) +
+			fmt.Sprintf("$26start$3D%d$26end$3D%d", target.From, target.To)
+	}
+
+	sources := make([]string, 0)
+	for _, g := range target.insightsLogGroupNames() {
+		sources = append(sources, "~'"+insightsConsoleEscape(g))
+	}
+	detail := fmt.Sprintf("~(end~'%s~start~'%s~timeType~'ABSOLUTE~tz~'UTC~editorString~'%s~isLiveTail~false~source~(%s))",
+		insightsConsoleEscape(consoleTime(target.To)),
+		insightsConsoleEscape(consoleTime(target.From)),
+		insightsConsoleEscape(aws.StringValue(target.InputInsightsStartQuery.QueryString)),
+		strings.Join(sources, ""))
+	return base + "logs-insights$3FqueryDetail$3D" + detail
+}
+
+func (target *Target) insightsLogGroupNames() []string {
+	if target.InputInsightsStartQuery.LogGroupNames != nil {
+		return aws.StringValueSlice(target.InputInsightsStartQuery.LogGroupNames)
+	}
+	return []string{aws.StringValue(target.InputInsightsStartQuery.LogGroupName)}
+}
+
+// consoleEscape encodes a value in the fragment of a console URL, which is escaped twice and uses $ instead of %.
+// The delimiters of the fragment are escaped once only.
+func consoleEscape(s string) string {
+	return strings.Replace(url.QueryEscape(url.QueryEscape(s)), "%", "$", -1)
+}
+
+// insightsConsoleEscape encodes a value of the Logs Insights query detail, which uses * instead of %.
+func insightsConsoleEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "*%02x", c)
+		}
+	}
+	return b.String()
+}
+
+func consoleTime(ms int64) string {
+	return time.Unix(0, ms*int64(time.Millisecond)).UTC().Format("2006-01-02T15:04:05.000Z")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+func TestConsoleEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"ERROR", "ERROR"},
+		{"/aws/lambda/foo", "$252Faws$252Flambda$252Ffoo"},
+		{`"ERROR" timeout`, "$2522ERROR$2522$2Btimeout"},
+		{"[ip, user]", "$255Bip$252C$2Buser$255D"},
+	}
+	for _, tt := range tests {
+		if got := consoleEscape(tt.in); got != tt.want {
+			t.Errorf("consoleEscape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestConsoleUrl(t *testing.T) {
+	tests := []struct {
+		name   string
+		target Target
+		want   string
+	}{
+		{
+			name: "log events",
+			target: Target{
+				Region: "us-east-1",
+				Input: cloudwatchlogs.FilterLogEventsInput{
+					LogGroupName:  aws.String("/aws/lambda/foo"),
+					FilterPattern: aws.String(`"ERROR"`),
+				},
+				From: 1565000000000,
+				To:   1565003600000,
+			},
+			want: "https://us-east-1.console.aws.amazon.com/cloudwatch/home?region=us-east-1#logsV2:log-groups/log-group/$252Faws$252Flambda$252Ffoo/log-events$3FfilterPattern$3D$2522ERROR$2522$26start$3D1565000000000$26end$3D1565003600000",
+		},
+		{
+			name: "logs insights",
+			target: Target{
+				Region:      "eu-west-1",
+				UseInsights: true,
+				InputInsightsStartQuery: cloudwatchlogs.StartQueryInput{
+					LogGroupName: aws.String("/aws/lambda/foo"),
+					QueryString:  aws.String("fields @message"),
+				},
+				From: 1565000000000,
+				To:   1565003600000,
+			},
+			want: "https://eu-west-1.console.aws.amazon.com/cloudwatch/home?region=eu-west-1#logsV2:logs-insights$3FqueryDetail$3D~(end~'2019-08-05T11*3a13*3a20.000Z~start~'2019-08-05T10*3a13*3a20.000Z~timeType~'ABSOLUTE~tz~'UTC~editorString~'fields*20*40message~isLiveTail~false~source~(~'*2faws*2flambda*2ffoo))",
+		},
+		{
+			name: "log group arn",
+			target: Target{
+				Region: "us-east-1",
+				Input: cloudwatchlogs.FilterLogEventsInput{
+					LogGroupName: aws.String("arn:aws:logs:us-east-1:123456789012:log-group:foo"),
+				},
+			},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		if got := tt.target.consoleUrl(); got != tt.want {
+			t.Errorf("%s: consoleUrl() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// loadMoreQuery continues a truncated table query from the NextToken of its result meta,
+// so that the panel can load the following events on demand.
+func (t *AwsCloudWatchLogsDatasource) loadMoreQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	nextToken := parameters.Get("nextToken").MustString()
+	if nextToken == "" {
+		return nil, fmt.Errorf("nextToken is required")
+	}
+	targetJson, err := parameters.Get("target").MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	target := Target{}
+	if err := json.Unmarshal(targetJson, &target); err != nil {
+		return nil, err
+	}
+	if target.LastN > 0 || target.hasMultipleLogGroups() {
+		return nil, fmt.Errorf("last N events and multiple log groups queries can not be continued")
+	}
+
+	dsInfo, err := t.getDsInfo(tsdbReq.Datasource, "")
+	if err != nil {
+		return nil, err
+	}
+	fromRaw, toRaw, err := parseTimeRange(tsdbReq.TimeRange, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := t.prepareTarget(tsdbReq, dsInfo, &target, fromRaw, toRaw); err != nil {
+		return nil, err
+	}
+	target.Input.NextToken = aws.String(nextToken)
+	t.auditResourceQuery(tsdbReq.Datasource, "loadMoreQuery", &target, target.From, target.To)
+
+	svc, err := t.getClient(tsdbReq.Datasource, target.Region)
+	if err != nil {
+		return nil, err
+	}
+	includeStream, err := target.logStreamFilter()
+	if err != nil {
+		return nil, err
+	}
+	quota := quotaForOrg(tsdbReq.Datasource.OrgId).withDeadline(queryDeadline(ctx, dsInfo))
+	resp, stats, err := t.getLogEvent(svc, &target.Input, target.StartFromHead, quota.withPageBudget(dsInfo.ScanBudgetPages), includeStream, nil)
+	if err != nil {
+		return nil, err
+	}
+	target.Format = "table"
+	r, err := formatResult(&target, resp)
+	if err != nil {
+		return nil, err
+	}
+	metaJson, err := json.Marshal(resultMeta{Stats: stats, NextToken: aws.StringValue(resp.NextToken)})
+	if err != nil {
+		return nil, err
+	}
+	r.MetaJson = string(metaJson)
+	return r, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+const (
+	defaultLogContextLines = 10
+	maxLogContextLines     = 1000
+	logContextMaxPages     = 10
+)
+
+// logContextQuery returns the events logged to the same stream before and after the selected event, including the event itself.
+func (t *AwsCloudWatchLogsDatasource) logContextQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	logGroupName := parameters.Get("logGroupName").MustString()
+	logStreamName := parameters.Get("logStreamName").MustString()
+	timestamp, err := parameters.Get("timestamp").Int64()
+	if logGroupName == "" || logStreamName == "" || err != nil {
+		return nil, fmt.Errorf("logGroupName, logStreamName and timestamp are required")
+	}
+	before := parameters.Get("before").MustInt64(defaultLogContextLines)
+	after := parameters.Get("after").MustInt64(defaultLogContextLines)
+	if before < 0 || after < 0 || before > maxLogContextLines || after > maxLogContextLines {
+		return nil, fmt.Errorf("before and after should be between 0 and %d", maxLogContextLines)
+	}
+	t.auditResourceQuery(tsdbReq.Datasource, "logContextQuery", &Target{
+		RefId:  tsdbReq.Queries[0].RefId,
+		Region: parameters.Get("region").MustString(),
+		Input: cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName:   aws.String(logGroupName),
+			LogStreamNames: aws.StringSlice([]string{logStreamName}),
+		},
+	}, timestamp, timestamp)
+	svc, err := t.getClient(tsdbReq.Datasource, parameters.Get("region").MustString())
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*cloudwatchlogs.OutputLogEvent
+	if before > 0 {
+		e, err := getContextEvents(ctx, svc, &cloudwatchlogs.GetLogEventsInput{
+			LogGroupName:  aws.String(logGroupName),
+			LogStreamName: aws.String(logStreamName),
+			EndTime:       aws.Int64(timestamp),
+			StartFromHead: aws.Bool(false),
+			Limit:         aws.Int64(before),
+		}, before, false)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e...)
+	}
+	e, err := getContextEvents(ctx, svc, &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  aws.String(logGroupName),
+		LogStreamName: aws.String(logStreamName),
+		StartTime:     aws.Int64(timestamp),
+		StartFromHead: aws.Bool(true),
+		Limit:         aws.Int64(after + 1),
+	}, after+1, true)
+	if err != nil {
+		return nil, err
+	}
+	events = append(events, e...)
+
+	resp := &cloudwatchlogs.FilterLogEventsOutput{}
+	for _, e := range events {
+		resp.Events = append(resp.Events, &cloudwatchlogs.FilteredLogEvent{
+			LogStreamName: aws.String(logStreamName),
+			IngestionTime: e.IngestionTime,
+			Message:       e.Message,
+			Timestamp:     e.Timestamp,
+		})
+	}
+	return parseTableResponse(resp, "")
+}
+
+// getContextEvents reads up to n events, following the pages forward or backward since GetLogEvents may return fewer events than requested.
+func getContextEvents(ctx context.Context, svc *cloudwatchlogs.CloudWatchLogs, input *cloudwatchlogs.GetLogEventsInput, n int64, forward bool) ([]*cloudwatchlogs.OutputLogEvent, error) {
+	var events []*cloudwatchlogs.OutputLogEvent
+	for i := 0; i < logContextMaxPages && int64(len(events)) < n; i++ {
+		resp, err := svc.GetLogEventsWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		next := resp.NextBackwardToken
+		if forward {
+			events = append(events, resp.Events...)
+			next = resp.NextForwardToken
+		} else {
+			events = append(resp.Events, events...)
+		}
+		if next == nil || aws.StringValue(next) == aws.StringValue(input.NextToken) {
+			break
+		}
+		input.NextToken = next
+	}
+
+	if int64(len(events)) > n {
+		if forward {
+			events = events[:n]
+		} else {
+			events = events[int64(len(events))-n:]
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	hclog "github.com/hashicorp/go-hclog"
+)
+
+var pluginLogger = hclog.New(&hclog.LoggerOptions{
+	Name:       "aws-cloudwatch-logs-datasource",
+	Level:      hclog.Info,
+	Output:     os.Stderr,
+	JSONFormat: true,
+})
+
+func parseLogLevel(level string) hclog.Level {
+	switch strings.ToLower(level) {
+	case "trace":
+		return hclog.Trace
+	case "debug":
+		return hclog.Debug
+	case "warn":
+		return hclog.Warn
+	case "error":
+		return hclog.Error
+	default:
+		return hclog.Info
+	}
+}
+
+func newQueryId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// newQueryLogger returns a logger tagged with a generated query ID, using the log level configured on the datasource.
+func (t *AwsCloudWatchLogsDatasource) newQueryLogger(datasourceInfo *datasource.DatasourceInfo) hclog.Logger {
+	level := hclog.Info
+	if dsInfo, err := t.getDsInfo(datasourceInfo, ""); err == nil {
+		level = parseLogLevel(dsInfo.LogLevel)
+	}
+
+	return hclog.New(&hclog.LoggerOptions{
+		Name:       "aws-cloudwatch-logs-datasource",
+		Level:      level,
+		Output:     os.Stderr,
+		JSONFormat: true,
+	}).With("queryId", newQueryId(), "datasourceId", datasourceInfo.Id)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// logGroupIdentifierFields lists the parameters which take a log group ARN instead of a name, for log groups shared
+// with a monitoring account. The SDK predates these parameters, so the JSON body of the request is rewritten.
+var logGroupIdentifierFields = map[string]string{
+	"FilterLogEvents":    "logGroupIdentifier",
+	"GetLogEvents":       "logGroupIdentifier",
+	"DescribeLogStreams": "logGroupIdentifier",
+	"StartQuery":         "logGroupIdentifiers",
+}
+
+func isLogGroupArn(name string) bool {
+	return strings.HasPrefix(name, "arn:")
+}
+
+// rewriteLogGroupArns is a build handler moving log group ARNs given as log group names to the identifier parameters.
+func rewriteLogGroupArns(r *request.Request) {
+	field, ok := logGroupIdentifierFields[r.Operation.Name]
+	if !ok || r.Error != nil {
+		return
+	}
+	editJsonBody(r, func(body map[string]interface{}) bool {
+		names := make([]interface{}, 0)
+		if n, ok := body["logGroupName"].(string); ok {
+			names = append(names, n)
+		}
+		if ns, ok := body["logGroupNames"].([]interface{}); ok {
+			names = append(names, ns...)
+		}
+		hasArn := false
+		for _, n := range names {
+			if s, ok := n.(string); ok && isLogGroupArn(s) {
+				hasArn = true
+			}
+		}
+		if !hasArn {
+			return false
+		}
+		delete(body, "logGroupName")
+		delete(body, "logGroupNames")
+		if strings.HasSuffix(field, "s") {
+			body[field] = names
+		} else {
+			body[field] = names[0]
+		}
+		return true
+	})
+}
+
+// withJsonFields returns a build handler adding parameters unknown to the SDK to the request.
+func withJsonFields(fields map[string]interface{}) func(r *request.Request) {
+	return func(r *request.Request) {
+		editJsonBody(r, func(body map[string]interface{}) bool {
+			for k, v := range fields {
+				body[k] = v
+			}
+			return true
+		})
+	}
+}
+
+func editJsonBody(r *request.Request, edit func(body map[string]interface{}) bool) {
+	if r.Body == nil {
+		return
+	}
+	if _, err := r.Body.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	body := make(map[string]interface{})
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &body); err != nil {
+			return
+		}
+	}
+	if !edit(body) {
+		r.Body.Seek(0, io.SeekStart)
+		return
+	}
+	b, err = json.Marshal(body)
+	if err != nil {
+		r.Error = err
+		return
+	}
+	r.SetBufferBody(b)
+}
+
+// describeLogGroupArns returns the ARNs of the log groups matching prefix, without the trailing ":*",
+// including the log groups of source accounts when the account is a monitoring account.
+func describeLogGroupArns(svc *cloudwatchlogs.CloudWatchLogs, prefix string) ([]suggestData, error) {
+	data := make([]suggestData, 0)
+	input := &cloudwatchlogs.DescribeLogGroupsInput{}
+	if prefix != "" {
+		input.LogGroupNamePrefix = aws.String(prefix)
+	}
+	for len(data) <= 100 { // safety limit
+		req, resp := svc.DescribeLogGroupsRequest(input)
+		req.Handlers.Build.PushBack(withJsonFields(map[string]interface{}{"includeLinkedAccounts": true}))
+		if err := req.Send(); err != nil {
+			return nil, err
+		}
+		for _, g := range resp.LogGroups {
+			arn := strings.TrimSuffix(aws.StringValue(g.Arn), ":*")
+			text := aws.StringValue(g.LogGroupName)
+			if parts := strings.SplitN(arn, ":", 6); len(parts) == 6 {
+				text = parts[4] + ":" + text // account ID
+			}
+			data = append(data, suggestData{Text: text, Value: arn})
+		}
+		if resp.NextToken == nil {
+			break
+		}
+		input.NextToken = resp.NextToken
+	}
+	return data, nil
+}
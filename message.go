@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// ansiEscapePattern matches CSI sequences (colors, cursor movement) and OSC sequences (e.g. terminal titles and hyperlinks).
+var ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)`)
+
+// transformMessages applies the message options of the target.
+// The events are copied, since the response may be shared with other targets of the request.
+func (target *Target) transformMessages(resp *cloudwatchlogs.FilterLogEventsOutput) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	if !target.UnescapeJsonMessage && !target.StripAnsi && !target.Multiline {
+		return resp, nil
+	}
+
+	events := make([]*cloudwatchlogs.FilteredLogEvent, 0, len(resp.Events))
+	for _, e := range resp.Events {
+		c := *e
+		message := aws.StringValue(e.Message)
+		if target.UnescapeJsonMessage {
+			message = unescapeJsonMessage(message)
+		}
+		if target.StripAnsi {
+			message = ansiEscapePattern.ReplaceAllString(message, "")
+		}
+		c.Message = aws.String(message)
+		events = append(events, &c)
+	}
+	if target.Multiline {
+		if target.MultilineStartPattern == "" {
+			// an empty pattern matches every line, so that nothing would be stitched
+			return nil, fmt.Errorf("multiline requires a start pattern")
+		}
+		startPattern, err := regexp.Compile(target.MultilineStartPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid multiline start pattern: %v", err)
+		}
+		events = stitchMultiline(events, startPattern)
+	}
+	return &cloudwatchlogs.FilterLogEventsOutput{
+		Events:             events,
+		SearchedLogStreams: resp.SearchedLogStreams,
+	}, nil
+}
+
+// stitchMultiline appends events which do not match the start-of-event pattern to the previous event of the same log stream,
+// so that stack traces split across events are shown as a single row.
+func stitchMultiline(events []*cloudwatchlogs.FilteredLogEvent, startPattern *regexp.Regexp) []*cloudwatchlogs.FilteredLogEvent {
+	sort.SliceStable(events, func(i, j int) bool { return *events[i].Timestamp < *events[j].Timestamp })
+	current := make(map[string]*cloudwatchlogs.FilteredLogEvent)
+	stitched := make([]*cloudwatchlogs.FilteredLogEvent, 0, len(events))
+	for _, e := range events {
+		stream := aws.StringValue(e.LogStreamName)
+		message := aws.StringValue(e.Message)
+		if prev, ok := current[stream]; ok && !startPattern.MatchString(message) {
+			prev.Message = aws.String(strings.TrimRight(aws.StringValue(prev.Message), "\n") + "\n" + message)
+			continue
+		}
+		current[stream] = e
+		stitched = append(stitched, e)
+	}
+	return stitched
+}
+
+// unescapeJsonMessage decodes a message which is a JSON-encoded string, as written by Lambda or Firehose wrappers.
+// Messages encoded more than once are decoded until they are no longer a JSON string.
+func unescapeJsonMessage(message string) string {
+	for i := 0; i < 3; i++ {
+		trimmed := strings.TrimSpace(message)
+		if len(trimmed) < 2 || trimmed[0] != '"' {
+			break
+		}
+		var s string
+		if err := json.Unmarshal([]byte(trimmed), &s); err != nil {
+			break
+		}
+		message = s
+	}
+	return message
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+type metricFilterResult struct {
+	FilterName      string
+	LogGroupName    string
+	FilterPattern   string
+	MetricNamespace string
+	MetricName      string
+	Replaced        bool
+}
+
+// checkWritesAllowed guards the resource queries which change AWS resources.
+// Any viewer of a dashboard can send queries, so writes are only accepted when the datasource admin enabled them.
+func (dsInfo *DatasourceInfo) checkWritesAllowed() error {
+	if !dsInfo.AllowWrites {
+		return fmt.Errorf("writes to AWS are disabled, enable them in the datasource settings")
+	}
+	return nil
+}
+
+// putMetricFilterQuery creates a metric filter from the filter pattern of a query.
+// An existing filter of the same name is only replaced when overwrite is set.
+func (t *AwsCloudWatchLogsDatasource) putMetricFilterQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	dsInfo, err := t.getDsInfo(tsdbReq.Datasource, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := dsInfo.checkWritesAllowed(); err != nil {
+		return nil, err
+	}
+
+	target := Target{
+		Region: parameters.Get("region").MustString(),
+		Input: cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName: aws.String(parameters.Get("logGroupName").MustString()),
+		},
+	}
+	filterName := parameters.Get("filterName").MustString()
+	filterPattern := parameters.Get("filterPattern").MustString()
+	namespace := parameters.Get("metricNamespace").MustString()
+	metricName := parameters.Get("metricName").MustString()
+	metricValue := parameters.Get("metricValue").MustString("1")
+	if aws.StringValue(target.Input.LogGroupName) == "" || filterName == "" || namespace == "" || metricName == "" {
+		return nil, fmt.Errorf("logGroupName, filterName, metricNamespace and metricName are required")
+	}
+	if target.hasMultipleLogGroups() || isLogGroupArn(aws.StringValue(target.Input.LogGroupName)) {
+		return nil, fmt.Errorf("a metric filter is created on a single log group, given by name")
+	}
+	if err := target.resolveRegion(dsInfo.DefaultRegion); err != nil {
+		return nil, err
+	}
+	svc, err := t.getClient(tsdbReq.Datasource, target.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := svc.DescribeMetricFiltersWithContext(ctx, &cloudwatchlogs.DescribeMetricFiltersInput{
+		LogGroupName:     target.Input.LogGroupName,
+		FilterNamePrefix: aws.String(filterName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	replaced := false
+	for _, f := range existing.MetricFilters {
+		if aws.StringValue(f.FilterName) == filterName {
+			replaced = true
+		}
+	}
+	if replaced && !parameters.Get("overwrite").MustBool() {
+		return nil, fmt.Errorf("metric filter %q already exists in %s", filterName, aws.StringValue(target.Input.LogGroupName))
+	}
+
+	transformation := &cloudwatchlogs.MetricTransformation{
+		MetricNamespace: aws.String(namespace),
+		MetricName:      aws.String(metricName),
+		MetricValue:     aws.String(metricValue),
+	}
+	if v, err := parameters.Get("defaultValue").Float64(); err == nil {
+		transformation.DefaultValue = aws.Float64(v)
+	}
+	input := &cloudwatchlogs.PutMetricFilterInput{
+		LogGroupName:          target.Input.LogGroupName,
+		FilterName:            aws.String(filterName),
+		FilterPattern:         aws.String(filterPattern),
+		MetricTransformations: []*cloudwatchlogs.MetricTransformation{transformation},
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := svc.PutMetricFilterWithContext(ctx, input); err != nil {
+		return nil, err
+	}
+	pluginLogger.Info("metric filter created",
+		"orgId", tsdbReq.Datasource.OrgId,
+		"datasourceId", tsdbReq.Datasource.Id,
+		"region", target.Region,
+		"logGroup", aws.StringValue(target.Input.LogGroupName),
+		"filterName", filterName,
+		"filterPattern", filterPattern,
+		"metric", namespace+"/"+metricName,
+		"replaced", replaced,
+	)
+
+	metaJson, err := json.Marshal(metricFilterResult{
+		FilterName:      filterName,
+		LogGroupName:    aws.StringValue(target.Input.LogGroupName),
+		FilterPattern:   filterPattern,
+		MetricNamespace: namespace,
+		MetricName:      metricName,
+		Replaced:        replaced,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &datasource.QueryResult{MetaJson: string(metaJson)}, nil
+}
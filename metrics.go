@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const metricsNamespace = "grafana_plugin_aws_cloudwatch_logs"
+
+// The plugin protocol has no metrics endpoint, so metrics are exposed in the Prometheus text format
+// on the address given by this environment variable.
+const metricsAddrEnv = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_METRICS_ADDR"
+
+type metric interface {
+	write(w io.Writer)
+}
+
+type counterVec struct {
+	name   string
+	help   string
+	label  string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name string, help string, label string) *counterVec {
+	c := &counterVec{
+		name:   metricsNamespace + "_" + name,
+		help:   help,
+		label:  label,
+		values: make(map[string]float64),
+	}
+	metricsRegistry = append(metricsRegistry, c)
+	return c
+}
+
+func (c *counterVec) inc(labelValue string) {
+	c.mu.Lock()
+	c.values[labelValue]++
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %v\n", c.name, c.label, k, c.values[k])
+	}
+}
+
+type histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	mu      sync.Mutex
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(name string, help string, buckets []float64) *histogram {
+	h := &histogram{
+		name:    metricsNamespace + "_" + name,
+		help:    help,
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+	metricsRegistry = append(metricsRegistry, h)
+	return h
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, b := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%v\"} %d\n", h.name, b, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %v\n%s_count %d\n", h.name, h.sum, h.name, h.count)
+}
+
+var metricsRegistry []metric
+
+var (
+	apiCallsTotal     = newCounterVec("api_calls_total", "Number of CloudWatch Logs API calls.", "operation")
+	apiThrottlesTotal = newCounterVec("api_throttles_total", "Number of throttled CloudWatch Logs API call attempts.", "operation")
+	apiErrorsTotal    = newCounterVec("api_errors_total", "Number of failed CloudWatch Logs API calls.", "operation")
+	queryPages        = newHistogram("query_pages", "Number of pages fetched per query.", []float64{1, 2, 5, 10, 20, 50, 100})
+	queryDuration     = newHistogram("query_duration_seconds", "Query latency in seconds.", []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30})
+)
+
+func instrumentHandlers(handlers *request.Handlers) {
+	handlers.CompleteAttempt.PushBack(func(r *request.Request) {
+		if r.Error != nil && request.IsErrorThrottle(r.Error) {
+			apiThrottlesTotal.inc(r.Operation.Name)
+		}
+	})
+	handlers.Complete.PushBack(func(r *request.Request) {
+		apiCallsTotal.inc(r.Operation.Name)
+		if r.Error != nil {
+			apiErrorsTotal.inc(r.Operation.Name)
+		}
+	})
+}
+
+// apiCallCounter counts the throttled and retried API calls of a request, so that they can be reported with each target.
+type apiCallCounter struct {
+	throttles int64
+	retries   int64
+}
+
+func (c *apiCallCounter) count(handlers *request.Handlers) {
+	handlers.CompleteAttempt.PushBack(func(r *request.Request) {
+		if r.Error != nil && request.IsErrorThrottle(r.Error) {
+			atomic.AddInt64(&c.throttles, 1)
+		}
+	})
+	handlers.Complete.PushBack(func(r *request.Request) {
+		atomic.AddInt64(&c.retries, int64(r.RetryCount))
+	})
+}
+
+// since records the calls counted after the given snapshot in stats.
+func (c *apiCallCounter) since(snapshot apiCallCounter, stats *queryStats) {
+	stats.Throttles = int(atomic.LoadInt64(&c.throttles) - snapshot.throttles)
+	stats.Retries = int(atomic.LoadInt64(&c.retries) - snapshot.retries)
+}
+
+func (c *apiCallCounter) snapshot() apiCallCounter {
+	return apiCallCounter{throttles: atomic.LoadInt64(&c.throttles), retries: atomic.LoadInt64(&c.retries)}
+}
+
+func observeQuery(stats *queryStats, started time.Time) {
+	queryPages.observe(float64(stats.Pages))
+	queryDuration.observe(time.Since(started).Seconds())
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	var b strings.Builder
+	for _, m := range metricsRegistry {
+		m.write(&b)
+	}
+	io.WriteString(w, b.String())
+}
+
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", metricsHandler)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		pluginLogger.Error("metrics server stopped", "error", err)
+	}
+}
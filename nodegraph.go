@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+type graphEdge struct {
+	source string
+	target string
+}
+
+// parseNodeGraphResponse returns the nodes and edges tables of the node graph panel, with the events of each node
+// and the calls of each edge as their main stat. Edges go from the node of an event to the callee field,
+// or, with span fields, from the node of the parent span to the node of the event.
+func (target *Target) parseNodeGraphResponse(resp *cloudwatchlogs.FilterLogEventsOutput) (*datasource.QueryResult, error) {
+	nodeKey, err := target.eventKeyFunc(target.NodeField)
+	if err != nil {
+		return nil, err
+	}
+	var calleeKey, spanKey, parentSpanKey func(e *cloudwatchlogs.FilteredLogEvent) string
+	if target.CalleeField != "" {
+		if calleeKey, err = target.eventKeyFunc(target.CalleeField); err != nil {
+			return nil, err
+		}
+	}
+	if target.SpanField != "" && target.ParentSpanField != "" {
+		if spanKey, err = target.eventKeyFunc(target.SpanField); err != nil {
+			return nil, err
+		}
+		if parentSpanKey, err = target.eventKeyFunc(target.ParentSpanField); err != nil {
+			return nil, err
+		}
+	}
+
+	nodes := make(map[string]int64)
+	edges := make(map[graphEdge]int64)
+	spanNodes := make(map[string]string)
+	parents := make([]graphEdge, 0) // node and parent span, resolved once every span is known
+	for _, e := range resp.Events {
+		node := nodeKey(e)
+		if node == "" {
+			continue
+		}
+		nodes[node]++
+		if calleeKey != nil {
+			if callee := calleeKey(e); callee != "" {
+				if _, ok := nodes[callee]; !ok {
+					nodes[callee] = 0
+				}
+				edges[graphEdge{node, callee}]++
+			}
+		}
+		if spanKey != nil {
+			if span := spanKey(e); span != "" {
+				spanNodes[span] = node
+			}
+			if parent := parentSpanKey(e); parent != "" {
+				parents = append(parents, graphEdge{source: parent, target: node})
+			}
+		}
+	}
+	for _, p := range parents {
+		if source, ok := spanNodes[p.source]; ok && source != p.target {
+			edges[graphEdge{source, p.target}]++
+		}
+	}
+
+	nodeIds := make([]string, 0, len(nodes))
+	for n := range nodes {
+		nodeIds = append(nodeIds, n)
+	}
+	sort.Strings(nodeIds)
+	nodesTable := newStringTable("id", "title", "mainStat")
+	for _, n := range nodeIds {
+		nodesTable.Rows = append(nodesTable.Rows, &datasource.TableRow{Values: []*datasource.RowValue{
+			stringValue(n),
+			stringValue(n),
+			{Kind: datasource.RowValue_TYPE_INT64, Int64Value: nodes[n]},
+		}})
+	}
+
+	edgeKeys := make([]graphEdge, 0, len(edges))
+	for e := range edges {
+		edgeKeys = append(edgeKeys, e)
+	}
+	sort.Slice(edgeKeys, func(i, j int) bool {
+		if edgeKeys[i].source != edgeKeys[j].source {
+			return edgeKeys[i].source < edgeKeys[j].source
+		}
+		return edgeKeys[i].target < edgeKeys[j].target
+	})
+	edgesTable := newStringTable("id", "source", "target", "mainStat")
+	for _, e := range edgeKeys {
+		edgesTable.Rows = append(edgesTable.Rows, &datasource.TableRow{Values: []*datasource.RowValue{
+			stringValue(e.source + "->" + e.target),
+			stringValue(e.source),
+			stringValue(e.target),
+			{Kind: datasource.RowValue_TYPE_INT64, Int64Value: edges[e]},
+		}})
+	}
+
+	return &datasource.QueryResult{
+		RefId:  target.RefId,
+		Tables: []*datasource.Table{nodesTable, edgesTable},
+	}, nil
+}
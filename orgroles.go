@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+)
+
+// orgRolesEnv maps Grafana orgs to the IAM role assumed for their queries, so that a multi-tenant Grafana
+// can restrict each org to its own log groups. It is configured by the operator, as org admins can edit the datasource settings.
+// The value is a JSON object keyed by org ID, with "default" applying to orgs without their own entry, e.g.
+//
+//	{"2": "arn:aws:iam::123456789012:role/team-a-logs", "3": "arn:aws:iam::123456789012:role/team-b-logs"}
+const orgRolesEnv = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_ORG_ROLES"
+
+var orgRoles map[string]string
+
+func init() {
+	if v := os.Getenv(orgRolesEnv); v != "" {
+		if err := json.Unmarshal([]byte(v), &orgRoles); err != nil {
+			pluginLogger.Error("failed to parse org roles", "env", orgRolesEnv, "error", err)
+		}
+	}
+}
+
+func roleForOrg(orgId int64) string {
+	if r, ok := orgRoles[strconv.FormatInt(orgId, 10)]; ok {
+		return r
+	}
+	return orgRoles["default"]
+}
+
+// applyOrgRole overrides the auth settings of the datasource with the role mapped to the org.
+// The role is assumed with the credentials of the Grafana server, never with keys stored in the datasource.
+func (dsInfo *DatasourceInfo) applyOrgRole(orgId int64) {
+	role := roleForOrg(orgId)
+	if role == "" {
+		return
+	}
+	dsInfo.AuthType = "arn"
+	dsInfo.AssumeRoleArn = role
+	dsInfo.Profile = ""
+	dsInfo.AccessKey = ""
+	dsInfo.SecretKey = ""
+	dsInfo.roleSessionName = "GrafanaOrg" + strconv.FormatInt(orgId, 10)
+}
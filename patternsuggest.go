@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+const (
+	defaultSuggestionSampleSize = 500
+	maxPatternSuggestions       = 20
+	// suggestionMaxCardinality leaves out fields such as IDs and timestamps, whose values match too few events to filter on.
+	suggestionMaxCardinality = 20
+	suggestionValuesPerField = 3
+	// suggestionMaxShare leaves out terms found in nearly every event, which do not narrow a query.
+	suggestionMaxShare = 0.8
+)
+
+var suggestionTermPattern = regexp.MustCompile(`[A-Za-z][A-Za-z_\-]{2,}`)
+
+type patternSuggestion struct {
+	Pattern string
+	Kind    string
+	Matches int
+}
+
+// patternSuggestionsQuery samples the most recent events of a log group, matching the current filter pattern if any,
+// and suggests filter patterns from them: JSON selectors on the values of fields with few distinct values,
+// and terms found in part of the events, ranked by the events they match in the sample.
+func (t *AwsCloudWatchLogsDatasource) patternSuggestionsQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	logGroupName := parameters.Get("logGroupName").MustString()
+	if logGroupName == "" {
+		return nil, fmt.Errorf("logGroupName is required")
+	}
+	svc, err := t.getClient(tsdbReq.Datasource, parameters.Get("region").MustString())
+	if err != nil {
+		return nil, err
+	}
+	input := &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:  aws.String(logGroupName),
+		FilterPattern: aws.String(parameters.Get("filterPattern").MustString()),
+	}
+	t.auditResourceQuery(tsdbReq.Datasource, "patternSuggestionsQuery", &Target{RefId: tsdbReq.Queries[0].RefId, Region: parameters.Get("region").MustString(), Input: *input}, 0, 0)
+	resp, _, err := t.getLastEvents(svc, input, defaultSuggestionSampleSize, quotaForOrg(tsdbReq.Datasource.OrgId), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := suggestPatterns(resp.Events)
+	table := &datasource.Table{
+		Columns: []*datasource.TableColumn{{Name: "Pattern"}, {Name: "Kind"}, {Name: "Matches"}, {Name: "Percent"}},
+	}
+	for _, s := range suggestions {
+		table.Rows = append(table.Rows, &datasource.TableRow{
+			Values: []*datasource.RowValue{
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: s.Pattern},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: s.Kind},
+				{Kind: datasource.RowValue_TYPE_INT64, Int64Value: int64(s.Matches)},
+				{Kind: datasource.RowValue_TYPE_DOUBLE, DoubleValue: float64(s.Matches) * 100 / float64(len(resp.Events))},
+			},
+		})
+	}
+	return &datasource.QueryResult{
+		Tables: []*datasource.Table{table},
+	}, nil
+}
+
+func suggestPatterns(events []*cloudwatchlogs.FilteredLogEvent) []patternSuggestion {
+	fields := make(map[string]map[string]int)
+	terms := make(map[string]int)
+	for _, e := range events {
+		message := aws.StringValue(e.Message)
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(message), &object); err == nil {
+			for field, value := range flattenFields("", object, make(map[string]string)) {
+				if fields[field] == nil {
+					fields[field] = make(map[string]int)
+				}
+				fields[field][value]++
+			}
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, term := range suggestionTermPattern.FindAllString(message, -1) {
+			if !seen[term] {
+				seen[term] = true
+				terms[term]++
+			}
+		}
+	}
+
+	suggestions := make([]patternSuggestion, 0)
+	for field, values := range fields {
+		if len(values) > suggestionMaxCardinality {
+			continue
+		}
+		for _, v := range topKeys(values, suggestionValuesPerField) {
+			if values[v] < 2 {
+				continue
+			}
+			suggestions = append(suggestions, patternSuggestion{Pattern: jsonSelectorPattern(field, v), Kind: "json", Matches: values[v]})
+		}
+	}
+	for term, n := range terms {
+		if n < 2 || float64(n) > suggestionMaxShare*float64(len(events)) {
+			continue
+		}
+		suggestions = append(suggestions, patternSuggestion{Pattern: termPattern(term), Kind: "term", Matches: n})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Matches != suggestions[j].Matches {
+			return suggestions[i].Matches > suggestions[j].Matches
+		}
+		return suggestions[i].Pattern < suggestions[j].Pattern
+	})
+	if len(suggestions) > maxPatternSuggestions {
+		suggestions = suggestions[:maxPatternSuggestions]
+	}
+	return suggestions
+}
+
+// jsonSelectorPattern compares a field to a value, as a number, a boolean or null when the value was one.
+func jsonSelectorPattern(field string, value string) string {
+	switch value {
+	case "true", "false", "null":
+		return fmt.Sprintf("{ $.%s IS %s }", field, strings.ToUpper(value))
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return fmt.Sprintf("{ $.%s = %s }", field, value)
+	}
+	return fmt.Sprintf("{ $.%s = %q }", field, value)
+}
+
+// termPattern quotes terms with characters other than letters and digits, as filter patterns require.
+func termPattern(term string) string {
+	for _, c := range term {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return strconv.Quote(term)
+		}
+	}
+	return term
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+var defaultPercentiles = []float64{50, 90, 95, 99}
+
+// parsePercentilesResponse returns one series per percentile of the numeric values of the field in each interval,
+// e.g. p50 and p99 latency series for SLO panels driven by request logs. The values of an interval are kept sorted
+// in memory, as the events of the query already are, so that the percentiles are exact. Events where the field
+// is missing or not a number are skipped.
+func parsePercentilesResponse(resp *cloudwatchlogs.FilterLogEventsOutput, refId string, intervalMs int64, field string, percentiles []float64, valueFunc func(e *cloudwatchlogs.FilteredLogEvent) string) (*datasource.QueryResult, error) {
+	if field == "" {
+		return nil, fmt.Errorf("the value column is required for the percentiles format")
+	}
+	if len(percentiles) == 0 {
+		percentiles = defaultPercentiles
+	}
+	for _, p := range percentiles {
+		if p < 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %v, it should be between 0 and 100", p)
+		}
+	}
+
+	buckets := make(map[int64][]float64)
+	for _, e := range resp.Events {
+		v, err := strconv.ParseFloat(valueFunc(e), 64)
+		if err != nil || math.IsNaN(v) {
+			continue
+		}
+		ts := bucketTimestamp(*e.Timestamp, intervalMs)
+		buckets[ts] = append(buckets[ts], v)
+	}
+	timestamps := make([]int64, 0, len(buckets))
+	for ts, values := range buckets {
+		sort.Float64s(values)
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	series := make([]*datasource.TimeSeries, 0, len(percentiles))
+	for _, p := range percentiles {
+		s := &datasource.TimeSeries{
+			Name: fmt.Sprintf("p%s", strconv.FormatFloat(p, 'f', -1, 64)),
+			Tags: map[string]string{"field": field},
+		}
+		for _, ts := range timestamps {
+			s.Points = append(s.Points, &datasource.Point{Timestamp: ts, Value: percentile(buckets[ts], p)})
+		}
+		series = append(series, s)
+	}
+	return &datasource.QueryResult{
+		RefId:  refId,
+		Series: series,
+	}, nil
+}
+
+// percentile interpolates linearly between the closest ranks of the sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	if lower >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (rank-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{[]float64{7}, 50, 7},
+		{[]float64{7}, 99, 7},
+		{[]float64{1, 2}, 0, 1},
+		{[]float64{1, 2}, 50, 1.5},
+		{[]float64{1, 2}, 100, 2},
+		{[]float64{1, 2, 3, 4, 5}, 50, 3},
+		{[]float64{1, 2, 3, 4, 5}, 90, 4.6},
+		{[]float64{10, 20, 30, 40}, 25, 17.5},
+		{[]float64{10, 20, 30, 40}, 100, 40},
+	}
+	for _, tt := range tests {
+		got := percentile(tt.sorted, tt.p)
+		if d := got - tt.want; d > 1e-9 || d < -1e-9 {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.sorted, tt.p, got, tt.want)
+		}
+	}
+}
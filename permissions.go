@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// permissionCheckLogGroup is used when no log group is given. It does not exist,
+// so that a not found error proves the action is allowed without reading any log.
+const permissionCheckLogGroup = "/grafana/permission-check"
+
+type permissionCheck struct {
+	action  string
+	feature string
+	call    func() error
+}
+
+// permissionsQuery calls each API the plugin uses with harmless parameters, such as unknown IDs or an invalid
+// query string, so that nothing is read or started. AWS checks permissions before parameters,
+// so any error other than access denied means the action is allowed.
+func (t *AwsCloudWatchLogsDatasource) permissionsQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	dsInfo, err := t.getDsInfo(tsdbReq.Datasource, "")
+	if err != nil {
+		return nil, err
+	}
+	target := Target{Region: parameters.Get("region").MustString()}
+	if err := target.resolveRegion(dsInfo.DefaultRegion); err != nil {
+		return nil, err
+	}
+	logGroup := parameters.Get("logGroupName").MustString(permissionCheckLogGroup)
+	svc, err := t.getClient(tsdbReq.Datasource, target.Region)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := t.getSession(tsdbReq.Datasource, target.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := sts.New(sess).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, mapAwsError(err, target.Region, logGroup)
+	}
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	unknownId := "00000000-0000-0000-0000-000000000000"
+	checks := []permissionCheck{
+		{"logs:DescribeLogGroups", "log group suggestions and variables", func() error {
+			_, err := svc.DescribeLogGroupsWithContext(ctx, &cloudwatchlogs.DescribeLogGroupsInput{Limit: aws.Int64(1)})
+			return err
+		}},
+		{"logs:DescribeLogStreams", "log stream suggestions and variables", func() error {
+			_, err := svc.DescribeLogStreamsWithContext(ctx, &cloudwatchlogs.DescribeLogStreamsInput{LogGroupName: aws.String(logGroup), Limit: aws.Int64(1)})
+			return err
+		}},
+		{"logs:FilterLogEvents", "queries", func() error {
+			_, err := svc.FilterLogEventsWithContext(ctx, &cloudwatchlogs.FilterLogEventsInput{
+				LogGroupName: aws.String(logGroup),
+				StartTime:    aws.Int64(now - 1000),
+				EndTime:      aws.Int64(now),
+				Limit:        aws.Int64(1),
+			})
+			return err
+		}},
+		{"logs:GetLogEvents", "log context", func() error {
+			_, err := svc.GetLogEventsWithContext(ctx, &cloudwatchlogs.GetLogEventsInput{
+				LogGroupName:  aws.String(logGroup),
+				LogStreamName: aws.String(unknownId),
+				Limit:         aws.Int64(1),
+			})
+			return err
+		}},
+		{"logs:StartQuery", "Insights queries", func() error {
+			_, err := svc.StartQueryWithContext(ctx, &cloudwatchlogs.StartQueryInput{
+				LogGroupName: aws.String(logGroup),
+				QueryString:  aws.String("|"),
+				StartTime:    aws.Int64(now/1000 - 60),
+				EndTime:      aws.Int64(now / 1000),
+			})
+			return err
+		}},
+		{"logs:GetQueryResults", "Insights queries", func() error {
+			_, err := svc.GetQueryResultsWithContext(ctx, &cloudwatchlogs.GetQueryResultsInput{QueryId: aws.String(unknownId)})
+			return err
+		}},
+		{"logs:StopQuery", "Insights queries", func() error {
+			_, err := svc.StopQueryWithContext(ctx, &cloudwatchlogs.StopQueryInput{QueryId: aws.String(unknownId)})
+			return err
+		}},
+		{"logs:GetLogRecord", "Insights log details", func() error {
+			_, err := svc.GetLogRecordWithContext(ctx, &cloudwatchlogs.GetLogRecordInput{LogRecordPointer: aws.String(unknownId)})
+			return err
+		}},
+		{"logs:GetDataProtectionPolicy", "masked value warnings", func() error {
+			_, err := getDataProtectionPolicy(svc, logGroup)
+			return err
+		}},
+		{"logs:DescribeExportTasks", "export task tables", func() error {
+			_, err := svc.DescribeExportTasksWithContext(ctx, &cloudwatchlogs.DescribeExportTasksInput{Limit: aws.Int64(1)})
+			return err
+		}},
+		{"logs:DescribeAccountPolicies", "data protection tables", func() error {
+			_, err := describeDataProtectionAccountPolicies(ctx, svc)
+			return err
+		}},
+		{"logs:DescribeResourcePolicies", "resource policy tables and variables", func() error {
+			_, err := svc.DescribeResourcePoliciesWithContext(ctx, &cloudwatchlogs.DescribeResourcePoliciesInput{Limit: aws.Int64(1)})
+			return err
+		}},
+		{"ecs:ListClusters", "ECS variables", func() error {
+			_, err := ecs.New(sess).ListClustersWithContext(ctx, &ecs.ListClustersInput{MaxResults: aws.Int64(1)})
+			return err
+		}},
+		{"lambda:GetAlias", "Lambda aliases", func() error {
+			_, err := lambda.New(sess).GetAliasWithContext(ctx, &lambda.GetAliasInput{FunctionName: aws.String("grafana-permission-check"), Name: aws.String("check")})
+			return err
+		}},
+	}
+	if dsInfo.AllowWrites {
+		checks = append(checks, permissionCheck{"logs:DescribeMetricFilters", "metric filters", func() error {
+			_, err := svc.DescribeMetricFiltersWithContext(ctx, &cloudwatchlogs.DescribeMetricFiltersInput{LogGroupName: aws.String(logGroup), Limit: aws.Int64(1)})
+			return err
+		}})
+	}
+
+	table := &datasource.Table{
+		Columns: []*datasource.TableColumn{{Name: "Action"}, {Name: "Status"}, {Name: "Feature"}, {Name: "Detail"}},
+	}
+	var missing []string
+	for _, c := range checks {
+		status, detail := permissionStatus(c.call())
+		if status == "missing" {
+			missing = append(missing, c.action)
+		}
+		table.Rows = append(table.Rows, &datasource.TableRow{
+			Values: []*datasource.RowValue{
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: c.action},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: status},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: c.feature},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: detail},
+			},
+		})
+	}
+
+	metaJson, err := json.Marshal(struct {
+		Identity string
+		Region   string
+		LogGroup string
+		Missing  []string
+	}{aws.StringValue(identity.Arn), target.Region, logGroup, missing})
+	if err != nil {
+		return nil, err
+	}
+	return &datasource.QueryResult{
+		Tables:   []*datasource.Table{table},
+		MetaJson: string(metaJson),
+	}, nil
+}
+
+// permissionStatus tells whether the error of a check means the action is denied.
+func permissionStatus(err error) (string, string) {
+	if err == nil {
+		return "allowed", ""
+	}
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return "unknown", err.Error()
+	}
+	switch aerr.Code() {
+	case "AccessDeniedException", "AccessDenied", "UnauthorizedOperation":
+		return "missing", aerr.Message()
+	case "UnrecognizedClientException", "InvalidClientTokenId", "ExpiredTokenException", "ExpiredToken", "RequestCanceled":
+		return "unknown", aerr.Message()
+	}
+	return "allowed", ""
+}
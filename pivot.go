@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+const (
+	defaultPivotColumns = 20
+	pivotOtherColumn    = "other"
+)
+
+// eventKeyFunc returns a function extracting field from events: the log stream name, a column of the preset of the target,
+// or a dotted field of JSON messages. Events without the field have an empty key.
+func (target *Target) eventKeyFunc(field string) (func(e *cloudwatchlogs.FilteredLogEvent) string, error) {
+	if field == "" || field == "LogStreamName" {
+		return func(e *cloudwatchlogs.FilteredLogEvent) string {
+			return aws.StringValue(e.LogStreamName)
+		}, nil
+	}
+	if target.Preset != "" {
+		p, ok := presetRegistry[target.Preset]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset %q", target.Preset)
+		}
+		for _, c := range p.Columns {
+			if c.Name != field {
+				continue
+			}
+			column := c
+			return func(e *cloudwatchlogs.FilteredLogEvent) string {
+				record := p.record(aws.StringValue(e.Message))
+				if record == nil {
+					return ""
+				}
+				return rowValueString(p.value(record, column))
+			}, nil
+		}
+	}
+	return func(e *cloudwatchlogs.FilteredLogEvent) string {
+		message := aws.StringValue(e.Message)
+		if !strings.HasPrefix(message, "{") {
+			return ""
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(message), &record); err != nil {
+			return ""
+		}
+		switch v := lookupJsonField(record, field).(type) {
+		case nil:
+			return ""
+		case string:
+			return v
+		default:
+			return fmt.Sprint(v)
+		}
+	}, nil
+}
+
+func rowValueString(v *datasource.RowValue) string {
+	switch v.Kind {
+	case datasource.RowValue_TYPE_STRING:
+		return v.StringValue
+	case datasource.RowValue_TYPE_INT64:
+		return fmt.Sprint(v.Int64Value)
+	case datasource.RowValue_TYPE_DOUBLE:
+		return fmt.Sprint(v.DoubleValue)
+	}
+	return ""
+}
+
+// parsePivotResponse returns a wide table with one row per interval and one count column per value of the key,
+// busiest values first. Values beyond maxColumns are counted in an "other" column.
+func parsePivotResponse(resp *cloudwatchlogs.FilterLogEventsOutput, refId string, intervalMs int64, keyFunc func(e *cloudwatchlogs.FilteredLogEvent) string, maxColumns int) (*datasource.QueryResult, error) {
+	if maxColumns <= 0 {
+		maxColumns = defaultPivotColumns
+	}
+	series := countSeries(resp.Events, intervalMs, "key", keyFunc)
+
+	columns := make([]string, 0, len(series))
+	counts := make(map[int64]map[string]float64)
+	for i, s := range series {
+		name := s.Name
+		if i >= maxColumns {
+			name = pivotOtherColumn
+		}
+		if i <= maxColumns {
+			columns = append(columns, name)
+		}
+		for _, p := range s.Points {
+			if counts[p.Timestamp] == nil {
+				counts[p.Timestamp] = make(map[string]float64)
+			}
+			counts[p.Timestamp][name] += p.Value
+		}
+	}
+	timestamps := make([]int64, 0, len(counts))
+	for ts := range counts {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	table := newStringTable(append([]string{"Time"}, columns...)...)
+	for _, ts := range timestamps {
+		row := &datasource.TableRow{}
+		row.Values = append(row.Values, stringValue(formatEventTime(ts)))
+		for _, c := range columns {
+			row.Values = append(row.Values, &datasource.RowValue{Kind: datasource.RowValue_TYPE_INT64, Int64Value: int64(counts[ts][c])})
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	return &datasource.QueryResult{
+		RefId:  refId,
+		Tables: []*datasource.Table{table},
+	}, nil
+}
+
+// parseHeatmapResponse returns event count series per value of the key for the heatmap panel, in its time series buckets mode.
+// Every series has a point for each interval of the range, and the series are sorted by name, which the panel uses as the y axis.
+func parseHeatmapResponse(resp *cloudwatchlogs.FilterLogEventsOutput, refId string, from int64, to int64, intervalMs int64, keyFunc func(e *cloudwatchlogs.FilteredLogEvent) string, maxSeries int) (*datasource.QueryResult, error) {
+	if maxSeries <= 0 {
+		maxSeries = defaultPivotColumns
+	}
+	if intervalMs <= 0 {
+		intervalMs = 1000
+	}
+	series := countSeries(resp.Events, intervalMs, "key", keyFunc)
+	if len(series) > maxSeries {
+		series = series[:maxSeries]
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Name < series[j].Name })
+
+	start := bucketTimestamp(from, intervalMs)
+	for _, s := range series {
+		counts := make(map[int64]float64, len(s.Points))
+		for _, p := range s.Points {
+			counts[p.Timestamp] = p.Value
+		}
+		s.Points = make([]*datasource.Point, 0, (to-start)/intervalMs+1)
+		for ts := start; ts <= to; ts += intervalMs {
+			s.Points = append(s.Points, &datasource.Point{Timestamp: ts, Value: counts[ts]})
+		}
+	}
+
+	return &datasource.QueryResult{
+		RefId:  refId,
+		Series: series,
+	}, nil
+}
@@ -12,6 +12,10 @@ import (
 func main() {
 	log.SetOutput(os.Stderr) // the plugin sends logs to the host process on strErr
 
+	if addr := os.Getenv(metricsAddrEnv); addr != "" {
+		go serveMetrics(addr)
+	}
+
 	plugin.Serve(&plugin.ServeConfig{
 		HandshakeConfig: plugin.HandshakeConfig{
 			ProtocolVersion:  1,
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// Additional presets can be defined in a JSON file, given by this environment variable, as a list of logPreset objects.
+const presetsFileEnv = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_PRESETS_FILE"
+
+// presetColumn maps a field of a log record to a typed column.
+// JSON presets read the first present key (dotted for nested objects), regex presets read the named group.
+type presetColumn struct {
+	Name  string   `json:"name"`
+	Keys  []string `json:"keys,omitempty"`
+	Group string   `json:"group,omitempty"`
+	Type  string   `json:"type,omitempty"` // string (default), int or double
+}
+
+// logPreset parses a log format into columns. Presets are defined as data, either as a mapping of JSON fields
+// or as a regex with named groups, so that new formats are added by registering a preset.
+// Formats which cannot be expressed that way provide a table function instead.
+type logPreset struct {
+	Name           string         `json:"name"`
+	Title          string         `json:"title"`
+	Json           bool           `json:"json,omitempty"`
+	Pattern        string         `json:"pattern,omitempty"`
+	Columns        []presetColumn `json:"columns,omitempty"`
+	DefaultColumns []string       `json:"defaultColumns,omitempty"`
+	GroupBy        []string       `json:"groupBy,omitempty"`
+
+	pattern *regexp.Regexp
+	table   func(resp *cloudwatchlogs.FilterLogEventsOutput, refId string) (*datasource.QueryResult, error)
+	series  func(resp *cloudwatchlogs.FilterLogEventsOutput, refId string, intervalMs int64, groupBy string) (*datasource.QueryResult, error)
+}
+
+var presetRegistry = make(map[string]*logPreset)
+
+func registerPreset(p *logPreset) error {
+	if p.Name == "" {
+		return fmt.Errorf("preset name is required")
+	}
+	if p.Pattern != "" {
+		pattern, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern of preset %s: %v", p.Name, err)
+		}
+		p.pattern = pattern
+	}
+	if p.table == nil && !p.Json && p.pattern == nil {
+		return fmt.Errorf("preset %s should be json or have a pattern", p.Name)
+	}
+	if p.Title == "" {
+		p.Title = p.Name
+	}
+	presetRegistry[p.Name] = p
+	return nil
+}
+
+func init() {
+	for _, p := range builtinPresets {
+		if err := registerPreset(p); err != nil {
+			panic(err)
+		}
+	}
+
+	path := os.Getenv(presetsFileEnv)
+	if path == "" {
+		return
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		pluginLogger.Error("failed to read presets", "path", path, "error", err)
+		return
+	}
+	var presets []*logPreset
+	if err := json.Unmarshal(b, &presets); err != nil {
+		pluginLogger.Error("failed to parse presets", "path", path, "error", err)
+		return
+	}
+	for _, p := range presets {
+		if err := registerPreset(p); err != nil {
+			pluginLogger.Error("invalid preset", "path", path, "error", err)
+		}
+	}
+}
+
+// formatPresetResponse formats the events with the preset of the target, and reports false for the formats which read
+// the fields of the preset themselves, through eventKeyFunc. The formats which can not use a preset are an error.
+func formatPresetResponse(target *Target, resp *cloudwatchlogs.FilterLogEventsOutput) (*datasource.QueryResult, bool, error) {
+	p, ok := presetRegistry[target.Preset]
+	if !ok {
+		return nil, true, fmt.Errorf("unknown preset %q", target.Preset)
+	}
+	switch target.Format {
+	case "", "table":
+		if p.table != nil {
+			r, err := p.table(resp, target.RefId)
+			return r, true, err
+		}
+		r, err := p.parseTable(resp, target.RefId, target.PresetColumns)
+		return r, true, err
+	case "timeserie":
+		if p.series != nil {
+			r, err := p.series(resp, target.RefId, target.IntervalMs, target.PresetGroupBy)
+			return r, true, err
+		}
+		if len(p.GroupBy) > 0 {
+			r, err := p.parseCountSeries(resp, target.RefId, target.IntervalMs, target.PresetGroupBy)
+			return r, true, err
+		}
+		return nil, true, fmt.Errorf("preset %q has no group by fields to count series of", target.Preset)
+	case "stream_summary", "top_streams", "stream_series", "level_counts":
+		return nil, true, fmt.Errorf("the %s format can not be used with a preset", target.Format)
+	}
+	return nil, false, nil
+}
+
+// record extracts the fields of a message, or returns nil when the message is not in the format of the preset.
+func (p *logPreset) record(message string) map[string]interface{} {
+	if p.Json {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(message), &record); err != nil {
+			return nil
+		}
+		return record
+	}
+	m := p.pattern.FindStringSubmatch(message)
+	if m == nil {
+		return nil
+	}
+	record := make(map[string]interface{})
+	for i, name := range p.pattern.SubexpNames() {
+		if name != "" {
+			record[name] = m[i]
+		}
+	}
+	return record
+}
+
+func (p *logPreset) value(record map[string]interface{}, c presetColumn) *datasource.RowValue {
+	var v interface{}
+	if c.Group != "" {
+		v = record[c.Group]
+	}
+	for _, k := range c.Keys {
+		if v != nil {
+			break
+		}
+		v = lookupJsonField(record, k)
+	}
+	if v == nil {
+		if c.Type == "int" || c.Type == "double" {
+			return &datasource.RowValue{Kind: datasource.RowValue_TYPE_NULL}
+		}
+		return stringValue("")
+	}
+
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		s = string(b)
+	default:
+		s = fmt.Sprint(v)
+	}
+	switch c.Type {
+	case "int":
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return &datasource.RowValue{Kind: datasource.RowValue_TYPE_NULL} // e.g. "-" is logged for missing numbers
+		}
+		return &datasource.RowValue{Kind: datasource.RowValue_TYPE_INT64, Int64Value: int64(n)}
+	case "double":
+		return doubleValue(s)
+	default:
+		return stringValue(s)
+	}
+}
+
+// parseTable returns the selected columns, or the default columns of the preset. Events which do not match the preset are skipped.
+func (p *logPreset) parseTable(resp *cloudwatchlogs.FilterLogEventsOutput, refId string, selected []string) (*datasource.QueryResult, error) {
+	if len(selected) == 0 {
+		selected = p.DefaultColumns
+	}
+	columns := p.Columns
+	if len(selected) > 0 {
+		byName := make(map[string]presetColumn)
+		for _, c := range p.Columns {
+			byName[c.Name] = c
+		}
+		columns = nil
+		for _, name := range selected {
+			c, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("preset %s has no column %s", p.Name, name)
+			}
+			columns = append(columns, c)
+		}
+	}
+
+	table := newStringTable("Timestamp", "LogStreamName")
+	for _, c := range columns {
+		table.Columns = append(table.Columns, &datasource.TableColumn{Name: c.Name})
+	}
+	for _, e := range resp.Events {
+		record := p.record(aws.StringValue(e.Message))
+		if record == nil {
+			continue
+		}
+		row := &datasource.TableRow{
+			Values: []*datasource.RowValue{
+				stringValue(formatEventTime(*e.Timestamp)),
+				stringValue(aws.StringValue(e.LogStreamName)),
+			},
+		}
+		for _, c := range columns {
+			row.Values = append(row.Values, p.value(record, c))
+		}
+		table.Rows = append(table.Rows, row)
+	}
+
+	return &datasource.QueryResult{
+		RefId:  refId,
+		Tables: []*datasource.Table{table},
+	}, nil
+}
+
+// parseCountSeries returns the number of events per interval, grouped by the value of a column.
+func (p *logPreset) parseCountSeries(resp *cloudwatchlogs.FilterLogEventsOutput, refId string, intervalMs int64, groupBy string) (*datasource.QueryResult, error) {
+	if groupBy == "" {
+		groupBy = p.GroupBy[0]
+	}
+	var column *presetColumn
+	for i, c := range p.Columns {
+		if c.Name == groupBy {
+			column = &p.Columns[i]
+		}
+	}
+	if column == nil {
+		return nil, fmt.Errorf("preset %s has no column %s", p.Name, groupBy)
+	}
+	series := countSeries(resp.Events, intervalMs, groupBy, func(e *cloudwatchlogs.FilteredLogEvent) string {
+		record := p.record(aws.StringValue(e.Message))
+		if record == nil {
+			return ""
+		}
+		v := p.value(record, presetColumn{Name: column.Name, Keys: column.Keys, Group: column.Group})
+		return v.StringValue
+	})
+
+	return &datasource.QueryResult{
+		RefId:  refId,
+		Series: series,
+	}, nil
+}
+
+// presetsQuery lists the registered presets for the query editor.
+func (t *AwsCloudWatchLogsDatasource) presetsQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	names := make([]string, 0, len(presetRegistry))
+	for name := range presetRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	presets := make([]*logPreset, 0, len(names))
+	for _, name := range names {
+		presets = append(presets, presetRegistry[name])
+	}
+	b, err := json.Marshal(presets)
+	if err != nil {
+		return nil, err
+	}
+	return &datasource.QueryResult{MetaJson: string(b)}, nil
+}
+
+func formatEventTime(ms int64) string {
+	return time.Unix(ms/1000, ms%1000*1000*1000).Format(time.RFC3339)
+}
+
+func newStringTable(columns ...string) *datasource.Table {
+	table := &datasource.Table{}
+	for _, c := range columns {
+		table.Columns = append(table.Columns, &datasource.TableColumn{Name: c})
+	}
+	return table
+}
+
+func stringValue(v string) *datasource.RowValue {
+	return &datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: v}
+}
+
+func doubleValue(s string) *datasource.RowValue {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return &datasource.RowValue{Kind: datasource.RowValue_TYPE_NULL}
+	}
+	return &datasource.RowValue{Kind: datasource.RowValue_TYPE_DOUBLE, DoubleValue: v}
+}
+
+func int64Value(s string) *datasource.RowValue {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return &datasource.RowValue{Kind: datasource.RowValue_TYPE_NULL}
+	}
+	return &datasource.RowValue{Kind: datasource.RowValue_TYPE_INT64, Int64Value: v}
+}
+
+// lookupJsonField returns the value of a dotted key such as "srcids.instance".
+func lookupJsonField(record map[string]interface{}, key string) interface{} {
+	var v interface{} = record
+	for _, k := range strings.Split(key, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+var builtinPresets = []*logPreset{
+	{
+		Name:  "fluentbit",
+		Title: "Fluent Bit (EKS)",
+		Json:  true,
+		Columns: []presetColumn{
+			{Name: "Namespace", Keys: []string{"kubernetes.namespace_name"}},
+			{Name: "Pod", Keys: []string{"kubernetes.pod_name"}},
+			{Name: "Container", Keys: []string{"kubernetes.container_name"}},
+			{Name: "Host", Keys: []string{"kubernetes.host"}},
+			{Name: "Stream", Keys: []string{"stream"}},
+			{Name: "Message", Keys: []string{"log"}},
+		},
+		GroupBy: []string{"Namespace", "Pod", "Container"},
+	},
+	{
+		Name:    "vpcflow",
+		Title:   "VPC Flow Logs",
+		Pattern: `^(?P<version>\d+) (?P<account_id>\S+) (?P<interface_id>\S+) (?P<srcaddr>\S+) (?P<dstaddr>\S+) (?P<srcport>\S+) (?P<dstport>\S+) (?P<protocol>\S+) (?P<packets>\S+) (?P<bytes>\S+) (?P<start>\S+) (?P<end>\S+) (?P<action>\S+) (?P<log_status>\S+)$`,
+		Columns: []presetColumn{
+			{Name: "version", Group: "version", Type: "int"},
+			{Name: "account-id", Group: "account_id"},
+			{Name: "interface-id", Group: "interface_id"},
+			{Name: "srcaddr", Group: "srcaddr"},
+			{Name: "dstaddr", Group: "dstaddr"},
+			{Name: "srcport", Group: "srcport", Type: "int"},
+			{Name: "dstport", Group: "dstport", Type: "int"},
+			{Name: "protocol", Group: "protocol", Type: "int"},
+			{Name: "packets", Group: "packets", Type: "int"},
+			{Name: "bytes", Group: "bytes", Type: "int"},
+			{Name: "start", Group: "start", Type: "int"},
+			{Name: "end", Group: "end", Type: "int"},
+			{Name: "action", Group: "action"},
+			{Name: "log-status", Group: "log_status"},
+		},
+		GroupBy: []string{"action", "interface-id", "srcaddr", "dstaddr", "dstport"},
+		series:  parseVpcFlowLogSeries,
+	},
+	{
+		Name:  "apigateway",
+		Title: "API Gateway access logs",
+		Json:  true,
+		Columns: []presetColumn{
+			{Name: "RequestId", Keys: []string{"requestId"}},
+			{Name: "HttpMethod", Keys: []string{"httpMethod"}},
+			{Name: "Path", Keys: []string{"path", "resourcePath", "routeKey"}},
+			{Name: "Status", Keys: []string{"status"}, Type: "int"},
+			{Name: "Latency", Keys: []string{"responseLatency", "latency"}, Type: "double"},
+			{Name: "IntegrationLatency", Keys: []string{"integrationLatency"}, Type: "double"},
+			{Name: "ResponseLength", Keys: []string{"responseLength"}, Type: "int"},
+			{Name: "SourceIp", Keys: []string{"ip", "sourceIp"}},
+		},
+		GroupBy: []string{"Status", "Path", "HttpMethod"},
+	},
+	{
+		Name:  "route53resolver",
+		Title: "Route 53 Resolver query logs",
+		Json:  true,
+		Columns: []presetColumn{
+			{Name: "QueryName", Keys: []string{"query_name"}},
+			{Name: "QueryType", Keys: []string{"query_type"}},
+			{Name: "Rcode", Keys: []string{"rcode"}},
+			{Name: "SrcAddr", Keys: []string{"srcaddr"}},
+			{Name: "SrcPort", Keys: []string{"srcport"}, Type: "int"},
+			{Name: "Transport", Keys: []string{"transport"}},
+			{Name: "VpcId", Keys: []string{"vpc_id"}},
+			{Name: "InstanceId", Keys: []string{"srcids.instance"}},
+		},
+		GroupBy: []string{"Rcode", "QueryType", "QueryName", "SrcAddr"},
+	},
+	{Name: "rds_slowquery", Title: "RDS slow query logs", table: parseRdsSlowQueryResponse},
+	{Name: "rds_error", Title: "RDS error logs", table: parseRdsErrorLogResponse},
+}
+
+// parseVpcFlowLogSeries returns the bytes transferred per interval, grouped by a flow log field such as action or interface-id.
+func parseVpcFlowLogSeries(resp *cloudwatchlogs.FilterLogEventsOutput, refId string, intervalMs int64, groupBy string) (*datasource.QueryResult, error) {
+	if groupBy == "" {
+		groupBy = "action"
+	}
+	p := presetRegistry["vpcflow"]
+	group := strings.Replace(groupBy, "-", "_", -1)
+	series := sumSeries(resp.Events, intervalMs, groupBy, func(e *cloudwatchlogs.FilteredLogEvent) (string, float64) {
+		record := p.record(aws.StringValue(e.Message))
+		if record == nil {
+			return "", 0
+		}
+		bytes, err := strconv.ParseFloat(record["bytes"].(string), 64)
+		if err != nil {
+			return "", 0
+		}
+		key, _ := record[group].(string)
+		return key, bytes
+	})
+
+	return &datasource.QueryResult{
+		RefId:  refId,
+		Series: series,
+	}, nil
+}
+
+var (
+	mysqlSlowQueryUserPattern  = regexp.MustCompile(`(?m)^# User@Host: (\S+?)\[[^\]]*\] @ *(\S*) *\[([^\]]*)\]`)
+	mysqlSlowQueryStatsPattern = regexp.MustCompile(`(?m)^# Query_time: ([\d.]+)\s+Lock_time: ([\d.]+)\s+Rows_sent: (\d+)\s+Rows_examined: (\d+)`)
+	mysqlSlowQueryHeaderLine   = regexp.MustCompile(`(?m)^(#.*|SET timestamp=\d+;|use \S+;)\n?`)
+	postgresLogPattern         = regexp.MustCompile(`^\d{4}-\d\d-\d\d \d\d:\d\d:\d\d \w+:([^(:]*)(?:\([^)]*\))?:([^@:]*)@?([^:]*):\[\d+\]:(\w+):\s+(?s)(.*)$`)
+	postgresDurationPattern    = regexp.MustCompile(`^duration: ([\d.]+) ms\s+(?:statement|execute [^:]*):\s+(?s)(.*)$`)
+	mysqlErrorLogPattern       = regexp.MustCompile(`^\S+(?: \d\d:\d\d:\d\d)? +\d+ \[(\w+)\] (?:\[[^\]]*\] )*(?s)(.*)$`)
+)
+
+// parseRdsSlowQueryResponse returns the statistics of MySQL/Aurora MySQL slow query log entries,
+// and of PostgreSQL statements logged with log_min_duration_statement. Query and lock times are in seconds.
+func parseRdsSlowQueryResponse(resp *cloudwatchlogs.FilterLogEventsOutput, refId string) (*datasource.QueryResult, error) {
+	table := newStringTable("Timestamp", "User", "Host", "QueryTime", "LockTime", "RowsSent", "RowsExamined", "Query")
+	null := &datasource.RowValue{Kind: datasource.RowValue_TYPE_NULL}
+	for _, e := range resp.Events {
+		message := aws.StringValue(e.Message)
+		timestamp := stringValue(formatEventTime(*e.Timestamp))
+		if m := mysqlSlowQueryStatsPattern.FindStringSubmatch(message); m != nil {
+			user, host := "", ""
+			if u := mysqlSlowQueryUserPattern.FindStringSubmatch(message); u != nil {
+				user, host = u[1], u[3]
+				if host == "" {
+					host = u[2]
+				}
+			}
+			query := strings.TrimSpace(mysqlSlowQueryHeaderLine.ReplaceAllString(message, ""))
+			table.Rows = append(table.Rows, &datasource.TableRow{
+				Values: []*datasource.RowValue{timestamp, stringValue(user), stringValue(host), doubleValue(m[1]), doubleValue(m[2]), int64Value(m[3]), int64Value(m[4]), stringValue(query)},
+			})
+			continue
+		}
+		if m := postgresLogPattern.FindStringSubmatch(message); m != nil {
+			d := postgresDurationPattern.FindStringSubmatch(m[5])
+			if d == nil {
+				continue
+			}
+			queryTime := null
+			if ms, err := strconv.ParseFloat(d[1], 64); err == nil {
+				queryTime = &datasource.RowValue{Kind: datasource.RowValue_TYPE_DOUBLE, DoubleValue: ms / 1000}
+			}
+			table.Rows = append(table.Rows, &datasource.TableRow{
+				Values: []*datasource.RowValue{timestamp, stringValue(m[2]), stringValue(m[1]), queryTime, null, null, null, stringValue(strings.TrimSpace(d[2]))},
+			})
+		}
+	}
+
+	return &datasource.QueryResult{
+		RefId:  refId,
+		Tables: []*datasource.Table{table},
+	}, nil
+}
+
+// parseRdsErrorLogResponse returns the severity and message of MySQL/Aurora MySQL and PostgreSQL error log lines.
+func parseRdsErrorLogResponse(resp *cloudwatchlogs.FilterLogEventsOutput, refId string) (*datasource.QueryResult, error) {
+	table := newStringTable("Timestamp", "Severity", "User", "Host", "Message")
+	for _, e := range resp.Events {
+		message := aws.StringValue(e.Message)
+		severity, user, host := "", "", ""
+		if m := mysqlErrorLogPattern.FindStringSubmatch(message); m != nil {
+			severity, message = m[1], m[2]
+		} else if m := postgresLogPattern.FindStringSubmatch(message); m != nil {
+			host, user, severity, message = m[1], m[2], m[4], m[5]
+		}
+		if level := normalizeLogLevel(severity); level != "" {
+			severity = level
+		}
+		table.Rows = append(table.Rows, &datasource.TableRow{
+			Values: []*datasource.RowValue{
+				stringValue(formatEventTime(*e.Timestamp)),
+				stringValue(strings.ToUpper(severity)),
+				stringValue(user),
+				stringValue(host),
+				stringValue(strings.TrimSpace(message)),
+			},
+		})
+	}
+
+	return &datasource.QueryResult{
+		RefId:  refId,
+		Tables: []*datasource.Table{table},
+	}, nil
+}
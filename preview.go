@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// previewMaxEvents is the page size of a preview, small enough for the API to answer it quickly.
+const previewMaxEvents = 20
+
+// previewQuery returns the first events matching a draft target, from a single page, so that the query editor
+// can show them as the query is typed without running the full panel query. The events are returned as a table
+// whatever the format of the target, and a preview finding none does not mean the query matches nothing,
+// as a page only covers part of the log streams.
+func (t *AwsCloudWatchLogsDatasource) previewQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	targetJson, err := parameters.Get("target").MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	target := Target{}
+	if err := json.Unmarshal(targetJson, &target); err != nil {
+		return nil, err
+	}
+	if target.UseInsights || target.LastN > 0 || target.hasMultipleLogGroups() {
+		return nil, fmt.Errorf("only filter queries of a single log group can be previewed")
+	}
+
+	dsInfo, err := t.getDsInfo(tsdbReq.Datasource, "")
+	if err != nil {
+		return nil, err
+	}
+	fromRaw, toRaw, err := parseTimeRange(tsdbReq.TimeRange, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := t.prepareTarget(tsdbReq, dsInfo, &target, fromRaw, toRaw); err != nil {
+		return nil, err
+	}
+	target.Input.Limit = aws.Int64(previewMaxEvents)
+	target.Input.NextToken = nil
+	t.auditResourceQuery(tsdbReq.Datasource, "previewQuery", &target, target.From, target.To)
+
+	svc, err := t.getClient(tsdbReq.Datasource, target.Region)
+	if err != nil {
+		return nil, err
+	}
+	includeStream, err := target.logStreamFilter()
+	if err != nil {
+		return nil, err
+	}
+	quota := quotaForOrg(tsdbReq.Datasource.OrgId).withDeadline(queryDeadline(ctx, dsInfo)).withChunkPages(1)
+	quota.MaxEvents = previewMaxEvents
+	resp, stats, err := t.getLogEvent(svc, &target.Input, true, quota, includeStream, nil)
+	if err != nil {
+		return nil, err
+	}
+	stats.Truncated = ""
+
+	target.Format = "table"
+	r, err := formatResult(&target, resp)
+	if err != nil {
+		return nil, err
+	}
+	meta := resultMeta{Stats: stats}
+	if len(resp.Events) == 0 {
+		meta.Notice = fmt.Sprintf("no event in the first page, %d log streams searched", stats.SearchedLogStreams)
+	}
+	metaJson, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	r.MetaJson = string(metaJson)
+	return r, nil
+}
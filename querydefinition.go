@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// The saved queries API is newer than the SDK, so its operations are declared here
+// and sent through the JSON protocol handlers of the client.
+type queryDefinition struct {
+	_ struct{} `type:"structure"`
+
+	Name              *string   `locationName:"name" type:"string"`
+	QueryDefinitionId *string   `locationName:"queryDefinitionId" type:"string"`
+	QueryString       *string   `locationName:"queryString" type:"string"`
+	LogGroupNames     []*string `locationName:"logGroupNames" type:"list"`
+}
+
+type putQueryDefinitionOutput struct {
+	_ struct{} `type:"structure"`
+
+	QueryDefinitionId *string `locationName:"queryDefinitionId" type:"string"`
+}
+
+type describeQueryDefinitionsInput struct {
+	_ struct{} `type:"structure"`
+
+	QueryDefinitionNamePrefix *string `locationName:"queryDefinitionNamePrefix" type:"string"`
+	NextToken                 *string `locationName:"nextToken" type:"string"`
+}
+
+type describeQueryDefinitionsOutput struct {
+	_ struct{} `type:"structure"`
+
+	QueryDefinitions []*queryDefinition `locationName:"queryDefinitions" type:"list"`
+	NextToken        *string            `locationName:"nextToken" type:"string"`
+}
+
+func putQueryDefinition(ctx context.Context, svc *cloudwatchlogs.CloudWatchLogs, input *queryDefinition) (*putQueryDefinitionOutput, error) {
+	output := &putQueryDefinitionOutput{}
+	req := svc.NewRequest(&request.Operation{Name: "PutQueryDefinition", HTTPMethod: "POST", HTTPPath: "/"}, input, output)
+	req.SetContext(ctx)
+	return output, req.Send()
+}
+
+// findQueryDefinition returns the saved query of the given name, or nil.
+func findQueryDefinition(ctx context.Context, svc *cloudwatchlogs.CloudWatchLogs, name string) (*queryDefinition, error) {
+	input := &describeQueryDefinitionsInput{QueryDefinitionNamePrefix: aws.String(name)}
+	for {
+		output := &describeQueryDefinitionsOutput{}
+		req := svc.NewRequest(&request.Operation{Name: "DescribeQueryDefinitions", HTTPMethod: "POST", HTTPPath: "/"}, input, output)
+		req.SetContext(ctx)
+		if err := req.Send(); err != nil {
+			return nil, err
+		}
+		for _, d := range output.QueryDefinitions {
+			if aws.StringValue(d.Name) == name {
+				return d, nil
+			}
+		}
+		if output.NextToken == nil {
+			return nil, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// putQueryDefinitionQuery saves an Insights query string as a query definition of the CloudWatch console.
+// A definition of the same name is updated, so that saving a query again does not add a copy.
+func (t *AwsCloudWatchLogsDatasource) putQueryDefinitionQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	dsInfo, err := t.getDsInfo(tsdbReq.Datasource, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := dsInfo.checkWritesAllowed(); err != nil {
+		return nil, err
+	}
+
+	name := parameters.Get("name").MustString()
+	queryString := parameters.Get("queryString").MustString()
+	if name == "" || queryString == "" {
+		return nil, fmt.Errorf("name and queryString are required")
+	}
+	var logGroupNames []*string
+	for _, n := range strings.Split(parameters.Get("logGroupName").MustString(), ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			logGroupNames = append(logGroupNames, aws.String(n))
+		}
+	}
+	target := Target{Region: parameters.Get("region").MustString()}
+	if err := target.resolveRegion(dsInfo.DefaultRegion); err != nil {
+		return nil, err
+	}
+	svc, err := t.getClient(tsdbReq.Datasource, target.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := findQueryDefinition(ctx, svc, name)
+	if err != nil {
+		return nil, err
+	}
+	input := &queryDefinition{
+		Name:          aws.String(name),
+		QueryString:   aws.String(queryString),
+		LogGroupNames: logGroupNames,
+	}
+	if existing != nil {
+		input.QueryDefinitionId = existing.QueryDefinitionId
+	}
+	output, err := putQueryDefinition(ctx, svc, input)
+	if err != nil {
+		return nil, err
+	}
+	pluginLogger.Info("query definition saved",
+		"orgId", tsdbReq.Datasource.OrgId,
+		"datasourceId", tsdbReq.Datasource.Id,
+		"region", target.Region,
+		"name", name,
+		"queryDefinitionId", aws.StringValue(output.QueryDefinitionId),
+		"replaced", existing != nil,
+	)
+
+	metaJson, err := json.Marshal(struct {
+		Name              string
+		QueryDefinitionId string
+		Replaced          bool
+	}{name, aws.StringValue(output.QueryDefinitionId), existing != nil})
+	if err != nil {
+		return nil, err
+	}
+	return &datasource.QueryResult{MetaJson: string(metaJson)}, nil
+}
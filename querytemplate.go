@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// queryTemplate is a named filter pattern and parsing config kept in the settings of the datasource,
+// so that the targets referring to it by name follow its changes.
+type queryTemplate struct {
+	Name                  string   `json:"name"`
+	Description           string   `json:"description,omitempty"`
+	FilterPattern         string   `json:"filterPattern"`
+	Preset                string   `json:"preset,omitempty"`
+	PresetColumns         []string `json:"presetColumns,omitempty"`
+	UnescapeJsonMessage   bool     `json:"unescapeJsonMessage,omitempty"`
+	StripAnsi             bool     `json:"stripAnsi,omitempty"`
+	Multiline             bool     `json:"multiline,omitempty"`
+	MultilineStartPattern string   `json:"multilineStartPattern,omitempty"`
+}
+
+func (q *queryTemplate) validate() error {
+	if q.Name == "" {
+		return fmt.Errorf("template name is required")
+	}
+	if q.Preset != "" {
+		if _, ok := presetRegistry[q.Preset]; !ok {
+			return fmt.Errorf("unknown preset %q", q.Preset)
+		}
+	}
+	if q.Multiline {
+		if q.MultilineStartPattern == "" {
+			return fmt.Errorf("multiline requires a start pattern")
+		}
+		if _, err := regexp.Compile(q.MultilineStartPattern); err != nil {
+			return fmt.Errorf("invalid multiline start pattern: %v", err)
+		}
+	}
+	return nil
+}
+
+func (dsInfo *DatasourceInfo) queryTemplate(name string) (*queryTemplate, bool) {
+	for i := range dsInfo.QueryTemplates {
+		if dsInfo.QueryTemplates[i].Name == name {
+			return &dsInfo.QueryTemplates[i], true
+		}
+	}
+	return nil, false
+}
+
+// applyQueryTemplate replaces the filter pattern and parsing config of a target with those of its template.
+func (target *Target) applyQueryTemplate(dsInfo *DatasourceInfo) error {
+	if target.Template == "" {
+		return nil
+	}
+	q, ok := dsInfo.queryTemplate(target.Template)
+	if !ok {
+		return fmt.Errorf("unknown query template %q", target.Template)
+	}
+	target.Input.FilterPattern = aws.String(q.FilterPattern)
+	target.Preset = q.Preset
+	target.PresetColumns = q.PresetColumns
+	target.UnescapeJsonMessage = q.UnescapeJsonMessage
+	target.StripAnsi = q.StripAnsi
+	target.Multiline = q.Multiline
+	target.MultilineStartPattern = q.MultilineStartPattern
+	return nil
+}
+
+// queryTemplatesQuery lists the query templates of the datasource.
+func (t *AwsCloudWatchLogsDatasource) queryTemplatesQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	dsInfo, err := t.getDsInfo(tsdbReq.Datasource, "")
+	if err != nil {
+		return nil, err
+	}
+	table := &datasource.Table{
+		Columns: []*datasource.TableColumn{{Name: "Name"}, {Name: "Description"}, {Name: "FilterPattern"}, {Name: "Preset"}},
+	}
+	for _, q := range dsInfo.QueryTemplates {
+		table.Rows = append(table.Rows, &datasource.TableRow{
+			Values: []*datasource.RowValue{
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: q.Name},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: q.Description},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: q.FilterPattern},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: q.Preset},
+			},
+		})
+	}
+	templates := dsInfo.QueryTemplates
+	if templates == nil {
+		templates = []queryTemplate{}
+	}
+	metaJson, err := json.Marshal(struct{ Templates []queryTemplate }{templates})
+	if err != nil {
+		return nil, err
+	}
+	return &datasource.QueryResult{
+		Tables:   []*datasource.Table{table},
+		MetaJson: string(metaJson),
+	}, nil
+}
+
+// putQueryTemplateQuery validates a template and returns the templates of the datasource with it added,
+// or replacing the template of the same name. Backend plugins can not update the settings of their datasource,
+// so the frontend saves the returned list to the JSON data of the datasource with the Grafana API.
+func (t *AwsCloudWatchLogsDatasource) putQueryTemplateQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	dsInfo, err := t.getDsInfo(tsdbReq.Datasource, "")
+	if err != nil {
+		return nil, err
+	}
+	templateJson, err := parameters.Get("template").MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	var q queryTemplate
+	if err := json.Unmarshal(templateJson, &q); err != nil {
+		return nil, err
+	}
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+
+	templates := make([]queryTemplate, 0, len(dsInfo.QueryTemplates)+1)
+	replaced := false
+	for _, existing := range dsInfo.QueryTemplates {
+		if existing.Name == q.Name {
+			existing, replaced = q, true
+		}
+		templates = append(templates, existing)
+	}
+	if !replaced {
+		templates = append(templates, q)
+	}
+	metaJson, err := json.Marshal(struct {
+		Templates []queryTemplate
+		Replaced  bool
+	}{templates, replaced})
+	if err != nil {
+		return nil, err
+	}
+	return &datasource.QueryResult{MetaJson: string(metaJson)}, nil
+}
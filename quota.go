@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// Quotas are configured by the Grafana operator rather than in the datasource settings, which org admins can edit.
+// The value is a JSON object keyed by org ID, with "default" applying to orgs without their own entry, e.g.
+//
+//	{"default": {"maxEvents": 10000}, "2": {"maxEvents": 1000, "maxPages": 10, "maxConcurrentQueries": 2}}
+const orgQuotasEnv = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_ORG_QUOTAS"
+
+// maxEventsEnv overrides the hard cap on events returned per response, which protects the plugin process on broad queries.
+const maxEventsEnv = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_MAX_EVENTS"
+
+// maxMemoryEnv overrides the approximate memory, in MB, the events of a single response may use before pagination stops.
+const maxMemoryEnv = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_MAX_MEMORY_MB"
+
+// eventOverhead approximates the memory used by an event besides its strings: the struct, pointers and the int64 fields.
+const eventOverhead = 96
+
+type orgQuota struct {
+	MaxEvents            int64 `json:"maxEvents"`
+	MaxPages             int   `json:"maxPages"`
+	MaxConcurrentQueries int   `json:"maxConcurrentQueries"`
+
+	chunkPages int
+	deadline   time.Time
+	budget     *responseBudget
+}
+
+// responseBudget counts the events and memory held by the fetches of a single response which run in parallel,
+// e.g. one per log group of a target, so that the limits bound the whole response rather than each fetch.
+type responseBudget struct {
+	events int64
+	bytes  int64
+}
+
+// withSharedBudget counts the events of the fetches made with the returned quota together.
+func (q orgQuota) withSharedBudget() orgQuota {
+	q.budget = &responseBudget{}
+	return q
+}
+
+func (b *responseBudget) hold(size int64) {
+	if b == nil {
+		return
+	}
+	atomic.AddInt64(&b.events, 1)
+	atomic.AddInt64(&b.bytes, size)
+}
+
+func (b *responseBudget) heldEvents() int64 {
+	return atomic.LoadInt64(&b.events)
+}
+
+func (b *responseBudget) heldBytes() int64 {
+	return atomic.LoadInt64(&b.bytes)
+}
+
+var (
+	globalMaxEvents  int64 = 10000
+	globalMaxMemory  int64 = 256 << 20
+	orgQuotas        map[string]orgQuota
+	runningQueries   = make(map[int64]int)
+	runningQueryLock sync.Mutex
+)
+
+func init() {
+	if v := os.Getenv(maxEventsEnv); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			pluginLogger.Error("invalid max events", "env", maxEventsEnv, "value", v)
+		} else {
+			globalMaxEvents = n
+		}
+	}
+	if v := os.Getenv(maxMemoryEnv); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			pluginLogger.Error("invalid max memory", "env", maxMemoryEnv, "value", v)
+		} else {
+			globalMaxMemory = n << 20
+		}
+	}
+	if v := os.Getenv(orgQuotasEnv); v != "" {
+		if err := json.Unmarshal([]byte(v), &orgQuotas); err != nil {
+			pluginLogger.Error("failed to parse org quotas", "env", orgQuotasEnv, "error", err)
+		}
+	}
+}
+
+func quotaForOrg(orgId int64) orgQuota {
+	if q, ok := orgQuotas[strconv.FormatInt(orgId, 10)]; ok {
+		return q
+	}
+	return orgQuotas["default"]
+}
+
+// maxEvents returns the number of events a single response may contain, taking the global cap into account.
+func (q orgQuota) maxEvents() int64 {
+	if q.MaxEvents > 0 && q.MaxEvents < globalMaxEvents {
+		return q.MaxEvents
+	}
+	return globalMaxEvents
+}
+
+func eventMemorySize(e *cloudwatchlogs.FilteredLogEvent) int64 {
+	return int64(len(aws.StringValue(e.Message))+len(aws.StringValue(e.LogStreamName))+len(aws.StringValue(e.EventId))) + eventOverhead
+}
+
+// withPageBudget applies the scan budget configured on the datasource on top of the org quota.
+func (q orgQuota) withPageBudget(pages int) orgQuota {
+	if pages > 0 && (q.MaxPages == 0 || pages < q.MaxPages) {
+		q.MaxPages = pages
+	}
+	return q
+}
+
+// withChunkPages stops pagination after the given number of pages, leaving the rest to a following request.
+func (q orgQuota) withChunkPages(pages int) orgQuota {
+	q.chunkPages = pages
+	return q
+}
+
+func acquireQuerySlot(orgId int64, quota orgQuota) error {
+	runningQueryLock.Lock()
+	defer runningQueryLock.Unlock()
+	if quota.MaxConcurrentQueries > 0 && runningQueries[orgId] >= quota.MaxConcurrentQueries {
+		return fmt.Errorf("too many concurrent queries for org %d, the limit is %d", orgId, quota.MaxConcurrentQueries)
+	}
+	runningQueries[orgId]++
+	return nil
+}
+
+func releaseQuerySlot(orgId int64) {
+	runningQueryLock.Lock()
+	defer runningQueryLock.Unlock()
+	runningQueries[orgId]--
+	if runningQueries[orgId] <= 0 {
+		delete(runningQueries, orgId)
+	}
+}
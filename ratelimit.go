@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// tokenBucket limits the CloudWatch Logs calls of a datasource, so that a busy datasource does not use up
+// the API quota of the account it shares with other datasources.
+type tokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+var (
+	rateLimiters    = make(map[int64]*tokenBucket)
+	rateLimiterLock sync.Mutex
+)
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := float64(burst)
+	if b < 1 {
+		b = rate
+	}
+	if b < 1 {
+		b = 1
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+// rateLimiterFor returns the bucket of the datasource, or nil when it has no rate limit.
+// The bucket is replaced when the settings change, and kept otherwise, so that it is shared by every request.
+func rateLimiterFor(datasourceId int64, dsInfo *DatasourceInfo) *tokenBucket {
+	rateLimiterLock.Lock()
+	defer rateLimiterLock.Unlock()
+	if dsInfo.RateLimit <= 0 {
+		delete(rateLimiters, datasourceId)
+		return nil
+	}
+	b, ok := rateLimiters[datasourceId]
+	if !ok || b.rate != dsInfo.RateLimit || (dsInfo.RateBurst > 0 && b.burst != float64(dsInfo.RateBurst)) {
+		b = newTokenBucket(dsInfo.RateLimit, dsInfo.RateBurst)
+		rateLimiters[datasourceId] = b
+	}
+	return b
+}
+
+// reserve takes a token and returns how long the caller has to wait for it.
+func (b *tokenBucket) reserve() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// handler waits for a token before each attempt of a request, retries included,
+// and fails the request when its context is done first.
+func (b *tokenBucket) handler() request.NamedHandler {
+	return request.NamedHandler{Name: "grafana.RateLimit", Fn: func(r *request.Request) {
+		wait := b.reserve()
+		if wait <= 0 {
+			return
+		}
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+			r.Error = r.Context().Err()
+			r.Retryable = aws.Bool(false)
+		}
+	}}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+const defaultRedactionReplacement = "[REDACTED]"
+
+// redactionPreset is a built-in rule enabled by name in the datasource settings. valid, when set,
+// checks each match, so that numbers which only look like card numbers are left as they are.
+type redactionPreset struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+	valid       func(string) bool
+}
+
+// The presets are applied before the rules of the datasource, in this order.
+var redactionPresets = []redactionPreset{
+	{
+		name:        "email",
+		pattern:     regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		replacement: "[EMAIL]",
+	},
+	{
+		name:        "creditCard",
+		pattern:     regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		replacement: "[CARD]",
+		valid:       luhnValid,
+	},
+	{
+		name:        "awsKeys",
+		pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b|(?i:(aws_?secret_?access_?key|secret_?key)(["']?\s*[:=]\s*["']?))[A-Za-z0-9/+=]{40}`),
+		replacement: "${1}${2}[AWS_KEY]",
+	},
+	{
+		name:        "bearerToken",
+		pattern:     regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9\-._~+/]+=*`),
+		replacement: "${1}[TOKEN]",
+	},
+}
+
+// redactionRule replaces the matches of a regular expression in the messages and fields returned by the API.
+type redactionRule struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+type compiledRedactionRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+	valid       func(string) bool
+}
+
+type redactor struct {
+	rules []compiledRedactionRule
+}
+
+// newRedactor compiles the redaction presets and rules of the datasource, and returns nil when it has none.
+func newRedactor(dsInfo *DatasourceInfo) (*redactor, error) {
+	r := &redactor{}
+	for name, enabled := range dsInfo.RedactionPresets {
+		if enabled && findRedactionPreset(name) == nil {
+			return nil, fmt.Errorf("unknown redaction preset %q", name)
+		}
+	}
+	for _, p := range redactionPresets {
+		if dsInfo.RedactionPresets[p.name] {
+			r.rules = append(r.rules, compiledRedactionRule{pattern: p.pattern, replacement: p.replacement, valid: p.valid})
+		}
+	}
+	for _, rule := range dsInfo.RedactionRules {
+		if rule.Pattern == "" {
+			continue
+		}
+		p, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction rule %q: %v", rule.Pattern, err)
+		}
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = defaultRedactionReplacement
+		}
+		r.rules = append(r.rules, compiledRedactionRule{pattern: p, replacement: replacement})
+	}
+	if len(r.rules) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// redactionKey identifies the redaction rules of the datasource, so that results cached before the rules changed are not served.
+func (dsInfo *DatasourceInfo) redactionKey() string {
+	if len(dsInfo.RedactionRules) == 0 && len(dsInfo.RedactionPresets) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(struct {
+		Presets map[string]bool
+		Rules   []redactionRule
+	}{dsInfo.RedactionPresets, dsInfo.RedactionRules})
+	sum := sha256.Sum256(b)
+	return "/redacted:" + hex.EncodeToString(sum[:8])
+}
+
+func (r *redactor) redact(s *string) {
+	if s == nil {
+		return
+	}
+	v := *s
+	for _, rule := range r.rules {
+		if rule.valid == nil {
+			v = rule.pattern.ReplaceAllString(v, rule.replacement)
+			continue
+		}
+		v = rule.pattern.ReplaceAllStringFunc(v, func(m string) string {
+			if rule.valid(m) {
+				return rule.replacement
+			}
+			return m
+		})
+	}
+	*s = v
+}
+
+func findRedactionPreset(name string) *redactionPreset {
+	for i := range redactionPresets {
+		if redactionPresets[i].name == name {
+			return &redactionPresets[i]
+		}
+	}
+	return nil
+}
+
+// luhnValid checks the digits of a card number, ignoring separators.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// handler redacts the responses of a client once they are unmarshalled, so that every query type
+// and the result cache only see redacted messages.
+func (r *redactor) handler() request.NamedHandler {
+	return request.NamedHandler{Name: "grafana.Redact", Fn: func(req *request.Request) {
+		switch out := req.Data.(type) {
+		case *cloudwatchlogs.FilterLogEventsOutput:
+			for _, e := range out.Events {
+				r.redact(e.Message)
+			}
+		case *cloudwatchlogs.GetLogEventsOutput:
+			for _, e := range out.Events {
+				r.redact(e.Message)
+			}
+		case *cloudwatchlogs.GetQueryResultsOutput:
+			for _, row := range out.Results {
+				for _, f := range row {
+					if aws.StringValue(f.Field) != "@ptr" {
+						r.redact(f.Value)
+					}
+				}
+			}
+		case *cloudwatchlogs.GetLogRecordOutput:
+			for k, v := range out.LogRecord {
+				if k != "@ptr" {
+					r.redact(v)
+				}
+			}
+		}
+	}}
+}
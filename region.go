@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+var regionVariablePattern = regexp.MustCompile(`\$(\w+)|\$\{(\w+)\}|\[\[(\w+)\]\]`)
+
+// interpolateRegion replaces dashboard variables ($var, ${var} or [[var]]) in region with the values sent by the frontend.
+func interpolateRegion(region string, variables map[string]string) (string, error) {
+	var missing []string
+	region = regionVariablePattern.ReplaceAllStringFunc(region, func(ref string) string {
+		m := regionVariablePattern.FindStringSubmatch(ref)
+		name := m[1] + m[2] + m[3]
+		v, ok := variables[name]
+		if !ok {
+			missing = append(missing, name)
+			return ref
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("region variable %s is not defined", strings.Join(missing, ", "))
+	}
+	return strings.TrimSpace(region), nil
+}
+
+// resolveRegion interpolates the region of the target and checks that it is a valid AWS region.
+// An empty region or "default" falls back to the default region of the datasource.
+func (target *Target) resolveRegion(defaultRegion string) error {
+	region, err := interpolateRegion(target.Region, target.Variables)
+	if err != nil {
+		return err
+	}
+	if region == "" || region == "default" {
+		region = defaultRegion
+	}
+	if _, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); !ok {
+		return fmt.Errorf("unknown region %q", region)
+	}
+	target.Region = region
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+type resourceQueryFunc func(t *AwsCloudWatchLogsDatasource, ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error)
+
+// The plugin protocol has no resource calls, so the frontend calls these as queries with a dedicated queryType,
+// and the result is returned under the RefId of the query, the queryType itself for the calls of the frontend.
+// The account tables are also run as panel queries, with the queryType selected in the query editor.
+var resourceQueries = map[string]resourceQueryFunc{
+	"logRecordQuery":          (*AwsCloudWatchLogsDatasource).logRecordQuery,
+	"logContextQuery":         (*AwsCloudWatchLogsDatasource).logContextQuery,
+	"fieldStatsQuery":         (*AwsCloudWatchLogsDatasource).fieldStatsQuery,
+	"jsonFieldsQuery":         (*AwsCloudWatchLogsDatasource).jsonFieldsQuery,
+	"patternSuggestionsQuery": (*AwsCloudWatchLogsDatasource).patternSuggestionsQuery,
+	"presetsQuery":            (*AwsCloudWatchLogsDatasource).presetsQuery,
+	"loadMoreQuery":           (*AwsCloudWatchLogsDatasource).loadMoreQuery,
+	"previewQuery":            (*AwsCloudWatchLogsDatasource).previewQuery,
+	"snapshotQuery":           (*AwsCloudWatchLogsDatasource).snapshotQuery,
+	"tailQuery":               (*AwsCloudWatchLogsDatasource).tailQuery,
+	"permissionsQuery":        (*AwsCloudWatchLogsDatasource).permissionsQuery,
+	"diagnosticsQuery":        (*AwsCloudWatchLogsDatasource).diagnosticsQuery,
+	"costQuery":               (*AwsCloudWatchLogsDatasource).costQuery,
+
+	"putMetricFilterQuery":    (*AwsCloudWatchLogsDatasource).putMetricFilterQuery,
+	"putQueryDefinitionQuery": (*AwsCloudWatchLogsDatasource).putQueryDefinitionQuery,
+
+	"queryTemplatesQuery":   (*AwsCloudWatchLogsDatasource).queryTemplatesQuery,
+	"putQueryTemplateQuery": (*AwsCloudWatchLogsDatasource).putQueryTemplateQuery,
+
+	"exportTasksQuery":      (*AwsCloudWatchLogsDatasource).exportTasksQuery,
+	"resourcePoliciesQuery": (*AwsCloudWatchLogsDatasource).resourcePoliciesQuery,
+	"dataProtectionQuery":   (*AwsCloudWatchLogsDatasource).dataProtectionQuery,
+}
+
+// eventResourceQueries read log events, so that they take a query slot of the org and of the scheduler as panel queries do.
+var eventResourceQueries = map[string]bool{
+	"logRecordQuery":          true,
+	"logContextQuery":         true,
+	"fieldStatsQuery":         true,
+	"jsonFieldsQuery":         true,
+	"patternSuggestionsQuery": true,
+	"loadMoreQuery":           true,
+	"previewQuery":            true,
+	"snapshotQuery":           true,
+	"tailQuery":               true,
+}
+
+func (t *AwsCloudWatchLogsDatasource) resourceQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, queryType string, parameters *simplejson.Json) (*datasource.DatasourceResponse, error) {
+	r, err := resourceQueries[queryType](t, ctx, tsdbReq, parameters)
+	if err != nil {
+		return nil, err
+	}
+	r.RefId = tsdbReq.Queries[0].RefId
+	if r.RefId == "" {
+		r.RefId = queryType
+	}
+	return &datasource.DatasourceResponse{
+		Results: []*datasource.QueryResult{r},
+	}, nil
+}
+
+// logRecordQuery returns every field of the log event referenced by an Insights @ptr value.
+func (t *AwsCloudWatchLogsDatasource) logRecordQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	pointer := parameters.Get("logRecordPointer").MustString()
+	if pointer == "" {
+		return nil, fmt.Errorf("logRecordPointer is required")
+	}
+	audit := newAuditRecord(tsdbReq.Datasource, &Target{RefId: tsdbReq.Queries[0].RefId, Region: parameters.Get("region").MustString()}, 0, 0)
+	audit.QueryType = "logRecordQuery"
+	audit.LogRecordPointer = pointer
+	t.audit(tsdbReq.Datasource, audit)
+	svc, err := t.getClient(tsdbReq.Datasource, parameters.Get("region").MustString())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := svc.GetLogRecordWithContext(ctx, &cloudwatchlogs.GetLogRecordInput{
+		LogRecordPointer: aws.String(pointer),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(resp.LogRecord))
+	for f := range resp.LogRecord {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	table := &datasource.Table{
+		Columns: []*datasource.TableColumn{{Name: "Field"}, {Name: "Value"}},
+	}
+	record := make(map[string]string, len(fields))
+	for _, f := range fields {
+		v := aws.StringValue(resp.LogRecord[f])
+		record[f] = v
+		table.Rows = append(table.Rows, &datasource.TableRow{
+			Values: []*datasource.RowValue{
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: f},
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: v},
+			},
+		})
+	}
+	metaJson, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &datasource.QueryResult{
+		Tables:   []*datasource.Table{table},
+		MetaJson: string(metaJson),
+	}, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// policyStatement is a statement of an IAM policy document, whose fields are either a value or a list.
+type policyStatement struct {
+	Sid       string
+	Effect    string
+	Principal interface{}
+	Action    interface{}
+	Resource  interface{}
+}
+
+// describeResourcePolicies returns the resource policies of the account, which allow AWS services to write to its log groups.
+func describeResourcePolicies(ctx context.Context, svc *cloudwatchlogs.CloudWatchLogs) ([]*cloudwatchlogs.ResourcePolicy, error) {
+	policies := make([]*cloudwatchlogs.ResourcePolicy, 0)
+	input := &cloudwatchlogs.DescribeResourcePoliciesInput{}
+	for len(policies) <= 100 { // safety limit, the account has at most 10
+		resp, err := svc.DescribeResourcePoliciesWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, resp.ResourcePolicies...)
+		if resp.NextToken == nil {
+			break
+		}
+		input.NextToken = resp.NextToken
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return aws.StringValue(policies[i].PolicyName) < aws.StringValue(policies[j].PolicyName)
+	})
+	return policies, nil
+}
+
+// resourcePoliciesQuery returns the statements of the resource policies of the account, one row per statement,
+// with the principals, actions and log groups they allow, so that security teams can audit which services write to the log groups.
+// The document of a policy which can not be parsed is returned as is in a single row.
+func (t *AwsCloudWatchLogsDatasource) resourcePoliciesQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	svc, err := t.getClient(tsdbReq.Datasource, parameters.Get("region").MustString())
+	if err != nil {
+		return nil, err
+	}
+	policies, err := describeResourcePolicies(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &datasource.Table{
+		Columns: []*datasource.TableColumn{
+			{Name: "PolicyName"}, {Name: "LastUpdated"}, {Name: "Sid"}, {Name: "Effect"}, {Name: "Principals"}, {Name: "Actions"}, {Name: "Resources"},
+		},
+	}
+	for _, p := range policies {
+		var document struct {
+			Statement interface{}
+		}
+		statements := make([]policyStatement, 0)
+		if err := json.Unmarshal([]byte(aws.StringValue(p.PolicyDocument)), &document); err == nil {
+			statements = parsePolicyStatements(document.Statement)
+		}
+		if len(statements) == 0 {
+			statements = append(statements, policyStatement{Resource: aws.StringValue(p.PolicyDocument)})
+		}
+		for _, s := range statements {
+			table.Rows = append(table.Rows, &datasource.TableRow{
+				Values: []*datasource.RowValue{
+					{Kind: datasource.RowValue_TYPE_STRING, StringValue: aws.StringValue(p.PolicyName)},
+					{Kind: datasource.RowValue_TYPE_STRING, StringValue: formatMillis(aws.Int64Value(p.LastUpdatedTime))},
+					{Kind: datasource.RowValue_TYPE_STRING, StringValue: s.Sid},
+					{Kind: datasource.RowValue_TYPE_STRING, StringValue: s.Effect},
+					{Kind: datasource.RowValue_TYPE_STRING, StringValue: strings.Join(policyPrincipals(s.Principal), ", ")},
+					{Kind: datasource.RowValue_TYPE_STRING, StringValue: strings.Join(policyValues(s.Action), ", ")},
+					{Kind: datasource.RowValue_TYPE_STRING, StringValue: strings.Join(policyValues(s.Resource), ", ")},
+				},
+			})
+		}
+	}
+	return &datasource.QueryResult{
+		Tables: []*datasource.Table{table},
+	}, nil
+}
+
+// parsePolicyStatements reads the Statement of a policy document, a statement or a list of them.
+func parsePolicyStatements(statement interface{}) []policyStatement {
+	list, ok := statement.([]interface{})
+	if !ok {
+		list = []interface{}{statement}
+	}
+	statements := make([]policyStatement, 0, len(list))
+	for _, item := range list {
+		b, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+		var s policyStatement
+		if err := json.Unmarshal(b, &s); err == nil && s.Effect != "" {
+			statements = append(statements, s)
+		}
+	}
+	return statements
+}
+
+// policyPrincipals lists the principals of a statement, prefixed with their type unless they are services, e.g. AWS:123456789012.
+func policyPrincipals(principal interface{}) []string {
+	object, ok := principal.(map[string]interface{})
+	if !ok {
+		return policyValues(principal)
+	}
+	principals := make([]string, 0)
+	for kind, values := range object {
+		for _, v := range policyValues(values) {
+			if kind != "Service" {
+				v = kind + ":" + v
+			}
+			principals = append(principals, v)
+		}
+	}
+	sort.Strings(principals)
+	return principals
+}
+
+func policyValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// Results of time ranges which ended a while ago do not change, so they are kept in memory, compressed,
+// to serve dashboards reloaded by several users. cacheSizeEnv sets the size in MB of the compressed results, 0 disables the cache.
+const (
+	cacheSizeEnv = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_CACHE_SIZE_MB"
+	cacheTTLEnv  = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_CACHE_TTL"
+)
+
+// cacheSettleDelay is how long after the end of a range events may still be ingested, so that ranges ending later are not cached.
+const cacheSettleDelay = 10 * time.Minute
+
+type cachedResult struct {
+	key       string
+	data      []byte
+	expiresAt time.Time
+}
+
+type resultCache struct {
+	lock    sync.Mutex
+	maxSize int
+	ttl     time.Duration
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	hits    int64
+	misses  int64
+}
+
+type resultCacheStats struct {
+	Entries      int
+	SizeBytes    int
+	MaxSizeBytes int
+	TTL          string
+	Hits         int64
+	Misses       int64
+	HitRate      float64
+}
+
+var eventCache = newResultCache(64<<20, 1*time.Hour)
+
+func init() {
+	if v := os.Getenv(cacheSizeEnv); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			pluginLogger.Error("invalid cache size", "env", cacheSizeEnv, "value", v)
+		} else {
+			eventCache.maxSize = n << 20
+		}
+	}
+	if v := os.Getenv(cacheTTLEnv); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			pluginLogger.Error("invalid cache ttl", "env", cacheTTLEnv, "value", v)
+		} else {
+			eventCache.ttl = d
+		}
+	}
+}
+
+func newResultCache(maxSize int, ttl time.Duration) *resultCache {
+	return &resultCache{
+		maxSize: maxSize,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+type cachedFetch struct {
+	Resp  *cloudwatchlogs.FilterLogEventsOutput
+	Stats *queryStats
+}
+
+// cacheKey returns the key of the events of target, or false when they may still change.
+func (target *Target) cacheKey(datasourceId int64, fetchKey string) (string, bool) {
+	if target.LastN > 0 || target.SampleMode != "" || target.Format == "stat" {
+		return "", false
+	}
+	if time.Since(time.Unix(0, target.To*int64(time.Millisecond))) < cacheSettleDelay {
+		return "", false
+	}
+	return fmt.Sprintf("%d/%s", datasourceId, fetchKey), true
+}
+
+func (c *resultCache) get(key string) (*fetchResult, bool) {
+	if key == "" {
+		return nil, false // not cacheable
+	}
+	c.lock.Lock()
+	el, ok := c.entries[key]
+	if ok && time.Now().After(el.Value.(*cachedResult).expiresAt) {
+		c.remove(el)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		c.lock.Unlock()
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(el)
+	data := el.Value.(*cachedResult).data
+	c.lock.Unlock()
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	defer zr.Close()
+	var f cachedFetch
+	if err := json.NewDecoder(zr).Decode(&f); err != nil {
+		return nil, false
+	}
+	return &fetchResult{resp: f.Resp, stats: f.Stats}, true
+}
+
+// put compresses results with gzip at its fastest level rather than zstd or snappy, which are not in the dependencies
+// pinned by go.mod; log messages are repetitive text, which gzip shrinks well enough for the cache.
+func (c *resultCache) put(key string, f *fetchResult) {
+	if c.maxSize <= 0 || f.stats.PartialError != "" {
+		return
+	}
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	if err := json.NewEncoder(zw).Encode(cachedFetch{Resp: f.resp, Stats: f.stats}); err != nil {
+		return
+	}
+	if err := zw.Close(); err != nil {
+		return
+	}
+	if buf.Len() > c.maxSize/4 {
+		return // a single result should not evict most of the cache
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	el := c.order.PushFront(&cachedResult{key: key, data: buf.Bytes(), expiresAt: time.Now().Add(c.ttl)})
+	c.entries[key] = el
+	c.size += buf.Len()
+	for c.size > c.maxSize {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *resultCache) stats() resultCacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	s := resultCacheStats{
+		Entries:      len(c.entries),
+		SizeBytes:    c.size,
+		MaxSizeBytes: c.maxSize,
+		TTL:          c.ttl.String(),
+		Hits:         c.hits,
+		Misses:       c.misses,
+	}
+	if c.hits+c.misses > 0 {
+		s.HitRate = float64(c.hits) / float64(c.hits+c.misses)
+	}
+	return s
+}
+
+func (c *resultCache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*cachedResult)
+	delete(c.entries, e.key)
+	c.size -= len(e.data)
+}
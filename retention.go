@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+// retentionTTL is how long the retention of a log group is remembered, so that each query does not look it up again.
+const retentionTTL = 10 * time.Minute
+
+type retentionEntry struct {
+	days      int64
+	expiresAt time.Time
+}
+
+var (
+	logGroupRetentions = make(map[string]retentionEntry)
+	retentionLock      sync.Mutex
+)
+
+// logGroupRetentionDays returns the retention of a log group in days, 0 when its events never expire.
+// The retention is only used to explain missing events, so that a failed lookup is logged and treated as no retention.
+func logGroupRetentionDays(svc *cloudwatchlogs.CloudWatchLogs, datasourceId int64, region string, logGroupName string) int64 {
+	if isLogGroupArn(logGroupName) {
+		return 0 // DescribeLogGroups only takes a name prefix, and the log group may be in another account
+	}
+	key := fmt.Sprintf("%d/%s/%s", datasourceId, region, logGroupName)
+	retentionLock.Lock()
+	e, ok := logGroupRetentions[key]
+	retentionLock.Unlock()
+	if ok && time.Now().Before(e.expiresAt) {
+		return e.days
+	}
+
+	e = retentionEntry{expiresAt: time.Now().Add(retentionTTL)}
+	resp, err := svc.DescribeLogGroups(&cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(logGroupName),
+		Limit:              aws.Int64(1),
+	})
+	if err != nil {
+		pluginLogger.Debug("failed to get the retention of the log group", "logGroup", logGroupName, "error", err)
+	} else {
+		for _, g := range resp.LogGroups {
+			if aws.StringValue(g.LogGroupName) == logGroupName {
+				e.days = aws.Int64Value(g.RetentionInDays)
+			}
+		}
+	}
+	retentionLock.Lock()
+	logGroupRetentions[key] = e
+	retentionLock.Unlock()
+	return e.days
+}
+
+// retentionExpiryWarning warns when the start of the target falls out of the retention of the log group within the given period,
+// so that teams reviewing an incident know to export its events before they disappear.
+func (target *Target) retentionExpiryWarning(days int64, within time.Duration, now time.Time) string {
+	if days <= 0 || within <= 0 {
+		return ""
+	}
+	expiresAt := time.Unix(0, target.From*int64(time.Millisecond)).Add(time.Duration(days) * 24 * time.Hour)
+	left := expiresAt.Sub(now)
+	if left > within {
+		return ""
+	}
+	in := fmt.Sprintf("%d hours", int64(left.Hours())+1)
+	if left >= 24*time.Hour {
+		in = fmt.Sprintf("%d days", int64(left.Hours()/24))
+	}
+	return fmt.Sprintf("the start of the range falls out of the %d days retention of the log group in %s, on %s", days, in, expiresAt.UTC().Format(time.RFC3339))
+}
+
+// clampToRetention moves the start of the target to the oldest events kept by the log group,
+// and reports whether the time range started before them.
+func (target *Target) clampToRetention(days int64, now time.Time) bool {
+	if days <= 0 {
+		return false
+	}
+	oldest := now.Add(-time.Duration(days)*24*time.Hour).UnixNano() / int64(time.Millisecond)
+	if target.From >= oldest {
+		return false
+	}
+	if oldest > target.To {
+		oldest = target.To
+	}
+	target.From = oldest
+	target.Input.StartTime = aws.Int64(oldest)
+	return true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const (
+	defaultMaxRetries     = 3
+	defaultRetryBaseDelay = 30 * time.Millisecond
+	maxRetryDelay         = 20 * time.Second
+)
+
+// jitterRetryer applies exponential backoff with the jitter mode configured on the datasource.
+type jitterRetryer struct {
+	client.DefaultRetryer
+	baseDelay time.Duration
+	jitter    string
+}
+
+func newRetryer(dsInfo *DatasourceInfo) request.Retryer {
+	r := jitterRetryer{
+		DefaultRetryer: client.DefaultRetryer{NumMaxRetries: defaultMaxRetries},
+		baseDelay:      defaultRetryBaseDelay,
+		jitter:         dsInfo.RetryJitter,
+	}
+	if dsInfo.MaxRetries != nil {
+		r.NumMaxRetries = *dsInfo.MaxRetries
+	}
+	if dsInfo.RetryBaseDelayMs > 0 {
+		r.baseDelay = time.Duration(dsInfo.RetryBaseDelayMs) * time.Millisecond
+	}
+	return r
+}
+
+func (r jitterRetryer) RetryRules(req *request.Request) time.Duration {
+	backoff := maxRetryDelay
+	if req.RetryCount < 30 {
+		if d := r.baseDelay << uint(req.RetryCount); d > 0 && d < maxRetryDelay {
+			backoff = d
+		}
+	}
+
+	switch r.jitter {
+	case "none":
+		return backoff
+	case "equal":
+		return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	default: // full
+		return time.Duration(rand.Int63n(int64(backoff) + 1))
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+// sampler thins out the events collected during pagination,
+// so that a representative view of a large log group fits in the events limit.
+// Every matched event is still counted per interval, so that the true counts can be returned with the sample.
+type sampler struct {
+	mode        string
+	every       int64
+	probability float64
+	size        int64
+	keep        int64
+	rand        *rand.Rand
+	intervalMs  int64
+	matched     int64
+	counts      map[int64]float64
+}
+
+func (target *Target) newSampler() (*sampler, error) {
+	if target.Format == "stat" && target.LastN == 0 {
+		// events are only counted, so that the total is not capped by the events limit,
+		// and only the first ones are kept when they are sent with an alert
+		return &sampler{mode: "count", keep: int64(target.sampleLines()), intervalMs: target.IntervalMs, counts: make(map[int64]float64)}, nil
+	}
+	if target.SampleMode == "" {
+		return nil, nil
+	}
+	s := &sampler{
+		mode:       target.SampleMode,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		intervalMs: target.IntervalMs,
+		counts:     make(map[int64]float64),
+	}
+	switch target.SampleMode {
+	case "nth":
+		if target.SampleRate < 1 {
+			return nil, fmt.Errorf("the sample rate of nth sampling should be 1 or more")
+		}
+		s.every = int64(target.SampleRate)
+	case "probabilistic":
+		if target.SampleRate <= 0 || target.SampleRate > 1 {
+			return nil, fmt.Errorf("the sample rate of probabilistic sampling should be between 0 and 1")
+		}
+		s.probability = target.SampleRate
+	case "reservoir":
+		if target.SampleRate < 1 {
+			return nil, fmt.Errorf("the sample size of reservoir sampling should be 1 or more")
+		}
+		s.size = int64(target.SampleRate)
+	default:
+		return nil, fmt.Errorf("unknown sample mode %q", target.SampleMode)
+	}
+	return s, nil
+}
+
+// bounded reports whether the sample size is fixed, in which case pagination continues until every event is seen.
+func (s *sampler) bounded() bool {
+	return s != nil && (s.mode == "reservoir" || s.mode == "count")
+}
+
+// add is called for every matched event, and returns events with e added when e is part of the sample.
+func (s *sampler) add(events []*cloudwatchlogs.FilteredLogEvent, e *cloudwatchlogs.FilteredLogEvent) []*cloudwatchlogs.FilteredLogEvent {
+	if s == nil {
+		return append(events, e)
+	}
+	s.matched++
+	s.counts[bucketTimestamp(aws.Int64Value(e.Timestamp), s.intervalMs)]++
+	switch s.mode {
+	case "nth":
+		if (s.matched-1)%s.every == 0 {
+			return append(events, e)
+		}
+	case "probabilistic":
+		if s.rand.Float64() < s.probability {
+			return append(events, e)
+		}
+	case "count":
+		if int64(len(events)) < s.keep {
+			return append(events, e)
+		}
+	case "reservoir":
+		if int64(len(events)) < s.size {
+			return append(events, e)
+		}
+		if j := s.rand.Int63n(s.matched); j < s.size {
+			events[j] = e
+		}
+	}
+	return events
+}
+
+// forGroup returns a sampler of the same mode for one of the log groups of a target, which are paginated in parallel.
+func (s *sampler) forGroup() *sampler {
+	if s == nil {
+		return nil
+	}
+	g := *s
+	g.matched = 0
+	g.counts = make(map[int64]float64)
+	if s.rand != nil {
+		g.rand = rand.New(rand.NewSource(s.rand.Int63()))
+	}
+	return &g
+}
+
+// mergeGroups adds the counts of the samplers of the log groups to s, and returns their samples together.
+// Reservoir samples are reduced to the sample size with a weighted sample, each event standing for the matched events
+// of its log group over the size of its sample, and the events kept by count samplers to the first ones.
+func (s *sampler) mergeGroups(samplers []*sampler, samples [][]*cloudwatchlogs.FilteredLogEvent) []*cloudwatchlogs.FilteredLogEvent {
+	type weightedEvent struct {
+		event *cloudwatchlogs.FilteredLogEvent
+		key   float64
+	}
+	events := make([]*cloudwatchlogs.FilteredLogEvent, 0)
+	weighted := make([]weightedEvent, 0)
+	for i, g := range samplers {
+		s.matched += g.matched
+		for ts, c := range g.counts {
+			s.counts[ts] += c
+		}
+		events = append(events, samples[i]...)
+		if s.mode == "reservoir" && len(samples[i]) > 0 {
+			weight := float64(g.matched) / float64(len(samples[i]))
+			for _, e := range samples[i] {
+				weighted = append(weighted, weightedEvent{event: e, key: math.Pow(s.rand.Float64(), 1/weight)})
+			}
+		}
+	}
+	if s.mode == "reservoir" && int64(len(weighted)) > s.size {
+		sort.Slice(weighted, func(i, j int) bool { return weighted[i].key > weighted[j].key })
+		events = events[:0]
+		for _, w := range weighted[:s.size] {
+			events = append(events, w.event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return *events[i].Timestamp < *events[j].Timestamp })
+	if s.mode == "count" && int64(len(events)) > s.keep {
+		events = events[:s.keep]
+	}
+	return events
+}
+
+// finish restores the time order of a reservoir sample.
+func (s *sampler) finish(events []*cloudwatchlogs.FilteredLogEvent) {
+	if s.bounded() {
+		sort.SliceStable(events, func(i, j int) bool { return *events[i].Timestamp < *events[j].Timestamp })
+	}
+}
+
+// totalSeries returns the number of matched events as a single point at the end of the range, for stat panels.
+func (s *sampler) totalSeries(to int64) *datasource.TimeSeries {
+	return &datasource.TimeSeries{Name: "events", Points: []*datasource.Point{{Timestamp: to, Value: float64(s.matched)}}}
+}
+
+// countSeries returns the number of matched events per interval, including the events left out of the sample.
+func (s *sampler) countSeries() *datasource.TimeSeries {
+	timestamps := make([]int64, 0, len(s.counts))
+	for ts := range s.counts {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	series := &datasource.TimeSeries{Name: "matched"}
+	for _, ts := range timestamps {
+		series.Points = append(series.Points, &datasource.Point{Timestamp: ts, Value: s.counts[ts]})
+	}
+	return series
+}
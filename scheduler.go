@@ -0,0 +1,147 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// maxRunningQueriesEnv sets the number of queries the plugin runs at the same time, across orgs, 0 disables the scheduler.
+const maxRunningQueriesEnv = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_MAX_RUNNING_QUERIES"
+
+// querySchedulerWaiter is a query waiting for a slot; ready is closed when the slot is given to it.
+type querySchedulerWaiter struct {
+	key   string
+	ready chan struct{}
+	el    *list.Element
+}
+
+// queryScheduler limits the running queries, and gives the slots freed to the waiting queries of each org
+// and datasource in turn rather than in arrival order, so that the panels of a large dashboard queued
+// by one org do not hold back the queries of the others.
+type queryScheduler struct {
+	lock    sync.Mutex
+	slots   int
+	running int
+	queues  map[string]*list.List
+	keys    []string
+	next    int
+}
+
+type querySchedulerStats struct {
+	Slots   int
+	Running int
+	Queued  int
+}
+
+var scheduler = &queryScheduler{queues: make(map[string]*list.List)}
+
+var queryQueueDuration = newHistogram("query_queue_seconds", "Time queries waited for a slot in seconds.", []float64{0.01, 0.1, 0.5, 1, 2.5, 5, 10})
+
+func init() {
+	if v := os.Getenv(maxRunningQueriesEnv); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			pluginLogger.Error("invalid max running queries", "env", maxRunningQueriesEnv, "value", v)
+		} else {
+			scheduler.slots = n
+		}
+	}
+}
+
+func schedulerKey(orgId int64, datasourceId int64) string {
+	return fmt.Sprintf("%d/%d", orgId, datasourceId)
+}
+
+// acquire waits for a slot until the context is done. The slot has to be released once the query returned.
+func (s *queryScheduler) acquire(ctx context.Context, key string) error {
+	s.lock.Lock()
+	if s.slots <= 0 || (s.running < s.slots && len(s.keys) == 0) {
+		s.running++
+		s.lock.Unlock()
+		return nil
+	}
+	w := &querySchedulerWaiter{key: key, ready: make(chan struct{})}
+	q, ok := s.queues[key]
+	if !ok {
+		q = list.New()
+		s.queues[key] = q
+		s.keys = append(s.keys, key)
+	}
+	w.el = q.PushBack(w)
+	s.lock.Unlock()
+
+	started := time.Now()
+	defer func() { queryQueueDuration.observe(time.Since(started).Seconds()) }()
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.lock.Lock()
+	select {
+	case <-w.ready:
+		// the slot was given while the context was done, so that it is passed on to the next query
+		s.lock.Unlock()
+		s.release()
+	default:
+		s.dequeue(w)
+		s.lock.Unlock()
+	}
+	return fmt.Errorf("the query waited for other queries until its deadline, try again later")
+}
+
+// release gives the slot to the first waiting query of the next org and datasource, or frees it.
+func (s *queryScheduler) release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.keys) == 0 {
+		s.running--
+		return
+	}
+	if s.next >= len(s.keys) {
+		s.next = 0
+	}
+	key := s.keys[s.next]
+	w := s.queues[key].Front().Value.(*querySchedulerWaiter)
+	if s.dequeue(w) {
+		s.next++
+	}
+	close(w.ready)
+}
+
+// dequeue removes a waiting query, and returns whether its key still has queries waiting.
+func (s *queryScheduler) dequeue(w *querySchedulerWaiter) bool {
+	q := s.queues[w.key]
+	q.Remove(w.el)
+	if q.Len() > 0 {
+		return true
+	}
+	delete(s.queues, w.key)
+	for i, k := range s.keys {
+		if k == w.key {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			if i < s.next {
+				s.next--
+			}
+			break
+		}
+	}
+	return false
+}
+
+func (s *queryScheduler) stats() querySchedulerStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	st := querySchedulerStats{Slots: s.slots, Running: s.running}
+	for _, q := range s.queues {
+		st.Queued += q.Len()
+	}
+	return st
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"container/list"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestQuerySchedulerDisabled(t *testing.T) {
+	s := &queryScheduler{queues: make(map[string]*list.List)}
+	for i := 0; i < 100; i++ {
+		if err := s.acquire(context.Background(), "1/1"); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+	if st := s.stats(); st.Running != 100 || st.Queued != 0 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestQuerySchedulerFairness(t *testing.T) {
+	tests := []struct {
+		name   string
+		queued []string
+		want   []string
+	}{
+		{"one key", []string{"1/1", "1/1", "1/1"}, []string{"1/1", "1/1", "1/1"}},
+		{"keys in turn", []string{"1/1", "1/1", "1/1", "2/1", "3/1"}, []string{"1/1", "2/1", "3/1", "1/1", "1/1"}},
+		{"late key", []string{"1/1", "1/1", "2/1", "2/1"}, []string{"1/1", "2/1", "1/1", "2/1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &queryScheduler{slots: 1, queues: make(map[string]*list.List)}
+			if err := s.acquire(context.Background(), "0/0"); err != nil {
+				t.Fatal(err)
+			}
+			started := make(chan string, len(tt.queued))
+			for i, key := range tt.queued {
+				go func(key string) {
+					if err := s.acquire(context.Background(), key); err != nil {
+						t.Error(err)
+					}
+					started <- key
+				}(key)
+				waitQueued(t, s, i+1)
+			}
+			for i, want := range tt.want {
+				s.release()
+				if got := <-started; got != want {
+					t.Fatalf("query %d started for %s, want %s", i, got, want)
+				}
+			}
+			if st := s.stats(); st.Running != 1 || st.Queued != 0 {
+				t.Fatalf("stats = %+v", st)
+			}
+		})
+	}
+}
+
+func TestQuerySchedulerDeadline(t *testing.T) {
+	s := &queryScheduler{slots: 1, queues: make(map[string]*list.List)}
+	if err := s.acquire(context.Background(), "1/1"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.acquire(ctx, "2/1"); err == nil {
+		t.Fatal("acquire returned no error at the deadline")
+	}
+	s.release()
+	if st := s.stats(); st.Running != 0 || st.Queued != 0 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func waitQueued(t *testing.T, s *queryScheduler, n int) {
+	for i := 0; i < 1000; i++ {
+		if s.stats().Queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d queries queued, want %d", s.stats().Queued, n)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+const (
+	defaultTopStreams = 5
+	defaultLevelField = "level"
+	maxStreamSeries   = 100
+)
+
+var logLevelPattern = regexp.MustCompile(`(?i)\b(fatal|critical|error|err|warning|warn|info|debug|trace)\b`)
+
+func bucketTimestamp(timestamp int64, intervalMs int64) int64 {
+	if intervalMs <= 0 {
+		intervalMs = 1000
+	}
+	return timestamp - timestamp%intervalMs
+}
+
+// ratable reports whether the series of the target sum events or values per interval, so that they can be turned into rates.
+func (target *Target) ratable() bool {
+	switch target.Format {
+	case "top_streams", "stream_series", "level_counts":
+		return true
+	case "timeserie":
+		return target.Preset != "" || target.SampleMode != ""
+	}
+	return false
+}
+
+// rateSeries divides the points of the series by the interval in seconds, e.g. into events per second,
+// so that panels with different intervals are comparable.
+func rateSeries(series []*datasource.TimeSeries, intervalMs int64) {
+	if intervalMs <= 0 {
+		intervalMs = 1000
+	}
+	seconds := float64(intervalMs) / 1000
+	for _, s := range series {
+		for _, p := range s.Points {
+			p.Value /= seconds
+		}
+	}
+}
+
+// countSeries buckets events by interval and groups them into series by the key returned from keyFunc.
+// Events with an empty key are skipped.
+func countSeries(events []*cloudwatchlogs.FilteredLogEvent, intervalMs int64, label string, keyFunc func(e *cloudwatchlogs.FilteredLogEvent) string) []*datasource.TimeSeries {
+	return sumSeries(events, intervalMs, label, func(e *cloudwatchlogs.FilteredLogEvent) (string, float64) {
+		return keyFunc(e), 1
+	})
+}
+
+// sumSeries is like countSeries, but sums the value returned from valueFunc instead of counting events.
+func sumSeries(events []*cloudwatchlogs.FilteredLogEvent, intervalMs int64, label string, valueFunc func(e *cloudwatchlogs.FilteredLogEvent) (string, float64)) []*datasource.TimeSeries {
+	buckets := make(map[string]map[int64]float64)
+	totals := make(map[string]float64)
+	for _, e := range events {
+		key, value := valueFunc(e)
+		if key == "" {
+			continue
+		}
+		if buckets[key] == nil {
+			buckets[key] = make(map[int64]float64)
+		}
+		buckets[key][bucketTimestamp(*e.Timestamp, intervalMs)] += value
+		totals[key] += value
+	}
+
+	keys := make([]string, 0, len(buckets))
+	for k := range buckets {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if totals[keys[i]] != totals[keys[j]] {
+			return totals[keys[i]] > totals[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	series := make([]*datasource.TimeSeries, 0, len(keys))
+	for _, k := range keys {
+		s := &datasource.TimeSeries{
+			Name: k,
+			Tags: map[string]string{label: k},
+		}
+		timestamps := make([]int64, 0, len(buckets[k]))
+		for ts := range buckets[k] {
+			timestamps = append(timestamps, ts)
+		}
+		sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+		for _, ts := range timestamps {
+			s.Points = append(s.Points, &datasource.Point{Timestamp: ts, Value: buckets[k][ts]})
+		}
+		series = append(series, s)
+	}
+	return series
+}
+
+// parseTopStreamsResponse returns event count series for the n busiest log streams.
+func parseTopStreamsResponse(resp *cloudwatchlogs.FilterLogEventsOutput, refId string, intervalMs int64, n int) (*datasource.QueryResult, error) {
+	if n <= 0 {
+		n = defaultTopStreams
+	}
+	series := countSeries(resp.Events, intervalMs, "LogStreamName", func(e *cloudwatchlogs.FilteredLogEvent) string {
+		return *e.LogStreamName
+	})
+	if len(series) > n {
+		series = series[:n]
+	}
+
+	return &datasource.QueryResult{
+		RefId:  refId,
+		Series: series,
+	}, nil
+}
+
+// parseStreamSeriesResponse returns an event count series for every log stream, labeled with the stream name,
+// e.g. to graph the error rate of each instance. The legend format may refer to {{LogStreamName}}.
+func parseStreamSeriesResponse(resp *cloudwatchlogs.FilterLogEventsOutput, refId string, intervalMs int64, legendFormat string) (*datasource.QueryResult, error) {
+	series := countSeries(resp.Events, intervalMs, "LogStreamName", func(e *cloudwatchlogs.FilteredLogEvent) string {
+		return *e.LogStreamName
+	})
+	if len(series) > maxStreamSeries {
+		series = series[:maxStreamSeries]
+	}
+	if legendFormat != "" {
+		for _, s := range series {
+			s.Name = formatLegend(s.Tags, legendFormat)
+		}
+	}
+
+	return &datasource.QueryResult{
+		RefId:  refId,
+		Series: series,
+	}, nil
+}
+
+func normalizeLogLevel(level string) string {
+	switch strings.ToLower(level) {
+	case "fatal", "critical":
+		return "FATAL"
+	case "error", "err":
+		return "ERROR"
+	case "warning", "warn":
+		return "WARN"
+	case "info":
+		return "INFO"
+	case "debug":
+		return "DEBUG"
+	case "trace":
+		return "TRACE"
+	}
+	return ""
+}
+
+// detectLogLevel reads the level from the given field of JSON messages, and falls back to the first level token in the message.
+func detectLogLevel(message string, field string) string {
+	if strings.HasPrefix(message, "{") {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(message), &m); err == nil {
+			if v, ok := m[field]; ok {
+				if level := normalizeLogLevel(fmt.Sprint(v)); level != "" {
+					return level
+				}
+			}
+		}
+	}
+	if match := logLevelPattern.FindStringSubmatch(message); match != nil {
+		return normalizeLogLevel(match[1])
+	}
+	return "UNKNOWN"
+}
+
+// parseLevelCountsResponse returns one event count series per log level.
+func parseLevelCountsResponse(resp *cloudwatchlogs.FilterLogEventsOutput, refId string, intervalMs int64, levelField string) (*datasource.QueryResult, error) {
+	if levelField == "" {
+		levelField = defaultLevelField
+	}
+	series := countSeries(resp.Events, intervalMs, "level", func(e *cloudwatchlogs.FilteredLogEvent) string {
+		return detectLogLevel(*e.Message, levelField)
+	})
+
+	return &datasource.QueryResult{
+		RefId:  refId,
+		Series: series,
+	}, nil
+}
+
+// parseLatestValueResponse returns the most recent numeric value of the field, for gauge panels such as a periodically logged queue depth.
+func parseLatestValueResponse(resp *cloudwatchlogs.FilterLogEventsOutput, refId string, field string, valueFunc func(e *cloudwatchlogs.FilteredLogEvent) string) (*datasource.QueryResult, error) {
+	if field == "" {
+		return nil, fmt.Errorf("the value column is required for the latest format")
+	}
+	var latest *datasource.Point
+	for _, e := range resp.Events {
+		if latest != nil && *e.Timestamp < latest.Timestamp {
+			continue
+		}
+		v, err := strconv.ParseFloat(valueFunc(e), 64)
+		if err != nil {
+			continue
+		}
+		latest = &datasource.Point{Timestamp: *e.Timestamp, Value: v}
+	}
+
+	r := &datasource.QueryResult{RefId: refId}
+	if latest != nil {
+		r.Series = []*datasource.TimeSeries{{Name: field, Points: []*datasource.Point{latest}}}
+	}
+	return r, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+const defaultSmoothingWindow = 5
+
+// smoothSeries smooths count series over a window of intervals, with a moving average of the last intervals
+// or an exponentially weighted moving average whose weights match a window of that size, for noisy low volume log groups.
+// Intervals without events count as zero, so that the series are filled between their first and last points.
+func smoothSeries(series []*datasource.TimeSeries, intervalMs int64, mode string, window int) error {
+	if window <= 0 {
+		window = defaultSmoothingWindow
+	}
+	if intervalMs <= 0 {
+		intervalMs = 1000
+	}
+	var smooth func(values []float64) []float64
+	switch mode {
+	case "moving_average":
+		smooth = func(values []float64) []float64 { return movingAverage(values, window) }
+	case "ewma":
+		smooth = func(values []float64) []float64 { return ewma(values, 2/float64(window+1)) }
+	default:
+		return fmt.Errorf("unknown smoothing %q, it should be moving_average or ewma", mode)
+	}
+
+	for _, s := range series {
+		if len(s.Points) == 0 {
+			continue
+		}
+		first, last := s.Points[0].Timestamp, s.Points[len(s.Points)-1].Timestamp
+		values := make([]float64, (last-first)/intervalMs+1)
+		for _, p := range s.Points {
+			values[(p.Timestamp-first)/intervalMs] += p.Value
+		}
+		points := make([]*datasource.Point, 0, len(values))
+		for i, v := range smooth(values) {
+			points = append(points, &datasource.Point{Timestamp: first + int64(i)*intervalMs, Value: v})
+		}
+		s.Points = points
+	}
+	return nil
+}
+
+func movingAverage(values []float64, window int) []float64 {
+	smoothed := make([]float64, len(values))
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		n := i + 1
+		if i >= window {
+			sum -= values[i-window]
+			n = window
+		}
+		smoothed[i] = sum / float64(n)
+	}
+	return smoothed
+}
+
+func ewma(values []float64, alpha float64) []float64 {
+	smoothed := make([]float64, len(values))
+	for i, v := range values {
+		if i == 0 {
+			smoothed[i] = v
+			continue
+		}
+		smoothed[i] = alpha*v + (1-alpha)*smoothed[i-1]
+	}
+	return smoothed
+}
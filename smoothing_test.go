@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+func floatsEqual(a []float64, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if d := a[i] - b[i]; d > 1e-9 || d < -1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMovingAverage(t *testing.T) {
+	tests := []struct {
+		values []float64
+		window int
+		want   []float64
+	}{
+		{[]float64{}, 3, []float64{}},
+		{[]float64{3, 6, 9, 12}, 1, []float64{3, 6, 9, 12}},
+		{[]float64{3, 6, 9, 12}, 2, []float64{3, 4.5, 7.5, 10.5}},
+		{[]float64{3, 6, 9, 12}, 3, []float64{3, 4.5, 6, 9}},
+		{[]float64{0, 0, 6, 0, 0}, 3, []float64{0, 0, 2, 2, 2}},
+	}
+	for _, tt := range tests {
+		if got := movingAverage(tt.values, tt.window); !floatsEqual(got, tt.want) {
+			t.Errorf("movingAverage(%v, %d) = %v, want %v", tt.values, tt.window, got, tt.want)
+		}
+	}
+}
+
+func TestEwma(t *testing.T) {
+	tests := []struct {
+		values []float64
+		alpha  float64
+		want   []float64
+	}{
+		{[]float64{}, 0.5, []float64{}},
+		{[]float64{4, 4, 4}, 0.5, []float64{4, 4, 4}},
+		{[]float64{4, 0, 0}, 0.5, []float64{4, 2, 1}},
+		{[]float64{0, 8, 8}, 0.25, []float64{0, 2, 3.5}},
+		{[]float64{1, 2, 3}, 1, []float64{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		if got := ewma(tt.values, tt.alpha); !floatsEqual(got, tt.want) {
+			t.Errorf("ewma(%v, %v) = %v, want %v", tt.values, tt.alpha, got, tt.want)
+		}
+	}
+}
+
+func TestSmoothSeries(t *testing.T) {
+	points := func(values ...float64) []*datasource.Point {
+		var p []*datasource.Point
+		for i, v := range values {
+			if v >= 0 {
+				p = append(p, &datasource.Point{Timestamp: int64(i) * 1000, Value: v})
+			}
+		}
+		return p
+	}
+	tests := []struct {
+		name   string
+		in     []*datasource.Point
+		mode   string
+		window int
+		want   []*datasource.Point
+		err    bool
+	}{
+		{name: "missing intervals count as zero", in: points(4, -1, -1, 4), mode: "moving_average", window: 2, want: points(4, 2, 0, 2)},
+		{name: "ewma", in: points(3, 0, 0), mode: "ewma", window: 2, want: points(3, 1, 1.0/3)},
+		{name: "empty", in: nil, mode: "ewma", window: 2, want: nil},
+		{name: "unknown mode", in: points(1), mode: "median", err: true},
+	}
+	for _, tt := range tests {
+		series := []*datasource.TimeSeries{{Points: tt.in}}
+		err := smoothSeries(series, 1000, tt.mode, tt.window)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error = %v", tt.name, err)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+		var got, want []float64
+		for _, p := range series[0].Points {
+			got = append(got, p.Value)
+		}
+		for _, p := range tt.want {
+			want = append(want, p.Value)
+		}
+		if !floatsEqual(got, want) || len(series[0].Points) != len(tt.want) {
+			t.Errorf("%s: values = %v, want %v", tt.name, got, want)
+			continue
+		}
+		for i, p := range series[0].Points {
+			if p.Timestamp != tt.want[i].Timestamp {
+				t.Errorf("%s: timestamp %d = %d, want %d", tt.name, i, p.Timestamp, tt.want[i].Timestamp)
+			}
+		}
+	}
+}
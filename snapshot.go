@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// snapshotVersion is increased when the fields of querySnapshot change incompatibly.
+const snapshotVersion = 1
+
+// querySnapshot is a self-contained record of the events of a query, to attach to an incident ticket
+// or to replay the query later. Target is the query as sent by the frontend, without the variables replaced.
+type querySnapshot struct {
+	Version       int
+	CreatedAt     time.Time
+	Datasource    string
+	Region        string
+	LogGroupName  string
+	FilterPattern string
+	From          time.Time
+	To            time.Time
+	Target        json.RawMessage
+	Stats         *queryStats
+	Warnings      []string `json:",omitempty"`
+	Events        []*cloudwatchlogs.FilteredLogEvent
+}
+
+// snapshotQuery fetches all the events of a filter target, within the limits of the datasource, and returns them
+// with the query and its time range as the meta of the result, independently of the snapshots of Grafana dashboards,
+// which only keep the rendered panels.
+func (t *AwsCloudWatchLogsDatasource) snapshotQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	targetJson, err := parameters.Get("target").MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	target := Target{}
+	if err := json.Unmarshal(targetJson, &target); err != nil {
+		return nil, err
+	}
+	if target.UseInsights {
+		return nil, fmt.Errorf("only filter queries can be exported")
+	}
+
+	dsInfo, err := t.getDsInfo(tsdbReq.Datasource, "")
+	if err != nil {
+		return nil, err
+	}
+	fromRaw, toRaw, err := parseTimeRange(tsdbReq.TimeRange, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := t.prepareTarget(tsdbReq, dsInfo, &target, fromRaw, toRaw); err != nil {
+		return nil, err
+	}
+	svc, err := t.getClient(tsdbReq.Datasource, target.Region)
+	if err != nil {
+		return nil, err
+	}
+	includeStream, err := target.logStreamFilter()
+	if err != nil {
+		return nil, err
+	}
+	t.auditQuery(tsdbReq.Datasource, &target, target.From, target.To)
+	quota := quotaForOrg(tsdbReq.Datasource.OrgId).withDeadline(queryDeadline(ctx, dsInfo)).withPageBudget(dsInfo.ScanBudgetPages)
+	var resp *cloudwatchlogs.FilterLogEventsOutput
+	var stats *queryStats
+	if target.hasMultipleLogGroups() {
+		resp, stats, err = t.getLogEventsFromGroups(svc, &target, quota, includeStream, nil)
+	} else if target.LastN > 0 {
+		resp, stats, err = t.getLastEvents(svc, &target.Input, target.LastN, quota, includeStream)
+	} else {
+		resp, stats, err = t.getLogEvent(svc, &target.Input, target.StartFromHead, quota, includeStream, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := querySnapshot{
+		Version:       snapshotVersion,
+		CreatedAt:     time.Now().UTC(),
+		Datasource:    tsdbReq.Datasource.Name,
+		Region:        target.Region,
+		LogGroupName:  aws.StringValue(target.Input.LogGroupName),
+		FilterPattern: aws.StringValue(target.Input.FilterPattern),
+		From:          time.Unix(0, target.From*int64(time.Millisecond)).UTC(),
+		To:            time.Unix(0, target.To*int64(time.Millisecond)).UTC(),
+		Target:        targetJson,
+		Stats:         stats,
+		Events:        resp.Events,
+	}
+	if stats.Truncated != "" {
+		snapshot.Warnings = append(snapshot.Warnings, "results are truncated: "+stats.Truncated)
+	}
+	if stats.PartialError != "" {
+		snapshot.Warnings = append(snapshot.Warnings, "partial results: "+stats.PartialError)
+	}
+	if snapshot.Events == nil {
+		snapshot.Events = []*cloudwatchlogs.FilteredLogEvent{}
+	}
+	metaJson, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &datasource.QueryResult{MetaJson: string(metaJson)}, nil
+}
@@ -2,21 +2,34 @@ export class AwsCloudWatchLogsDatasourceConfigCtrl {
   current: any;
   accessKeyExist: any;
   secretKeyExist: any;
+  vaultTokenExist: any;
   datasourceSrv: any;
   authTypes: any;
+  auditLogTypes: any;
   static templateUrl = 'config.html';
 
   /** @ngInject */
   constructor($scope, datasourceSrv) {
     this.current.jsonData.authType = this.current.jsonData.authType || 'credentials';
+    this.current.jsonData.logLevel = this.current.jsonData.logLevel || 'info';
+    this.current.jsonData.retryJitter = this.current.jsonData.retryJitter || 'full';
+    this.current.jsonData.redactionPresets = this.current.jsonData.redactionPresets || {};
 
     this.accessKeyExist = this.current.secureJsonFields.accessKey;
     this.secretKeyExist = this.current.secureJsonFields.secretKey;
+    this.vaultTokenExist = this.current.secureJsonFields.vaultToken;
     this.datasourceSrv = datasourceSrv;
     this.authTypes = [
       { name: 'Access & secret key', value: 'keys' },
       { name: 'Credentials file', value: 'credentials' },
       { name: 'ARN', value: 'arn' },
+      { name: 'Vault', value: 'vault' },
+    ];
+    this.auditLogTypes = [
+      { name: 'Disabled', value: '' },
+      { name: 'Plugin log', value: 'log' },
+      { name: 'File', value: 'file' },
+      { name: 'CloudWatch Logs', value: 'cloudwatch' },
     ];
   }
 
@@ -27,4 +40,17 @@ export class AwsCloudWatchLogsDatasourceConfigCtrl {
   resetSecretKey() {
     this.secretKeyExist = false;
   }
+
+  resetVaultToken() {
+    this.vaultTokenExist = false;
+  }
+
+  addRedactionRule() {
+    this.current.jsonData.redactionRules = this.current.jsonData.redactionRules || [];
+    this.current.jsonData.redactionRules.push({ pattern: '', replacement: '' });
+  }
+
+  removeRedactionRule(index) {
+    this.current.jsonData.redactionRules.splice(index, 1);
+  }
 }
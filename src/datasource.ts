@@ -1,15 +1,21 @@
 import _ from 'lodash';
+import { Observable } from 'rxjs';
+import { LoadingState } from '@grafana/data';
 import TableModel from 'grafana/app/core/table_model';
 import flatten from 'grafana/app/core/utils/flatten';
 import { DataSourceApi, DataSourceInstanceSettings } from '@grafana/ui';
 import { AwsCloudWatchLogsQuery, AwsCloudWatchLogsOptions } from './types';
 
+const tailInterval = 2000;
+
 export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudWatchLogsQuery, AwsCloudWatchLogsOptions> {
   type: string;
   url: any;
   name: string;
   id: any;
   defaultRegion: string;
+  defaultLogGroupName: string;
+  allowWrites: boolean;
 
   /** @ngInject */
   constructor(
@@ -25,18 +31,42 @@ export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudW
     this.id = instanceSettings.id;
     const settingsData = instanceSettings.jsonData || ({} as AwsCloudWatchLogsOptions);
     this.defaultRegion = settingsData.defaultRegion;
+    this.defaultLogGroupName = settingsData.defaultLogGroupName || '';
+    this.allowWrites = !!settingsData.allowWrites;
   }
 
-  async query(options) {
+  query(options): any {
     const query = this.buildQueryParameters(options);
     query.targets = query.targets.filter(t => !t.hide);
 
     if (query.targets.length <= 0) {
       return Promise.resolve({ data: [] });
     }
+    if (options.live || _.some(query.targets, t => t.tail)) {
+      return this.tail(options, query.targets.filter(t => !t.useInsights));
+    }
+    if (!_.some(query.targets, t => t.useInsights || t.chunkPages > 0)) {
+      return this.doRequest({
+        data: query,
+      });
+    }
 
-    return await this.doRequest({
-      data: query,
+    // insights and chunked queries emit the rows found so far while they are running
+    return new Observable(subscriber => {
+      const partialResults = {};
+      this.doRequest({ data: query }, (refId, result) => {
+        partialResults[refId] = result;
+        subscriber.next({
+          data: this.transformResults(query.targets, partialResults),
+          key: options.requestId,
+          state: LoadingState.Streaming,
+        });
+      })
+        .then(res => {
+          subscriber.next(_.extend(res, { key: options.requestId, state: LoadingState.Done }));
+          subscriber.complete();
+        })
+        .catch(err => subscriber.error(err));
     });
   }
 
@@ -46,17 +76,29 @@ export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudW
       logGroupNamePrefix: 'test',
     })
       .then(res => {
-        return Promise.resolve({ status: 'success', message: 'Data source is working', title: 'Success' });
+        return this.checkPermissions(this.defaultRegion);
+      })
+      .then(permissions => {
+        if (!_.isEmpty(permissions.Missing)) {
+          return {
+            status: 'success',
+            message: `Data source is working, but ${permissions.Identity} is missing ${permissions.Missing.join(', ')}`,
+            title: 'Success',
+          };
+        }
+        return { status: 'success', message: 'Data source is working', title: 'Success' };
       })
       .catch(err => {
         return { status: 'error', message: err.message, title: 'Error' };
       });
   }
 
-  async doRequest(options) {
+  async doRequest(options, onPartialResult?) {
     const results = await Promise.all(
       options.data.targets.map(async target => {
-        if (!target.useInsights) {
+        if (!target.useInsights && target.chunkPages > 0) {
+          return await this.doChunkedRequest(options, target, onPartialResult);
+        } else if (!target.useInsights) {
           return await this.backendSrv.datasourceRequest({
             url: '/api/tsdb/query',
             method: 'POST',
@@ -89,7 +131,11 @@ export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudW
                 queries: [target],
               },
             });
-            const status = queryResult.data.results[target.refId].meta.Status;
+            const result = queryResult.data.results[target.refId];
+            const status = result.meta.Status;
+            if (status === 'Running' && onPartialResult && (!_.isEmpty(result.series) || !_.isEmpty(result.tables))) {
+              onPartialResult(target.refId, result);
+            }
             if (status === 'Complete') {
               break;
             } else if (_.includes(['Failed', 'Cancelled'], status)) {
@@ -110,24 +156,138 @@ export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudW
         resultsMap[r.refId] = r;
       });
     });
+
+    return {
+      data: this.transformResults(options.data.targets, resultsMap),
+    };
+  }
+
+  // doChunkedRequest fetches a few pages per request, resuming from the token returned by the previous one,
+  // so that the first rows are shown before the whole range has been read.
+  // tail polls the new events of each target, keeping the latest rows up to the limit of the target.
+  // A poll is sent only after the previous one returned, after the delay the plugin asks for: none when it is behind,
+  // and longer while the log group is idle.
+  tail(options, targets) {
+    return new Observable(subscriber => {
+      let stopped = false;
+      const results = {};
+      const pollTarget = async target => {
+        let cursor = '';
+        const maxRows = target.input.limit || 1000;
+        const tailId = `${options.requestId}-${target.refId}-${Math.random().toString(36).slice(2)}`;
+        while (!stopped) {
+          const started = Date.now();
+          const result = await this.doResourceRequest('tailQuery', { target: target, cursor: cursor, tailId: tailId });
+          cursor = result.meta.Cursor;
+          const previous = results[target.refId];
+          if (previous && !_.isEmpty(result.tables)) {
+            result.tables[0].rows = previous.tables[0].rows.concat(result.tables[0].rows).slice(-maxRows);
+          }
+          results[target.refId] = _.isEmpty(result.tables) ? previous : result;
+          if (!stopped) {
+            subscriber.next({
+              data: this.transformResults(targets, results),
+              key: options.requestId,
+              state: LoadingState.Streaming,
+            });
+          }
+          const interval = _.isNumber(result.meta.NextPollMs) ? result.meta.NextPollMs : tailInterval;
+          if (interval > 0) {
+            await this.delay(Math.max(0, interval - (Date.now() - started)));
+          }
+        }
+      };
+      Promise.all(targets.map(pollTarget)).catch(err => {
+        stopped = true;
+        subscriber.error(err);
+      });
+      return () => {
+        stopped = true;
+      };
+    });
+  }
+
+  async doChunkedRequest(options, target, onPartialResult?) {
+    let merged;
+    let nextToken = '';
+    do {
+      const chunkTarget = _.cloneDeep(target);
+      if (nextToken) {
+        chunkTarget.input.nextToken = nextToken;
+      }
+      const chunkResult = await this.backendSrv.datasourceRequest({
+        url: '/api/tsdb/query',
+        method: 'POST',
+        data: {
+          from: options.data.range.from.valueOf().toString(),
+          to: options.data.range.to.valueOf().toString(),
+          queries: [chunkTarget],
+        },
+      });
+      const result = chunkResult.data.results[target.refId];
+      if (!merged) {
+        merged = chunkResult;
+      } else {
+        const mergedResult = merged.data.results[target.refId];
+        mergedResult.tables = mergedResult.tables || [];
+        _.each(result.tables, (t, i) => {
+          if (mergedResult.tables[i]) {
+            mergedResult.tables[i].rows = mergedResult.tables[i].rows.concat(t.rows);
+          } else {
+            mergedResult.tables[i] = t;
+          }
+        });
+        mergedResult.meta = result.meta;
+      }
+      nextToken = result.meta && result.meta.NextToken;
+      if (nextToken && onPartialResult) {
+        onPartialResult(target.refId, _.cloneDeep(merged.data.results[target.refId]));
+      }
+    } while (nextToken);
+    return merged;
+  }
+
+  transformResults(targets, resultsMap) {
     const res: any = [];
-    for (const target of options.data.targets) {
+    for (const target of targets) {
       const r = resultsMap[target.refId];
+      if (!r) {
+        continue;
+      }
       if (!_.isEmpty(r.series)) {
         _.forEach(r.series, s => {
           res.push({ target: s.name, datapoints: s.points });
         });
       }
-      if (!_.isEmpty(r.tables)) {
+      const notices = r.meta && r.meta.Notice ? [{ severity: 'info', text: r.meta.Notice }] : undefined;
+      if (!_.isEmpty(r.tables) && target.format === 'node_graph') {
+        // the node graph panel finds the frames by name
+        _.forEach(r.tables, (t, i) => {
+          const table = new TableModel(t);
+          (table as any).name = i === 0 ? 'nodes' : 'edges';
+          (table as any).refId = target.refId;
+          (table as any).meta = { preferredVisualisation: 'nodeGraph' };
+          res.push(table);
+        });
+      } else if (!_.isEmpty(r.tables)) {
         _.forEach(r.tables, t => {
-          res.push(this.expandMessageField(t));
+          const table = this.expandMessageField(t);
+          if (r.meta && r.meta.CorrelationFields) {
+            // extracted identifiers keep their column names, so that correlations and data links can refer to them
+            _.forEach(table.columns, c => {
+              if (_.includes(r.meta.CorrelationFields, c.text)) {
+                c.filterable = true;
+              }
+            });
+          }
+          if (notices) {
+            (table as any).meta = { notices: notices };
+          }
+          res.push(table);
         });
       }
     }
-
-    return {
-      data: res,
-    };
+    return res;
   }
 
   delay(msec) {
@@ -137,9 +297,13 @@ export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudW
   buildQueryParameters(options) {
     const targets = options.targets
       .filter(target => {
-        return !!target.logGroupName;
+        // the backend queries the default log groups of the datasource for targets without one
+        return !!target.queryType || !!target.logGroupName || !!this.defaultLogGroupName;
       })
       .map(target => {
+        if (target.queryType) {
+          return this.buildAccountQuery(target, options);
+        }
         let input: any = {};
         let inputInsightsStartQuery: any = {};
 
@@ -150,7 +314,7 @@ export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudW
 
         if (!target.useInsights) {
           input = {
-            logGroupName: this.templateSrv.replace(target.logGroupName, options.scopedVars),
+            logGroupName: this.templateSrv.replace(target.logGroupName || '', options.scopedVars),
             logStreamNames: _.flatten(
               target.logStreamNames
                 .filter(n => n !== '')
@@ -171,7 +335,7 @@ export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudW
             delete input.logStreamNames;
           }
         } else {
-          const logGroupName = this.templateSrv.replace(target.logGroupName, options.scopedVars);
+          const logGroupName = this.templateSrv.replace(target.logGroupName || '', options.scopedVars);
           inputInsightsStartQuery = {
             queryString: this.templateSrv.replace(target.queryString, options.scopedVars),
             limit: parseInt(this.templateSrv.replace(target.limit, options.scopedVars), 10),
@@ -189,12 +353,61 @@ export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudW
           datasourceId: this.id,
           queryType: 'timeSeriesQuery',
           format: target.format || 'timeserie',
-          region: this.templateSrv.replace(target.region, options.scopedVars) || this.defaultRegion,
+          region: target.region || this.defaultRegion,
+          variables: this.getVariables(options.scopedVars),
           useInsights: target.useInsights,
           legendFormat: target.legendFormat,
           timestampColumn: target.timestampColumn,
           valueColumn: target.valueColumn,
           startFromHead: !_.isUndefined(target.startFromHead) ? target.startFromHead : true,
+          engine: target.engine || 'filter',
+          timeShift: this.templateSrv.replace(target.timeShift || '', options.scopedVars),
+          timeFrom: this.templateSrv.replace(target.timeFrom || '', options.scopedVars),
+          timeTo: this.templateSrv.replace(target.timeTo || '', options.scopedVars),
+          unescapeJsonMessage: !!target.unescapeJsonMessage,
+          stripAnsi: !!target.stripAnsi,
+          correlationFields: !!target.correlationFields,
+          rate: !!target.rate,
+          smoothing: target.smoothing || '',
+          smoothingWindow: parseInt(this.templateSrv.replace(target.smoothingWindow || '0', options.scopedVars), 10) || 0,
+          tail: !!target.tail,
+          lambdaFunction: this.templateSrv.replace(target.lambdaFunction || '', options.scopedVars),
+          lambdaQualifier: this.templateSrv.replace(target.lambdaQualifier || '', options.scopedVars),
+          preset: target.preset || '',
+          presetGroupBy: target.presetGroupBy || '',
+          presetColumns: (target.presetColumns || '')
+            .split(',')
+            .map(c => c.trim())
+            .filter(c => c !== ''),
+          sampleMode: target.sampleMode || '',
+          sampleRate: parseFloat(this.templateSrv.replace(target.sampleRate || '0', options.scopedVars)) || 0,
+          multiline: !!target.multiline,
+          multilineStartPattern: target.multilineStartPattern,
+          chunkPages: parseInt(this.templateSrv.replace(target.chunkPages || '0', options.scopedVars), 10) || 0,
+          lastN: parseInt(this.templateSrv.replace(target.lastN || '0', options.scopedVars), 10) || 0,
+          alertSampleLines: parseInt(target.alertSampleLines || '0', 10) || 0,
+          intervalMs: options.intervalMs,
+          dashboardId: options.dashboardId,
+          panelId: options.panelId,
+          levelField: target.levelField,
+          pivotField: this.templateSrv.replace(target.pivotField || '', options.scopedVars),
+          percentiles: (target.percentiles || '')
+            .split(',')
+            .map(p => parseFloat(p))
+            .filter(p => !isNaN(p)),
+          nodeField: target.nodeField || '',
+          calleeField: target.calleeField || '',
+          spanField: target.spanField || '',
+          parentSpanField: target.parentSpanField || '',
+          excludeLogStreamNames: this.templateSrv
+            .replace(target.excludeLogStreamNames || '', options.scopedVars)
+            .split(',')
+            .map(n => n.trim())
+            .filter(n => n !== ''),
+          excludeLogStreamNamePrefix: this.templateSrv.replace(target.excludeLogStreamNamePrefix || '', options.scopedVars),
+          logStreamNamePattern: this.templateSrv.replace(target.logStreamNamePattern || '', options.scopedVars, 'regex'),
+          topN: parseInt(this.templateSrv.replace(target.topN || '5', options.scopedVars), 10),
+          template: target.template || '',
           input: input,
           inputInsightsStartQuery: inputInsightsStartQuery,
         };
@@ -204,15 +417,37 @@ export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudW
     return options;
   }
 
+  // buildAccountQuery builds the query of a target listing account resources, run by the backend as a resource query
+  buildAccountQuery(target, options) {
+    return {
+      refId: target.refId,
+      hide: target.hide,
+      datasourceId: this.id,
+      queryType: target.queryType,
+      format: 'table',
+      region: this.templateSrv.replace(target.region || '', options.scopedVars) || this.defaultRegion,
+      logGroupName: this.templateSrv.replace(target.logGroupName || '', options.scopedVars),
+      exportStatus: target.exportStatus || '',
+    };
+  }
+
+  getVariables(scopedVars) {
+    const variables = {};
+    _.each(this.templateSrv.variables, v => {
+      variables[v.name] = this.templateSrv.replace('$' + v.name, scopedVars);
+    });
+    return variables;
+  }
+
   expandMessageField(originalTable) {
     const table = new TableModel();
     let i, j;
     const metricLabels = {};
 
+    table.columns = originalTable.columns;
     if (originalTable.rows.length === 0) {
       return table;
     }
-    table.columns = originalTable.columns;
 
     // Collect all labels across all metrics
     const messageIndex = table.columns.findIndex(c => {
@@ -270,6 +505,30 @@ export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudW
       });
     }
 
+    const insightsQuery = query.match(/^insights_query\(([^,]+?),\s?([^,]+?),\s?(.+)\)$/);
+    if (insightsQuery) {
+      return this.doMetricQueryRequest('insights_query', {
+        region: this.templateSrv.replace(insightsQuery[1]),
+        logGroupName: this.templateSrv.replace(insightsQuery[2]).replace(/\s*\|\s*/g, ','),
+        queryString: this.templateSrv.replace(insightsQuery[3]),
+      });
+    }
+
+    const logGroupArnsQuery = query.match(/^log_group_arns\(([^,]+?)(,\s?(.*))?\)/);
+    if (logGroupArnsQuery) {
+      return this.doMetricQueryRequest('log_group_arns', {
+        region: this.templateSrv.replace(logGroupArnsQuery[1]),
+        logGroupNamePrefix: this.templateSrv.replace(logGroupArnsQuery[3] || ''),
+      });
+    }
+
+    const resourcePoliciesQuery = query.match(/^resource_policies\(([^,]+?)\)/);
+    if (resourcePoliciesQuery) {
+      return this.doMetricQueryRequest('resource_policies', {
+        region: this.templateSrv.replace(resourcePoliciesQuery[1]),
+      });
+    }
+
     const logStreamNamesQuery = query.match(/^log_stream_names\(([^,]+?),\s?(.+)\)/);
     if (logStreamNamesQuery) {
       region = logStreamNamesQuery[1];
@@ -278,6 +537,17 @@ export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudW
         region: this.templateSrv.replace(region),
         logGroupName: this.templateSrv.replace(logGroupName),
         logStreamNamePrefix: '',
+        timeRange: true,
+      });
+    }
+
+    const ecsQuery = query.match(/^(ecs_clusters|ecs_services|ecs_tasks|ecs_log_groups|ecs_log_stream_prefixes|ecs_log_streams)\((.*)\)/);
+    if (ecsQuery) {
+      const args = _.map(ecsQuery[2].split(','), a => this.templateSrv.replace(a.trim()));
+      return this.doMetricQueryRequest(ecsQuery[1], {
+        region: args[0],
+        cluster: args[1] || '',
+        service: args[2] || '',
       });
     }
 
@@ -312,6 +582,184 @@ export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudW
       });
   }
 
+  doResourceRequest(queryType, parameters) {
+    const range = this.timeSrv.timeRange();
+    return this.backendSrv
+      .datasourceRequest({
+        url: '/api/tsdb/query',
+        method: 'POST',
+        data: {
+          from: range.from.valueOf().toString(),
+          to: range.to.valueOf().toString(),
+          queries: [
+            _.extend(
+              {
+                refId: queryType,
+                datasourceId: this.id,
+                queryType: queryType,
+              },
+              parameters
+            ),
+          ],
+        },
+      })
+      .then(r => {
+        const result = r.data.results[queryType];
+        if (result.error) {
+          throw new Error(result.error);
+        }
+        return result;
+      });
+  }
+
+  getLogRecord(region, logRecordPointer) {
+    return this.doResourceRequest('logRecordQuery', {
+      region: this.templateSrv.replace(region) || this.defaultRegion,
+      logRecordPointer: logRecordPointer,
+    }).then(result => result.meta);
+  }
+
+  getLogContext(region, logGroupName, logStreamName, timestamp, before = 10, after = 10) {
+    return this.doResourceRequest('logContextQuery', {
+      region: this.templateSrv.replace(region) || this.defaultRegion,
+      logGroupName: this.templateSrv.replace(logGroupName),
+      logStreamName: logStreamName,
+      timestamp: timestamp,
+      before: before,
+      after: after,
+    }).then(result => this.expandMessageField(result.tables[0]));
+  }
+
+  getFieldStats(region, logGroupName, filterPattern = '') {
+    return this.doResourceRequest('fieldStatsQuery', {
+      region: this.templateSrv.replace(region) || this.defaultRegion,
+      logGroupName: this.templateSrv.replace(logGroupName),
+      filterPattern: this.templateSrv.replace(filterPattern),
+    }).then(result => {
+      const table = result.tables[0];
+      return _.map(table.rows, row => _.zipObject(_.map(table.columns, 'text'), row));
+    });
+  }
+
+  // preview returns the first events matching a target of the query editor, from a single page
+  preview(target) {
+    const query = this.buildQueryParameters({ targets: [_.cloneDeep(target)], scopedVars: {} });
+    if (query.targets.length === 0) {
+      return Promise.resolve(null);
+    }
+    return this.doResourceRequest('previewQuery', { target: query.targets[0] }).then(result => {
+      return {
+        table: result.tables[0],
+        notice: result.meta && result.meta.Notice,
+      };
+    });
+  }
+
+  // exportSnapshot returns all the events of the target, with the query and its time range, as a JSON snapshot
+  exportSnapshot(target) {
+    const query = this.buildQueryParameters({ targets: [_.cloneDeep(target)], scopedVars: {} });
+    if (query.targets.length === 0) {
+      return Promise.resolve(null);
+    }
+    return this.doResourceRequest('snapshotQuery', { target: query.targets[0] }).then(result => result.meta);
+  }
+
+  // getJsonFields returns the JSON fields of the recent events of a log group, with their selector, type and an example value
+  getJsonFields(region, logGroupName) {
+    return this.doResourceRequest('jsonFieldsQuery', {
+      region: this.templateSrv.replace(region) || this.defaultRegion,
+      logGroupName: this.templateSrv.replace(logGroupName),
+    }).then(result => {
+      const table = result.tables[0];
+      return _.map(table.rows, row => _.zipObject(_.map(table.columns, 'text'), row));
+    });
+  }
+
+  // getPatternSuggestions returns filter patterns suggested from the recent events of a log group
+  getPatternSuggestions(region, logGroupName, filterPattern = '') {
+    return this.doResourceRequest('patternSuggestionsQuery', {
+      region: this.templateSrv.replace(region) || this.defaultRegion,
+      logGroupName: this.templateSrv.replace(logGroupName),
+      filterPattern: this.templateSrv.replace(filterPattern),
+    }).then(result => {
+      const table = result.tables[0];
+      return _.map(table.rows, row => _.zipObject(_.map(table.columns, 'text'), row));
+    });
+  }
+
+  // loadMore continues a truncated table result of the query options from the NextToken of its meta
+  loadMore(options, refId, nextToken) {
+    const query = this.buildQueryParameters(_.cloneDeep(options));
+    const target = _.find(query.targets, t => t.refId === refId);
+    return this.doResourceRequest('loadMoreQuery', {
+      target: target,
+      nextToken: nextToken,
+    }).then(result => {
+      return {
+        table: this.expandMessageField(result.tables[0]),
+        nextToken: result.meta && result.meta.NextToken,
+      };
+    });
+  }
+
+  putMetricFilter(region, logGroupName, filterPattern, metricFilter) {
+    return this.doResourceRequest('putMetricFilterQuery', {
+      region: this.templateSrv.replace(region) || this.defaultRegion,
+      logGroupName: this.templateSrv.replace(logGroupName),
+      filterPattern: this.templateSrv.replace(filterPattern),
+      filterName: metricFilter.filterName,
+      metricNamespace: metricFilter.metricNamespace,
+      metricName: metricFilter.metricName,
+      metricValue: metricFilter.metricValue || '1',
+      overwrite: !!metricFilter.overwrite,
+    }).then(result => result.meta);
+  }
+
+  // putQueryDefinition saves the query string, with the variables replaced, to the saved queries of the CloudWatch console
+  putQueryDefinition(region, logGroupName, queryString, name) {
+    return this.doResourceRequest('putQueryDefinitionQuery', {
+      region: this.templateSrv.replace(region) || this.defaultRegion,
+      logGroupName: this.templateSrv.replace(logGroupName),
+      queryString: this.templateSrv.replace(queryString),
+      name: name,
+    }).then(result => result.meta);
+  }
+
+  // getQueryTemplates returns the query templates stored in the settings of the datasource
+  getQueryTemplates() {
+    return this.doResourceRequest('queryTemplatesQuery', {}).then(result => result.meta.Templates);
+  }
+
+  // saveQueryTemplate adds the template to the settings of the datasource, or replaces the one of the same name.
+  // The backend validates it, and the settings are saved with the Grafana API, which requires the permission to edit the datasource.
+  saveQueryTemplate(template) {
+    return this.doResourceRequest('putQueryTemplateQuery', { template: template }).then(result => {
+      return this.backendSrv.get('/api/datasources/' + this.id).then(settings => {
+        settings.jsonData = settings.jsonData || {};
+        settings.jsonData.queryTemplates = result.meta.Templates;
+        return this.backendSrv.put('/api/datasources/' + this.id, settings).then(() => result.meta);
+      });
+    });
+  }
+
+  // checkPermissions reports the IAM actions used by the plugin which the identity of the datasource is not allowed
+  checkPermissions(region, logGroupName = '') {
+    const parameters: any = { region: this.templateSrv.replace(region) || this.defaultRegion };
+    if (logGroupName) {
+      parameters.logGroupName = this.templateSrv.replace(logGroupName);
+    }
+    return this.doResourceRequest('permissionsQuery', parameters).then(result => result.meta);
+  }
+
+  // getCostSummary returns the API calls and Insights scans of the datasource this month, with their estimated cost
+  getCostSummary() {
+    return this.doResourceRequest('costQuery', {}).then(result => result.meta);
+  }
+
+  getPresets() {
+    return this.doResourceRequest('presetsQuery', {}).then(result => result.meta);
+  }
+
   transformSuggestDataFromTable(suggestData) {
     return _.map(suggestData.results['metricFindQuery'].tables[0].rows, v => {
       return {
@@ -331,7 +779,7 @@ export default class AwsCloudWatchLogsDatasource extends DataSourceApi<AwsCloudW
     const titleFormat = annotation.titleFormat || '';
     const textFormat = annotation.textFormat || '';
 
-    if (_.isEmpty(region) || _.isEmpty(logGroupName)) {
+    if (_.isEmpty(region) || (_.isEmpty(logGroupName) && !this.defaultLogGroupName)) {
       return Promise.resolve([]);
     }
 
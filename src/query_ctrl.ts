@@ -9,6 +9,29 @@ export class AwsCloudWatchLogsDatasourceQueryCtrl extends QueryCtrl {
   datasource: any;
   suggestLogGroupName: any;
   suggestLogStreamName: any;
+  suggestFilterPattern: any;
+  suggestJsonField: any;
+  patternSuggestions: any = {};
+  jsonFields: any = {};
+  fieldStats: any;
+  previewResult: any;
+  presets: any[] = [];
+  metricFilter: any = null;
+  metricFilterResult: any;
+  queryDefinition: any = null;
+  queryDefinitionResult: any;
+  templates: any[] = [];
+  queryTypes = [
+    { value: '', text: 'Logs' },
+    { value: 'exportTasksQuery', text: 'Export Tasks' },
+    { value: 'resourcePoliciesQuery', text: 'Resource Policies' },
+    { value: 'dataProtectionQuery', text: 'Data Protection' },
+  ];
+  exportStatuses = [{ value: '', text: 'all' }].concat(
+    ['PENDING', 'RUNNING', 'COMPLETED', 'FAILED', 'CANCELLED', 'PENDING_CANCEL'].map(s => ({ value: s, text: s }))
+  );
+  queryTemplate: any = null;
+  queryTemplateResult: any;
   static templateUrl = 'query.editor.html';
 
   /** @ngInject */
@@ -16,6 +39,8 @@ export class AwsCloudWatchLogsDatasourceQueryCtrl extends QueryCtrl {
     super($scope, $injector);
 
     this.scope = $scope;
+    this.target.queryType = this.target.queryType || '';
+    this.target.exportStatus = this.target.exportStatus || '';
     this.target.format = this.target.format || 'table';
     this.target.region = this.target.region || '';
     this.target.logGroupName = this.target.logGroupName || '';
@@ -23,6 +48,27 @@ export class AwsCloudWatchLogsDatasourceQueryCtrl extends QueryCtrl {
     this.target.filterPattern = this.target.filterPattern || '';
     this.target.queryString = this.target.queryString || '';
     this.target.startFromHead = !_.isUndefined(this.target.startFromHead) ? this.target.startFromHead : true;
+    this.target.engine = this.target.engine || 'filter';
+    this.target.topN = this.target.topN || '5';
+    this.target.excludeLogStreamNames = this.target.excludeLogStreamNames || '';
+    this.target.excludeLogStreamNamePrefix = this.target.excludeLogStreamNamePrefix || '';
+    this.target.logStreamNamePattern = this.target.logStreamNamePattern || '';
+    this.target.timeShift = this.target.timeShift || '';
+    this.target.timeFrom = this.target.timeFrom || '';
+    this.target.timeTo = this.target.timeTo || '';
+    this.target.smoothing = this.target.smoothing || '';
+    this.target.smoothingWindow = this.target.smoothingWindow || '';
+    this.target.lastN = this.target.lastN || '';
+    this.target.chunkPages = this.target.chunkPages || '';
+    this.target.alertSampleLines = this.target.alertSampleLines || '';
+    this.target.lambdaFunction = this.target.lambdaFunction || '';
+    this.target.lambdaQualifier = this.target.lambdaQualifier || '';
+    this.target.template = this.target.template || '';
+    this.target.preset = this.target.preset || '';
+    this.target.presetColumns = this.target.presetColumns || '';
+    this.target.sampleMode = this.target.sampleMode || '';
+    this.target.sampleRate = this.target.sampleRate || '';
+    this.target.multilineStartPattern = this.target.multilineStartPattern || '^\\S';
 
     // backward compatibility
     if (_.isNumber(this.target.limit)) {
@@ -35,6 +81,11 @@ export class AwsCloudWatchLogsDatasourceQueryCtrl extends QueryCtrl {
     this.target.valueColumn = this.target.valueColumn || '';
     this.templateSrv = templateSrv;
 
+    this.datasource.getPresets().then(presets => {
+      this.presets = [{ name: '', title: 'none' }].concat(presets);
+    });
+    this.loadQueryTemplates();
+
     this.suggestLogGroupName = (query, callback) => {
       const region = this.target.region || this.datasource.defaultRegion;
       return this.datasource
@@ -62,6 +113,187 @@ export class AwsCloudWatchLogsDatasourceQueryCtrl extends QueryCtrl {
           callback(data.map(d => d.value));
         });
     };
+
+    // suggestions are sampled once per log group, as sampling reads hundreds of events
+    this.suggestFilterPattern = (query, callback) => {
+      if (!this.target.logGroupName) {
+        return callback([]);
+      }
+      const region = this.target.region || this.datasource.defaultRegion;
+      const key = region + '/' + this.target.logGroupName;
+      if (!this.patternSuggestions[key]) {
+        this.patternSuggestions[key] = this.datasource.getPatternSuggestions(region, this.target.logGroupName).catch(() => []);
+      }
+      return this.patternSuggestions[key].then(suggestions => {
+        callback(suggestions.map(s => s.Pattern));
+      });
+    };
+
+    this.suggestJsonField = (query, callback) => {
+      if (!this.target.logGroupName) {
+        return callback([]);
+      }
+      const region = this.target.region || this.datasource.defaultRegion;
+      const key = region + '/' + this.target.logGroupName;
+      if (!this.jsonFields[key]) {
+        this.jsonFields[key] = this.datasource.getJsonFields(region, this.target.logGroupName).catch(() => []);
+      }
+      return this.jsonFields[key].then(fields => {
+        callback(fields.map(f => f.Field));
+      });
+    };
+  }
+
+  // isRatable tells whether the series of the format are counted per interval, as the backend checks before turning them into rates
+  isRatable() {
+    switch (this.target.format) {
+      case 'top_streams':
+      case 'stream_series':
+      case 'level_counts':
+        return true;
+      case 'timeserie':
+        return !!this.target.preset || !!this.target.sampleMode;
+    }
+    return false;
+  }
+
+  selectedPreset() {
+    return _.find(this.presets, p => p.name === this.target.preset);
+  }
+
+  loadQueryTemplates() {
+    return this.datasource
+      .getQueryTemplates()
+      .then(templates => {
+        this.templates = [{ name: '', title: 'none' }].concat(templates.map(t => _.assign({ title: t.name }, t)));
+      })
+      .catch(() => {
+        this.templates = [];
+      });
+  }
+
+  selectedTemplate() {
+    return _.find(this.templates, t => t.name === this.target.template);
+  }
+
+  toggleQueryTemplate() {
+    this.queryTemplateResult = null;
+    this.queryTemplate = this.queryTemplate ? null : { name: '', description: '' };
+  }
+
+  // saveQueryTemplate saves the filter pattern and parsing config of the target as a template, and switches the target to it
+  saveQueryTemplate() {
+    const template = {
+      name: this.queryTemplate.name,
+      description: this.queryTemplate.description,
+      filterPattern: this.target.filterPattern,
+      preset: this.target.preset,
+      presetColumns: (this.target.presetColumns || '')
+        .split(',')
+        .map(c => c.trim())
+        .filter(c => c !== ''),
+      unescapeJsonMessage: !!this.target.unescapeJsonMessage,
+      stripAnsi: !!this.target.stripAnsi,
+      multiline: !!this.target.multiline,
+      multilineStartPattern: this.target.multiline ? this.target.multilineStartPattern : '',
+    };
+    return this.datasource
+      .saveQueryTemplate(template)
+      .then(result => {
+        this.queryTemplateResult = { name: template.name, replaced: result.Replaced };
+        this.queryTemplate = null;
+        this.target.template = template.name;
+        return this.loadQueryTemplates();
+      })
+      .then(() => {
+        this.onChangeInternal();
+      })
+      .catch(err => {
+        this.error = err.message || (err.data && err.data.message);
+      });
+  }
+
+  loadFieldStats() {
+    const region = this.target.region || this.datasource.defaultRegion;
+    return this.datasource
+      .getFieldStats(region, this.target.logGroupName, this.target.filterPattern)
+      .then(stats => {
+        this.fieldStats = stats;
+      })
+      .catch(err => {
+        this.fieldStats = null;
+        this.error = err.message;
+      });
+  }
+
+  loadPreview() {
+    return this.datasource
+      .preview(this.target)
+      .then(result => {
+        this.previewResult = result;
+      })
+      .catch(err => {
+        this.previewResult = null;
+        this.error = err.message;
+      });
+  }
+
+  // exportSnapshot downloads the events of the query as a JSON file
+  exportSnapshot() {
+    return this.datasource
+      .exportSnapshot(this.target)
+      .then(snapshot => {
+        if (!snapshot) {
+          return;
+        }
+        const blob = new Blob([JSON.stringify(snapshot, null, 2)], { type: 'application/json' });
+        const link = document.createElement('a');
+        link.href = URL.createObjectURL(blob);
+        link.download = 'cloudwatch-logs-' + this.target.refId + '-' + snapshot.CreatedAt.replace(/[:.]/g, '-') + '.json';
+        document.body.appendChild(link);
+        link.click();
+        document.body.removeChild(link);
+        URL.revokeObjectURL(link.href);
+      })
+      .catch(err => {
+        this.error = err.message;
+      });
+  }
+
+  toggleMetricFilter() {
+    this.metricFilterResult = null;
+    this.metricFilter = this.metricFilter ? null : { filterName: '', metricNamespace: '', metricName: '', metricValue: '1' };
+  }
+
+  createMetricFilter() {
+    const region = this.target.region || this.datasource.defaultRegion;
+    return this.datasource
+      .putMetricFilter(region, this.target.logGroupName, this.target.filterPattern, this.metricFilter)
+      .then(result => {
+        this.metricFilterResult = result;
+        this.metricFilter = null;
+      })
+      .catch(err => {
+        this.error = err.message;
+      });
+  }
+
+  toggleQueryDefinition() {
+    this.queryDefinitionResult = null;
+    this.queryDefinition = this.queryDefinition ? null : { name: '' };
+  }
+
+  saveQueryDefinition() {
+    const region = this.target.region || this.datasource.defaultRegion;
+    return this.datasource
+      .putQueryDefinition(region, this.target.logGroupName, this.target.queryString, this.queryDefinition.name)
+      .then(result => {
+        this.queryDefinitionResult = result;
+        this.queryDefinition = null;
+      })
+      .catch(err => {
+        this.error = err.message;
+      });
   }
 
   onChangeInternal() {
@@ -2,11 +2,27 @@ import { DataQuery, DataSourceJsonData } from '@grafana/ui';
 
 export interface AwsCloudWatchLogsOptions extends DataSourceJsonData {
   defaultRegion: string;
+  defaultLogGroupName?: string;
+  logLevel?: string;
+  allowWrites?: boolean;
+  redactionPresets?: { [name: string]: boolean };
+  redactionRules?: Array<{ pattern: string; replacement?: string }>;
+  queryTemplates?: Array<{
+    name: string;
+    description?: string;
+    filterPattern: string;
+    preset?: string;
+    presetColumns?: string[];
+    unescapeJsonMessage?: boolean;
+    stripAnsi?: boolean;
+    multiline?: boolean;
+    multilineStartPattern?: string;
+  }>;
 }
 
 export interface AwsCloudWatchLogsQuery extends DataQuery {
   refId: string;
-  format?: 'timeserie' | 'table';
+  format?: 'timeserie' | 'table' | 'stream_summary' | 'top_streams' | 'stream_series' | 'level_counts' | 'pivot' | 'heatmap' | 'node_graph' | 'stat' | 'latest' | 'percentiles' | 'distinct';
   region?: string;
   logGroupName?: string;
   logStreamNames?: string[];
@@ -16,4 +32,41 @@ export interface AwsCloudWatchLogsQuery extends DataQuery {
   legendFormat?: string;
   timestampColumn?: string;
   valueColumn?: string;
+  engine?: 'filter' | 'auto';
+  topN?: string;
+  levelField?: string;
+  excludeLogStreamNames?: string;
+  excludeLogStreamNamePrefix?: string;
+  logStreamNamePattern?: string;
+  timeShift?: string;
+  timeFrom?: string;
+  timeTo?: string;
+  lastN?: string;
+  unescapeJsonMessage?: boolean;
+  stripAnsi?: boolean;
+  correlationFields?: boolean;
+  rate?: boolean;
+  smoothing?: '' | 'moving_average' | 'ewma';
+  smoothingWindow?: string;
+  tail?: boolean;
+  multiline?: boolean;
+  multilineStartPattern?: string;
+  lambdaFunction?: string;
+  lambdaQualifier?: string;
+  preset?: string;
+  presetGroupBy?: string;
+  presetColumns?: string;
+  sampleMode?: string;
+  sampleRate?: string;
+  chunkPages?: string;
+  alertSampleLines?: string;
+  pivotField?: string;
+  percentiles?: string;
+  nodeField?: string;
+  calleeField?: string;
+  spanField?: string;
+  parentSpanField?: string;
+  template?: string;
+  queryType?: '' | 'exportTasksQuery' | 'resourcePoliciesQuery' | 'dataProtectionQuery';
+  exportStatus?: string;
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// logStreamFilter reports whether events of the given log stream should be returned.
+// It is applied on the backend, as FilterLogEvents only supports exact stream names or a single prefix.
+func (target *Target) logStreamFilter() (func(name string) bool, error) {
+	if len(target.ExcludeLogStreamNames) == 0 && target.ExcludeLogStreamNamePrefix == "" && target.LogStreamNamePattern == "" && len(target.lambdaVersions) == 0 {
+		return nil, nil
+	}
+
+	var pattern *regexp.Regexp
+	if target.LogStreamNamePattern != "" {
+		var err error
+		pattern, err = regexp.Compile(target.LogStreamNamePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log stream name pattern: %v", err)
+		}
+	}
+	excluded := make(map[string]bool)
+	for _, n := range target.ExcludeLogStreamNames {
+		excluded[n] = true
+	}
+	return func(name string) bool {
+		if excluded[name] {
+			return false
+		}
+		if target.ExcludeLogStreamNamePrefix != "" && strings.HasPrefix(name, target.ExcludeLogStreamNamePrefix) {
+			return false
+		}
+		if pattern != nil && !pattern.MatchString(name) {
+			return false
+		}
+		if len(target.lambdaVersions) > 0 {
+			for _, v := range target.lambdaVersions {
+				if strings.Contains(name, lambdaStreamMarker(v)) {
+					return true
+				}
+			}
+			return false
+		}
+		return true
+	}, nil
+}
+
+// filterLogStreamNames drops the requested log streams which are excluded, so that they are not fetched at all.
+func filterLogStreamNames(names []*string, include func(name string) bool) []*string {
+	if include == nil {
+		return names
+	}
+	filtered := make([]*string, 0, len(names))
+	for _, n := range names {
+		if include(aws.StringValue(n)) {
+			filtered = append(filtered, n)
+		}
+	}
+	return filtered
+}
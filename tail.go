@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+const (
+	// tailMaxEvents caps the new events of a poll, so that a busy log group is caught up over several polls
+	// instead of a single response growing without bound.
+	tailMaxEvents = 1000
+	// tailLookbackMs is the range the first poll reads.
+	tailLookbackMs = 30 * 1000
+	// tailOverlapMs is read again by each poll, as events are often ingested a few seconds after their timestamp.
+	tailOverlapMs = 15 * 1000
+	tailMaxSeen   = 5000
+	// tailPollMs is the delay between the polls of a tail which returned events. It doubles after each empty poll,
+	// up to tailMaxIdleShift times, so that idle tails cost fewer API calls.
+	tailPollMs       = 2000
+	tailMaxIdleShift = 3
+	// tailSessionTimeout ends a tail which was not polled for that long, e.g. as its panel was closed.
+	tailSessionTimeout = 60 * time.Second
+)
+
+// maxTailsEnv overrides the number of tails of a datasource polling at the same time, 0 removes the limit.
+// Each tail makes a FilterLogEvents call every few seconds, which share the API rate limit of the account.
+const maxTailsEnv = "GF_PLUGIN_AWS_CLOUDWATCH_LOGS_MAX_TAILS"
+
+var (
+	maxTails        = 10
+	tailSessions    = make(map[int64]map[string]time.Time)
+	tailSessionLock sync.Mutex
+)
+
+func init() {
+	if v := os.Getenv(maxTailsEnv); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			pluginLogger.Error("invalid max tails", "env", maxTailsEnv, "value", v)
+		} else {
+			maxTails = n
+		}
+	}
+}
+
+// touchTailSession records a poll of a tail, and rejects a new tail when the datasource already has the maximum of tails.
+func touchTailSession(datasourceId int64, tailId string, now time.Time) error {
+	tailSessionLock.Lock()
+	defer tailSessionLock.Unlock()
+	sessions, ok := tailSessions[datasourceId]
+	if !ok {
+		sessions = make(map[string]time.Time)
+		tailSessions[datasourceId] = sessions
+	}
+	for id, polledAt := range sessions {
+		if now.Sub(polledAt) > tailSessionTimeout {
+			delete(sessions, id)
+		}
+	}
+	if _, ok := sessions[tailId]; !ok && maxTails > 0 && len(sessions) >= maxTails {
+		return fmt.Errorf("too many tails of this datasource, the limit is %d", maxTails)
+	}
+	sessions[tailId] = now
+	return nil
+}
+
+// tailCursor is the position of a tail: the newest event timestamp returned,
+// the IDs of the events returned in the overlap before it, which are not returned again,
+// and the number of polls in a row which returned no event.
+type tailCursor struct {
+	Time int64    `json:"t"`
+	Seen []string `json:"s,omitempty"`
+	Idle uint     `json:"i,omitempty"`
+}
+
+type tailMeta struct {
+	Cursor        string
+	Behind        bool `json:",omitempty"`
+	NextPollMs    int64
+	FilterPattern string      `json:",omitempty"`
+	Stats         *queryStats `json:",omitempty"`
+}
+
+func decodeTailCursor(s string) (tailCursor, error) {
+	var c tailCursor
+	if s == "" {
+		return c, nil
+	}
+	b, err := base64.URLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("invalid tail cursor")
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("invalid tail cursor")
+	}
+	return c, nil
+}
+
+func (c tailCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+// tailQuery returns the events of a FilterLogEvents target which were ingested since the given cursor.
+// A target of several log groups follows them in a single tail, with the log group of each event in a LogGroupName column.
+// The grafana-plugin-model protocol has no RunStream, so the plugin can not push events and the frontend polls it, sending a poll only after the previous one
+// returned and waiting NextPollMs: none when more events arrived than a poll returns, and longer as the log group stays idle.
+func (t *AwsCloudWatchLogsDatasource) tailQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	targetJson, err := parameters.Get("target").MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	target := Target{}
+	if err := json.Unmarshal(targetJson, &target); err != nil {
+		return nil, err
+	}
+	if target.UseInsights || target.LastN > 0 {
+		return nil, fmt.Errorf("only filter queries can be tailed")
+	}
+	cursor, err := decodeTailCursor(parameters.Get("cursor").MustString())
+	if err != nil {
+		return nil, err
+	}
+	tailId := parameters.Get("tailId").MustString()
+	if tailId == "" {
+		return nil, fmt.Errorf("tailId is required")
+	}
+	if err := touchTailSession(tsdbReq.Datasource.Id, tailId, time.Now()); err != nil {
+		return nil, err
+	}
+
+	dsInfo, err := t.getDsInfo(tsdbReq.Datasource, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := target.resolveRegion(dsInfo.DefaultRegion); err != nil {
+		return nil, err
+	}
+	target.applyDefaultLogGroups(dsInfo.DefaultLogGroupName)
+	if err := target.applyQueryTemplate(dsInfo); err != nil {
+		return nil, err
+	}
+	if err := t.applyLambdaFunction(tsdbReq.Datasource, &target); err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	target.From, target.To = now-tailLookbackMs, now
+	if cursor.Time > 0 {
+		target.From = cursor.Time - tailOverlapMs
+	}
+	// the filter pattern is evaluated by FilterLogEvents, so that only the matching events are read by the plugin and sent to the panel
+	input := target.Input
+	input.FilterPattern = aws.String(strings.TrimSpace(aws.StringValue(input.FilterPattern)))
+	input.StartTime = aws.Int64(target.From)
+	input.EndTime = aws.Int64(target.To)
+	input.NextToken = nil
+	t.auditResourceQuery(tsdbReq.Datasource, "tailQuery", &Target{RefId: target.RefId, Region: target.Region, Input: input, DashboardId: target.DashboardId, PanelId: target.PanelId}, target.From, target.To)
+
+	svc, err := t.getClient(tsdbReq.Datasource, target.Region)
+	if err != nil {
+		return nil, err
+	}
+	includeStream, err := target.logStreamFilter()
+	if err != nil {
+		return nil, err
+	}
+	quota := quotaForOrg(tsdbReq.Datasource.OrgId).withDeadline(queryDeadline(ctx, dsInfo))
+	quota.MaxEvents = tailMaxEvents + int64(len(cursor.Seen))
+	var resp *cloudwatchlogs.FilterLogEventsOutput
+	var stats *queryStats
+	if target.hasMultipleLogGroups() {
+		var groups []string
+		groups, err = expandLogGroupNames(svc, aws.StringValue(input.LogGroupName))
+		if err != nil {
+			return nil, err
+		}
+		groupQuota := quota.withSharedBudget()
+		results := fetchLogGroups(groups, func(i int, logGroupName string) (r logGroupResult) {
+			groupInput := input
+			groupInput.LogGroupName = aws.String(logGroupName)
+			r.resp, r.stats, r.err = t.getLogEvent(svc, &groupInput, true, groupQuota, includeStream, nil)
+			return r
+		})
+		resp, stats, target.eventLogGroups, err = mergeTailResults(groups, results, target.From, quota.MaxEvents)
+	} else {
+		resp, stats, err = t.getLogEvent(svc, &input, true, quota, includeStream, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(cursor.Seen))
+	for _, id := range cursor.Seen {
+		seen[id] = true
+	}
+	fresh := make([]*cloudwatchlogs.FilteredLogEvent, 0, len(resp.Events))
+	next := tailCursor{Time: cursor.Time}
+	for _, e := range resp.Events {
+		if !seen[aws.StringValue(e.EventId)] {
+			fresh = append(fresh, e)
+		}
+		if ts := aws.Int64Value(e.Timestamp); ts > next.Time {
+			next.Time = ts
+		}
+	}
+	if stats.Truncated == "" && next.Time < target.To-tailOverlapMs {
+		// every event up to now was read, so that an idle log group does not widen the range of the next polls
+		next.Time = target.To - tailOverlapMs
+	}
+	for _, e := range resp.Events {
+		if aws.Int64Value(e.Timestamp) >= next.Time-tailOverlapMs && len(next.Seen) < tailMaxSeen {
+			next.Seen = append(next.Seen, aws.StringValue(e.EventId))
+		}
+	}
+
+	r, err := formatResult(&target, &cloudwatchlogs.FilterLogEventsOutput{Events: fresh})
+	if err != nil {
+		return nil, err
+	}
+	stats.Events = len(fresh)
+	meta := tailMeta{Behind: stats.Truncated != "", FilterPattern: aws.StringValue(input.FilterPattern), Stats: stats}
+	if len(fresh) == 0 && cursor.Idle < tailMaxIdleShift {
+		next.Idle = cursor.Idle + 1
+	} else if len(fresh) == 0 {
+		next.Idle = cursor.Idle
+	}
+	if !meta.Behind {
+		meta.NextPollMs = tailPollMs << next.Idle
+	}
+	meta.Cursor = next.encode()
+	metaJson, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	r.MetaJson = string(metaJson)
+	return r, nil
+}
+
+// mergeTailResults merges the new events of several log groups in time order, with the log group of each event.
+// The events of a log group whose poll was truncated are only read up to its last event, so the merged events stop there,
+// as the cursor moving past it would skip the rest of that log group.
+func mergeTailResults(groups []string, results []logGroupResult, from int64, maxEvents int64) (*cloudwatchlogs.FilterLogEventsOutput, *queryStats, map[string]string, error) {
+	stats := &queryStats{Engine: "filter"}
+	eventLogGroups := make(map[string]string)
+	events := make([]*cloudwatchlogs.FilteredLogEvent, 0)
+	until := int64(math.MaxInt64)
+	failures := make([]string, 0)
+	var firstErr error
+	for i, r := range results {
+		if r.err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", groups[i], r.err))
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		stats.merge(r.stats)
+		if r.stats.Truncated != "" {
+			last := from
+			if n := len(r.resp.Events); n > 0 {
+				last = aws.Int64Value(r.resp.Events[n-1].Timestamp)
+			}
+			if last < until {
+				until = last
+			}
+		}
+		for _, e := range r.resp.Events {
+			eventLogGroups[aws.StringValue(e.EventId)] = groups[i]
+		}
+		events = append(events, r.resp.Events...)
+	}
+	if len(failures) == len(groups) {
+		return nil, nil, nil, firstErr
+	}
+	if len(failures) > 0 {
+		stats.PartialError = fmt.Sprintf("%d of %d log groups failed: %s", len(failures), len(groups), strings.Join(failures, "; "))
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return *events[i].Timestamp < *events[j].Timestamp })
+	n := sort.Search(len(events), func(i int) bool { return *events[i].Timestamp > until })
+	events = events[:n]
+	if int64(len(events)) > maxEvents {
+		events = events[:maxEvents]
+		stats.Truncated = fmt.Sprintf("the limit of %d events per response was reached", maxEvents)
+	}
+	return &cloudwatchlogs.FilterLogEventsOutput{Events: events}, stats, eventLogGroups, nil
+}
+
+// addLogGroupColumn labels the rows of a tail of several log groups with the log group of their event.
+func addLogGroupColumn(table *datasource.Table, events []*cloudwatchlogs.FilteredLogEvent, eventLogGroups map[string]string) {
+	table.Columns = append(table.Columns, &datasource.TableColumn{Name: "LogGroupName"})
+	values := make([]datasource.RowValue, len(events))
+	for i, e := range events {
+		values[i] = datasource.RowValue{Kind: datasource.RowValue_TYPE_STRING, StringValue: eventLogGroups[aws.StringValue(e.EventId)]}
+		table.Rows[i].Values = append(table.Rows[i].Values, &values[i])
+	}
+}
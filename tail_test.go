@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+)
+
+func tailResult(truncated bool, events ...int64) logGroupResult {
+	r := logGroupResult{resp: &cloudwatchlogs.FilterLogEventsOutput{}, stats: &queryStats{Engine: "filter"}}
+	for _, ts := range events {
+		r.resp.Events = append(r.resp.Events, &cloudwatchlogs.FilteredLogEvent{
+			EventId:   aws.String(strconv.FormatInt(ts, 10)),
+			Timestamp: aws.Int64(ts),
+		})
+	}
+	if truncated {
+		r.stats.Truncated = "the limit of events was reached"
+	}
+	return r
+}
+
+func TestMergeTailResults(t *testing.T) {
+	tests := []struct {
+		name      string
+		results   []logGroupResult
+		maxEvents int64
+		want      []int64
+		truncated bool
+		partial   bool
+		err       bool
+	}{
+		{
+			name:      "time order",
+			results:   []logGroupResult{tailResult(false, 1, 4, 6), tailResult(false, 2, 3, 5)},
+			maxEvents: 100,
+			want:      []int64{1, 2, 3, 4, 5, 6},
+		},
+		{
+			name:      "stop at the last event of a truncated log group",
+			results:   []logGroupResult{tailResult(true, 1, 3), tailResult(false, 2, 4, 5)},
+			maxEvents: 100,
+			want:      []int64{1, 2, 3},
+			truncated: true,
+		},
+		{
+			name:      "truncated log group without events",
+			results:   []logGroupResult{tailResult(true), tailResult(false, 2, 4)},
+			maxEvents: 100,
+			want:      []int64{},
+			truncated: true,
+		},
+		{
+			name:      "limit of events",
+			results:   []logGroupResult{tailResult(false, 1, 3, 5), tailResult(false, 2, 4)},
+			maxEvents: 3,
+			want:      []int64{1, 2, 3},
+			truncated: true,
+		},
+		{
+			name:      "partial failure",
+			results:   []logGroupResult{tailResult(false, 1, 2), {err: errors.New("access denied")}},
+			maxEvents: 100,
+			want:      []int64{1, 2},
+			partial:   true,
+		},
+		{
+			name:      "every log group failed",
+			results:   []logGroupResult{{err: errors.New("access denied")}, {err: errors.New("throttled")}},
+			maxEvents: 100,
+			err:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := make([]string, len(tt.results))
+			for i := range groups {
+				groups[i] = string(rune('a' + i))
+			}
+			resp, stats, eventLogGroups, err := mergeTailResults(groups, tt.results, 0, tt.maxEvents)
+			if tt.err {
+				if err == nil {
+					t.Fatal("no error when every log group failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]int64, 0)
+			for _, e := range resp.Events {
+				got = append(got, *e.Timestamp)
+				if eventLogGroups[*e.EventId] == "" {
+					t.Errorf("no log group for event %s", *e.EventId)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %v, want %v", got, tt.want)
+			}
+			if (stats.Truncated != "") != tt.truncated {
+				t.Errorf("Truncated = %q", stats.Truncated)
+			}
+			if (stats.PartialError != "") != tt.partial {
+				t.Errorf("PartialError = %q", stats.PartialError)
+			}
+		})
+	}
+}
+
+func TestTailCursor(t *testing.T) {
+	tests := []tailCursor{
+		{},
+		{Time: 1565000000000},
+		{Time: 1565000000000, Seen: []string{"35000000000000000000000000000000000000000000000000000000"}, Idle: 2},
+	}
+	for _, c := range tests {
+		got, err := decodeTailCursor(c.encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, c) {
+			t.Errorf("decodeTailCursor(encode(%+v)) = %+v", c, got)
+		}
+	}
+	for _, s := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, err := decodeTailCursor(s); err == nil {
+			t.Errorf("decodeTailCursor(%q) returned no error", s)
+		}
+	}
+}
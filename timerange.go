@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+// parseTimeShift parses a shift such as "-24h", "1d" or "-1w", in addition to the units supported by time.ParseDuration.
+func parseTimeShift(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid time shift %q", s)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time shift %q", s)
+	}
+	return d, nil
+}
+
+// isoTimeLayouts are the ISO-8601 layouts accepted in time ranges, times without a zone being UTC.
+var isoTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseTimeRange returns the time range of a request in epoch milliseconds. Grafana sends the raw times as epoch milliseconds,
+// but API callers may send ISO-8601 or relative times, and the epoch times are used when the raw ones are missing.
+func parseTimeRange(timeRange *datasource.TimeRange, now time.Time) (int64, int64, error) {
+	if timeRange == nil {
+		return 0, 0, fmt.Errorf("time range is required")
+	}
+	from, to := timeRange.FromEpochMs, timeRange.ToEpochMs
+	var err error
+	if timeRange.FromRaw != "" {
+		if from, err = parseTime(timeRange.FromRaw, now, false); err != nil {
+			return 0, 0, err
+		}
+	}
+	if timeRange.ToRaw != "" {
+		if to, err = parseTime(timeRange.ToRaw, now, true); err != nil {
+			return 0, 0, err
+		}
+	}
+	if from > to {
+		return 0, 0, fmt.Errorf("invalid time range, %q is after %q", timeRange.FromRaw, timeRange.ToRaw)
+	}
+	return from, to, nil
+}
+
+// parseTime parses epoch milliseconds, an ISO-8601 time or a relative time such as "now-6h" or "now-1d/d",
+// rounded as Grafana does, down to the start of the unit, or up to its end for the end of a range.
+func parseTime(s string, now time.Time, roundUp bool) (int64, error) {
+	s = strings.TrimSpace(s)
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return ms, nil
+	}
+	if strings.HasPrefix(s, "now") {
+		t, err := parseRelativeTime(strings.TrimPrefix(s, "now"), now.UTC(), roundUp)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time %q: %v", s, err)
+		}
+		return t.UnixNano() / int64(time.Millisecond), nil
+	}
+	for _, layout := range isoTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UnixNano() / int64(time.Millisecond), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time %q, epoch milliseconds, ISO-8601 or now-6h style times are supported", s)
+}
+
+func parseRelativeTime(s string, t time.Time, roundUp bool) (time.Time, error) {
+	round := ""
+	if i := strings.Index(s, "/"); i >= 0 {
+		s, round = s[:i], s[i+1:]
+	}
+	if s != "" {
+		if s[0] != '-' && s[0] != '+' {
+			return t, fmt.Errorf("expected - or + after now")
+		}
+		var err error
+		if t, err = addRelative(t, s); err != nil {
+			return t, err
+		}
+	}
+	if round != "" {
+		start, err := startOfUnit(t, round)
+		if err != nil {
+			return t, err
+		}
+		if roundUp {
+			end, _ := addRelative(start, "+1"+round)
+			return end.Add(-time.Millisecond), nil
+		}
+		return start, nil
+	}
+	return t, nil
+}
+
+// addRelative adds an offset such as "-6h" or "+1M", months and years being calendar ones.
+func addRelative(t time.Time, offset string) (time.Time, error) {
+	switch {
+	case strings.HasSuffix(offset, "M") || strings.HasSuffix(offset, "y"):
+		n, err := strconv.Atoi(strings.TrimPrefix(offset[:len(offset)-1], "+"))
+		if err != nil {
+			return t, fmt.Errorf("invalid offset %q", offset)
+		}
+		if strings.HasSuffix(offset, "y") {
+			return t.AddDate(n, 0, 0), nil
+		}
+		return t.AddDate(0, n, 0), nil
+	}
+	d, err := parseTimeShift(strings.TrimPrefix(offset, "+"))
+	if err != nil {
+		return t, fmt.Errorf("invalid offset %q", offset)
+	}
+	return t.Add(d), nil
+}
+
+func startOfUnit(t time.Time, unit string) (time.Time, error) {
+	switch unit {
+	case "s":
+		return t.Truncate(time.Second), nil
+	case "m":
+		return t.Truncate(time.Minute), nil
+	case "h":
+		return t.Truncate(time.Hour), nil
+	case "d":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()), nil
+	case "w":
+		d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return d.AddDate(0, 0, -int(d.Weekday())), nil
+	case "M":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()), nil
+	case "y":
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location()), nil
+	}
+	return t, fmt.Errorf("invalid rounding unit %q", unit)
+}
+
+// applyTimeShift sets the time range of the target, the dashboard one unless the target overrides it, shifted by its time shift.
+func (target *Target) applyTimeShift(from int64, to int64) error {
+	now := time.Now()
+	var err error
+	if target.TimeFrom != "" {
+		if from, err = parseTime(target.TimeFrom, now, false); err != nil {
+			return err
+		}
+	}
+	if target.TimeTo != "" {
+		if to, err = parseTime(target.TimeTo, now, true); err != nil {
+			return err
+		}
+	}
+	if from > to {
+		return fmt.Errorf("invalid time range, the start of the target is after its end")
+	}
+	shift, err := parseTimeShift(target.TimeShift)
+	if err != nil {
+		return err
+	}
+	target.shiftMs = shift.Nanoseconds() / int64(time.Millisecond)
+	target.From = from + target.shiftMs
+	target.To = to + target.shiftMs
+	return nil
+}
+
+// unshiftSeries moves the points of a shifted target back into the dashboard time range, so that they overlay the unshifted series.
+func unshiftSeries(series []*datasource.TimeSeries, shiftMs int64) {
+	if shiftMs == 0 {
+		return
+	}
+	for _, s := range series {
+		for _, p := range s.Points {
+			p.Timestamp -= shiftMs
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+)
+
+func epochMs(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2019, 8, 7, 10, 30, 15, 500*int(time.Millisecond), time.UTC)
+	tests := []struct {
+		in      string
+		roundUp bool
+		want    time.Time
+		err     bool
+	}{
+		{in: "1565000000000", want: time.Date(2019, 8, 5, 10, 13, 20, 0, time.UTC)},
+		{in: "2019-08-05T10:13:20Z", want: time.Date(2019, 8, 5, 10, 13, 20, 0, time.UTC)},
+		{in: "2019-08-05T12:13:20+02:00", want: time.Date(2019, 8, 5, 10, 13, 20, 0, time.UTC)},
+		{in: "2019-08-05T10:13", want: time.Date(2019, 8, 5, 10, 13, 0, 0, time.UTC)},
+		{in: "2019-08-05", want: time.Date(2019, 8, 5, 0, 0, 0, 0, time.UTC)},
+		{in: "now", want: now},
+		{in: " now-6h ", want: now.Add(-6 * time.Hour)},
+		{in: "now+15m", want: now.Add(15 * time.Minute)},
+		{in: "now-2d", want: now.AddDate(0, 0, -2)},
+		{in: "now-1M", want: now.AddDate(0, -1, 0)},
+		{in: "now-1y", want: now.AddDate(-1, 0, 0)},
+		{in: "now/d", want: time.Date(2019, 8, 7, 0, 0, 0, 0, time.UTC)},
+		{in: "now/d", roundUp: true, want: time.Date(2019, 8, 7, 23, 59, 59, 999*int(time.Millisecond), time.UTC)},
+		{in: "now-1d/d", want: time.Date(2019, 8, 6, 0, 0, 0, 0, time.UTC)},
+		{in: "now/w", want: time.Date(2019, 8, 4, 0, 0, 0, 0, time.UTC)},
+		{in: "now/M", roundUp: true, want: time.Date(2019, 8, 31, 23, 59, 59, 999*int(time.Millisecond), time.UTC)},
+		{in: "now/y", want: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "yesterday", err: true},
+		{in: "now6h", err: true},
+		{in: "now-6x", err: true},
+		{in: "now/q", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTime(tt.in, now, tt.roundUp)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseTime(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseTime(%q): %v", tt.in, err)
+			continue
+		}
+		if want := epochMs(tt.want); got != want {
+			t.Errorf("parseTime(%q, %v) = %d, want %d", tt.in, tt.roundUp, got, want)
+		}
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	now := time.Date(2019, 8, 7, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		timeRange *datasource.TimeRange
+		from, to  int64
+		err       bool
+	}{
+		{timeRange: nil, err: true},
+		{timeRange: &datasource.TimeRange{FromEpochMs: 1000, ToEpochMs: 2000}, from: 1000, to: 2000},
+		{timeRange: &datasource.TimeRange{FromRaw: "1000", ToRaw: "2000", FromEpochMs: 1, ToEpochMs: 2}, from: 1000, to: 2000},
+		{timeRange: &datasource.TimeRange{FromRaw: "now-1h", ToRaw: "now"}, from: epochMs(now.Add(-time.Hour)), to: epochMs(now)},
+		{timeRange: &datasource.TimeRange{FromRaw: "now", ToRaw: "now-1h"}, err: true},
+		{timeRange: &datasource.TimeRange{FromRaw: "now-1h", ToRaw: "later"}, err: true},
+	}
+	for _, tt := range tests {
+		from, to, err := parseTimeRange(tt.timeRange, now)
+		if (err != nil) != tt.err {
+			t.Errorf("parseTimeRange(%+v) error = %v", tt.timeRange, err)
+			continue
+		}
+		if !tt.err && (from != tt.from || to != tt.to) {
+			t.Errorf("parseTimeRange(%+v) = %d, %d, want %d, %d", tt.timeRange, from, to, tt.from, tt.to)
+		}
+	}
+}
+
+func TestParseTimeShift(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		err  bool
+	}{
+		{in: "", want: 0},
+		{in: "-24h", want: -24 * time.Hour},
+		{in: "1d", want: 24 * time.Hour},
+		{in: "-1w", want: -7 * 24 * time.Hour},
+		{in: "1.5d", want: 36 * time.Hour},
+		{in: "1x", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeShift(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseTimeShift(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
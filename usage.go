@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/grafana/grafana-plugin-model/go/datasource"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+)
+
+// maxTrackedInsightsQueries bounds the Insights queries whose scanned bytes are remembered between polls,
+// as queries stopped before they complete are never forgotten otherwise.
+const maxTrackedInsightsQueries = 1000
+
+// datasourceUsage is the CloudWatch Logs usage of a datasource in the current month, kept in memory,
+// so that it starts again when the plugin restarts.
+type datasourceUsage struct {
+	lock         sync.Mutex
+	month        string
+	since        time.Time
+	calls        map[string]int64
+	bytesScanned float64
+	queries      map[string]float64
+}
+
+type costSummary struct {
+	Month         string
+	Since         time.Time
+	ApiCalls      int64
+	BytesScanned  float64
+	EstimatedCost float64
+	Currency      string
+}
+
+var (
+	usages    = make(map[int64]*datasourceUsage)
+	usageLock sync.Mutex
+)
+
+func usageFor(datasourceId int64) *datasourceUsage {
+	usageLock.Lock()
+	defer usageLock.Unlock()
+	u, ok := usages[datasourceId]
+	if !ok {
+		u = &datasourceUsage{}
+		usages[datasourceId] = u
+	}
+	return u
+}
+
+// roll starts a new month, it is called with the lock held.
+func (u *datasourceUsage) roll(now time.Time) {
+	month := now.UTC().Format("2006-01")
+	if u.month == month {
+		return
+	}
+	u.month = month
+	u.since = now
+	u.calls = make(map[string]int64)
+	u.bytesScanned = 0
+	u.queries = make(map[string]float64)
+}
+
+// handler counts the API calls of a client, and the bytes scanned by its Insights queries. GetQueryResults
+// returns the bytes scanned so far by each poll, so that only the increase since the previous poll is added.
+func (u *datasourceUsage) handler() func(r *request.Request) {
+	return func(r *request.Request) {
+		u.lock.Lock()
+		defer u.lock.Unlock()
+		u.roll(time.Now())
+		u.calls[r.Operation.Name]++
+		if r.Error != nil {
+			return
+		}
+		resp, ok := r.Data.(*cloudwatchlogs.GetQueryResultsOutput)
+		if !ok || resp.Statistics == nil {
+			return
+		}
+		input, ok := r.Params.(*cloudwatchlogs.GetQueryResultsInput)
+		if !ok {
+			return
+		}
+		id := aws.StringValue(input.QueryId)
+		scanned := aws.Float64Value(resp.Statistics.BytesScanned)
+		if scanned > u.queries[id] {
+			u.bytesScanned += scanned - u.queries[id]
+		}
+		switch aws.StringValue(resp.Status) {
+		case "Running", "Scheduled":
+			if len(u.queries) >= maxTrackedInsightsQueries {
+				u.queries = make(map[string]float64)
+			}
+			u.queries[id] = scanned
+		default:
+			delete(u.queries, id)
+		}
+	}
+}
+
+func (u *datasourceUsage) summary(dsInfo *DatasourceInfo) (costSummary, map[string]int64) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.roll(time.Now())
+	s := costSummary{Month: u.month, Since: u.since, BytesScanned: u.bytesScanned, Currency: "USD"}
+	calls := make(map[string]int64, len(u.calls))
+	for op, n := range u.calls {
+		calls[op] = n
+		s.ApiCalls += n
+	}
+	s.EstimatedCost = estimateInsightsCost(u.bytesScanned, dsInfo.insightsPricePerGB()) + float64(s.ApiCalls)/1000*dsInfo.ApiPricePer1000Calls
+	return s, calls
+}
+
+// costQuery summarizes the API calls and Insights scans of the datasource since the start of the month,
+// with their estimated cost, attributing to Grafana the part of the CloudWatch Logs bill it caused.
+func (t *AwsCloudWatchLogsDatasource) costQuery(ctx context.Context, tsdbReq *datasource.DatasourceRequest, parameters *simplejson.Json) (*datasource.QueryResult, error) {
+	dsInfo, err := t.getDsInfo(tsdbReq.Datasource, "")
+	if err != nil {
+		return nil, err
+	}
+	summary, calls := usageFor(tsdbReq.Datasource.Id).summary(dsInfo)
+
+	operations := make([]string, 0, len(calls))
+	for op := range calls {
+		operations = append(operations, op)
+	}
+	sort.Strings(operations)
+	table := &datasource.Table{
+		Columns: []*datasource.TableColumn{{Name: "Operation"}, {Name: "Calls"}},
+	}
+	for _, op := range operations {
+		table.Rows = append(table.Rows, &datasource.TableRow{
+			Values: []*datasource.RowValue{
+				{Kind: datasource.RowValue_TYPE_STRING, StringValue: op},
+				{Kind: datasource.RowValue_TYPE_INT64, Int64Value: calls[op]},
+			},
+		})
+	}
+
+	metaJson, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+	return &datasource.QueryResult{
+		Tables:   []*datasource.Table{table},
+		MetaJson: string(metaJson),
+	}, nil
+}
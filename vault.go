@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+const vaultProviderName = "VaultProvider"
+
+var vaultHttpClient = &http.Client{Timeout: 10 * time.Second}
+
+// vaultProvider retrieves short-lived credentials from the AWS secrets engine of HashiCorp Vault.
+// The credentials are fetched again when the lease expires.
+type vaultProvider struct {
+	credentials.Expiry
+
+	addr           string
+	token          string
+	mount          string
+	role           string
+	credentialType string
+}
+
+type vaultSecret struct {
+	LeaseDuration int64 `json:"lease_duration"`
+	Data          struct {
+		AccessKey     string `json:"access_key"`
+		SecretKey     string `json:"secret_key"`
+		SecurityToken string `json:"security_token"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func newVaultProvider(dsInfo *DatasourceInfo) (*vaultProvider, error) {
+	p := &vaultProvider{
+		addr:           dsInfo.VaultAddr,
+		token:          dsInfo.VaultToken,
+		mount:          strings.Trim(dsInfo.VaultMount, "/"),
+		role:           dsInfo.VaultRole,
+		credentialType: dsInfo.VaultCredentialType,
+	}
+	if p.addr == "" {
+		p.addr = os.Getenv("VAULT_ADDR")
+	}
+	if p.token == "" {
+		// the token of the server is only sent to the Vault of the server, as org admins can edit the address
+		if strings.TrimRight(p.addr, "/") != strings.TrimRight(os.Getenv("VAULT_ADDR"), "/") {
+			return nil, fmt.Errorf("a vault token is required for a vault address other than VAULT_ADDR")
+		}
+		p.token = os.Getenv("VAULT_TOKEN")
+	}
+	if p.mount == "" {
+		p.mount = "aws"
+	}
+	if p.credentialType == "" {
+		p.credentialType = "creds"
+	}
+	if p.addr == "" || p.role == "" {
+		return nil, fmt.Errorf("vault address and role are required")
+	}
+	if p.credentialType != "creds" && p.credentialType != "sts" {
+		return nil, fmt.Errorf("unknown vault credential type: %s", p.credentialType)
+	}
+	return p, nil
+}
+
+// Retrieve reads the credentials of the role, using the creds endpoint for iam_user and assumed_role roles,
+// or the sts endpoint for federation_token roles.
+func (p *vaultProvider) Retrieve() (credentials.Value, error) {
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", strings.TrimRight(p.addr, "/"), p.mount, p.credentialType, p.role)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return credentials.Value{ProviderName: vaultProviderName}, err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	resp, err := vaultHttpClient.Do(req)
+	if err != nil {
+		return credentials.Value{ProviderName: vaultProviderName}, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return credentials.Value{ProviderName: vaultProviderName}, err
+	}
+
+	var secret vaultSecret
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return credentials.Value{ProviderName: vaultProviderName}, fmt.Errorf("invalid vault response (%d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return credentials.Value{ProviderName: vaultProviderName}, fmt.Errorf("vault returned %d: %s", resp.StatusCode, strings.Join(secret.Errors, ", "))
+	}
+	if secret.Data.AccessKey == "" || secret.Data.SecretKey == "" {
+		return credentials.Value{ProviderName: vaultProviderName}, fmt.Errorf("vault response has no AWS credentials")
+	}
+
+	lease := time.Duration(secret.LeaseDuration) * time.Second
+	if lease <= 0 {
+		lease = 15 * time.Minute
+	}
+	window := lease / 5
+	if window > 5*time.Minute {
+		window = 5 * time.Minute
+	}
+	p.SetExpiration(time.Now().Add(lease), window)
+
+	return credentials.Value{
+		AccessKeyID:     secret.Data.AccessKey,
+		SecretAccessKey: secret.Data.SecretKey,
+		SessionToken:    secret.Data.SecurityToken,
+		ProviderName:    vaultProviderName,
+	}, nil
+}